@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/suprie/budget-manager/internal/handler"
 	"github.com/suprie/budget-manager/internal/middleware"
 	"github.com/suprie/budget-manager/internal/repository"
 	"github.com/suprie/budget-manager/internal/service"
 	"github.com/suprie/budget-manager/pkg/database"
+	"github.com/suprie/budget-manager/pkg/storage"
 )
 
 func main() {
@@ -32,6 +36,22 @@ func main() {
 		log.Println("Warning: Using default JWT secret. Set JWT_SECRET environment variable in production.")
 	}
 
+	// Per-user attachment quota in megabytes
+	attachmentQuotaMB := int64(100)
+	if v := os.Getenv("ATTACHMENT_QUOTA_MB"); v != "" {
+		quota, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || quota <= 0 {
+			log.Fatalf("Invalid ATTACHMENT_QUOTA_MB: %q", v)
+		}
+		attachmentQuotaMB = quota
+	}
+
+	// Initialize attachment storage
+	blobStore, err := newBlobStore()
+	if err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+
 	// Initialize database
 	db, err := database.NewSQLiteDB(database.Config{Path: dbPath})
 	if err != nil {
@@ -45,13 +65,34 @@ func main() {
 	budgetRepo := repository.NewBudgetRepository(db)
 	expenseRepo := repository.NewExpenseRepository(db)
 	budgetRuleRepo := repository.NewBudgetRuleRepository(db)
+	tagRepo := repository.NewTagRepository(db)
+	customFieldRepo := repository.NewCustomFieldRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	payeeRepo := repository.NewPayeeRepository(db)
+	reportRepo := repository.NewReportRepository(db)
+	snapshotRepo := repository.NewSnapshotRepository(db)
+	importRepo := repository.NewImportRepository(db)
+	duplicateRepo := repository.NewDuplicateRepository(db)
+	classifierRepo := repository.NewClassifierRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	txManager := repository.NewTxManager(db)
 
 	// Initialize services
-	authService := service.NewAuthService(userRepo, jwtSecret)
-	pocketService := service.NewPocketService(pocketRepo)
-	budgetService := service.NewBudgetService(budgetRepo, pocketRepo)
-	expenseService := service.NewExpenseService(expenseRepo, budgetRepo)
-	budgetRuleService := service.NewBudgetRuleService(budgetRuleRepo, budgetRepo)
+	authService := service.NewAuthService(userRepo, sessionRepo, txManager, jwtSecret)
+	pocketService := service.NewPocketService(pocketRepo, snapshotRepo)
+	budgetService := service.NewBudgetService(budgetRepo, pocketRepo, snapshotRepo)
+	attachmentService := service.NewAttachmentService(attachmentRepo, expenseRepo, blobStore, attachmentQuotaMB<<20)
+	payeeService := service.NewPayeeService(payeeRepo, txManager)
+	classifier := service.NewClassifier(classifierRepo, expenseRepo, budgetRepo, txManager)
+	budgetRuleService := service.NewBudgetRuleService(budgetRuleRepo, budgetRepo, pocketRepo, payeeService, classifier, txManager)
+	expenseService := service.NewExpenseService(expenseRepo, budgetRepo, tagRepo, customFieldRepo, attachmentService, payeeService, budgetRuleService, snapshotRepo, duplicateRepo, classifier, txManager)
+	tagService := service.NewTagService(tagRepo)
+	customFieldService := service.NewCustomFieldService(customFieldRepo)
+	reportService := service.NewReportService(reportRepo)
+	balanceHistoryService := service.NewBalanceHistoryService(snapshotRepo, pocketRepo, txManager)
+	exportService := service.NewExportService(expenseService, budgetService, pocketService, budgetRuleService, payeeService)
+	importService := service.NewImportService(importRepo, budgetRepo, pocketRepo, expenseService, budgetRuleService, txManager)
+	categorizationService := service.NewCategorizationService(budgetRuleService, expenseService, classifier, expenseRepo, budgetRepo)
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(authService)
@@ -62,6 +103,15 @@ func main() {
 	budgetHandler := handler.NewBudgetHandler(budgetService)
 	expenseHandler := handler.NewExpenseHandler(expenseService)
 	budgetRuleHandler := handler.NewBudgetRuleHandler(budgetRuleService)
+	tagHandler := handler.NewTagHandler(tagService)
+	customFieldHandler := handler.NewCustomFieldHandler(customFieldService)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentService)
+	payeeHandler := handler.NewPayeeHandler(payeeService)
+	reportHandler := handler.NewReportHandler(reportService)
+	balanceHistoryHandler := handler.NewBalanceHistoryHandler(balanceHistoryService)
+	exportHandler := handler.NewExportHandler(exportService)
+	importHandler := handler.NewImportHandler(importService)
+	categorizationHandler := handler.NewCategorizationHandler(categorizationService)
 
 	// Setup routes
 	mux := http.NewServeMux()
@@ -69,12 +119,17 @@ func main() {
 	// Auth routes (public)
 	mux.HandleFunc("POST /api/auth/register", authHandler.Register)
 	mux.HandleFunc("POST /api/auth/login", authHandler.Login)
+	mux.HandleFunc("POST /api/auth/refresh", authHandler.Refresh)
 
 	// Protected routes mux
 	protectedMux := http.NewServeMux()
 
 	// Auth routes (protected)
 	protectedMux.HandleFunc("GET /api/auth/me", authHandler.Me)
+	protectedMux.HandleFunc("POST /api/auth/logout", authHandler.Logout)
+	protectedMux.HandleFunc("POST /api/auth/logout-all", authHandler.LogoutAll)
+	protectedMux.HandleFunc("GET /api/auth/sessions", authHandler.Sessions)
+	protectedMux.HandleFunc("DELETE /api/auth/sessions/{id}", authHandler.RevokeSession)
 
 	// Pocket routes
 	protectedMux.HandleFunc("POST /api/pockets", pocketHandler.Create)
@@ -83,6 +138,8 @@ func main() {
 	protectedMux.HandleFunc("PUT /api/pockets/{id}", pocketHandler.Update)
 	protectedMux.HandleFunc("DELETE /api/pockets/{id}", pocketHandler.Delete)
 	protectedMux.HandleFunc("POST /api/pockets/{id}/add-funds", pocketHandler.AddFunds)
+	protectedMux.HandleFunc("GET /api/pockets/{id}/history", balanceHistoryHandler.PocketHistory)
+	protectedMux.HandleFunc("POST /api/pockets/history/backfill", balanceHistoryHandler.Backfill)
 
 	// Budget routes
 	protectedMux.HandleFunc("POST /api/budgets", budgetHandler.Create)
@@ -102,8 +159,20 @@ func main() {
 	protectedMux.HandleFunc("PUT /api/expenses/{id}", expenseHandler.Update)
 	protectedMux.HandleFunc("DELETE /api/expenses/{id}", expenseHandler.Delete)
 	protectedMux.HandleFunc("GET /api/expenses/by-date-range", expenseHandler.GetByDateRange)
+	protectedMux.HandleFunc("GET /api/expenses/search", expenseHandler.Search)
+	protectedMux.HandleFunc("GET /api/expenses/duplicates", expenseHandler.GetDuplicates)
+	protectedMux.HandleFunc("POST /api/expenses/duplicates", expenseHandler.ResolveDuplicate)
+	protectedMux.HandleFunc("POST /api/expenses/{id}/refunds", expenseHandler.CreateRefund)
+	protectedMux.HandleFunc("GET /api/expenses/{id}/refunds", expenseHandler.GetRefunds)
 	protectedMux.HandleFunc("GET /api/budgets/{budget_id}/expenses", expenseHandler.GetByBudgetID)
 
+	// Attachment routes
+	protectedMux.HandleFunc("POST /api/expenses/{id}/attachments", attachmentHandler.Upload)
+	protectedMux.HandleFunc("GET /api/expenses/{id}/attachments", attachmentHandler.GetByExpenseID)
+	protectedMux.HandleFunc("GET /api/expenses/{id}/attachments/{attachment_id}", attachmentHandler.Download)
+	protectedMux.HandleFunc("GET /api/expenses/{id}/attachments/{attachment_id}/thumbnail", attachmentHandler.Thumbnail)
+	protectedMux.HandleFunc("DELETE /api/expenses/{id}/attachments/{attachment_id}", attachmentHandler.Delete)
+
 	// Budget rule routes
 	protectedMux.HandleFunc("POST /api/budget-rules", budgetRuleHandler.Create)
 	protectedMux.HandleFunc("GET /api/budget-rules", budgetRuleHandler.GetAll)
@@ -111,8 +180,78 @@ func main() {
 	protectedMux.HandleFunc("PUT /api/budget-rules/{id}", budgetRuleHandler.Update)
 	protectedMux.HandleFunc("DELETE /api/budget-rules/{id}", budgetRuleHandler.Delete)
 	protectedMux.HandleFunc("GET /api/budget-rules/match", budgetRuleHandler.MatchTransaction)
+	protectedMux.HandleFunc("POST /api/budget-rules/match", budgetRuleHandler.MatchBatch)
+	protectedMux.HandleFunc("POST /api/budget-rules/apply", categorizationHandler.Apply)
+	protectedMux.HandleFunc("POST /api/budget-rules/simulate", categorizationHandler.Simulate)
+	protectedMux.HandleFunc("GET /api/budget-rules/analysis", budgetRuleHandler.Analysis)
+	protectedMux.HandleFunc("GET /api/budget-rules/export", budgetRuleHandler.Export)
+	protectedMux.HandleFunc("POST /api/budget-rules/import", budgetRuleHandler.Import)
+	protectedMux.HandleFunc("GET /api/budget-rules/presets", budgetRuleHandler.Presets)
+	protectedMux.HandleFunc("GET /api/budget-rules/presets/{name}", budgetRuleHandler.Preset)
+	protectedMux.HandleFunc("POST /api/budget-rules/presets/{name}/install", budgetRuleHandler.InstallPreset)
+	protectedMux.HandleFunc("GET /api/budget-rules/suggestions", categorizationHandler.Suggestions)
+	protectedMux.HandleFunc("POST /api/budget-rules/suggestions/accept", categorizationHandler.AcceptSuggestion)
+	protectedMux.HandleFunc("GET /api/budget-rules/classifier", categorizationHandler.ClassifierStats)
+	protectedMux.HandleFunc("POST /api/budget-rules/classifier/train", categorizationHandler.TrainClassifier)
 	protectedMux.HandleFunc("GET /api/budgets/{budget_id}/rules", budgetRuleHandler.GetByBudgetID)
 
+	// Tag routes
+	protectedMux.HandleFunc("POST /api/tags", tagHandler.Create)
+	protectedMux.HandleFunc("GET /api/tags", tagHandler.GetAll)
+	protectedMux.HandleFunc("GET /api/tags/{id}", tagHandler.GetByID)
+	protectedMux.HandleFunc("PUT /api/tags/{id}", tagHandler.Update)
+	protectedMux.HandleFunc("DELETE /api/tags/{id}", tagHandler.Delete)
+	protectedMux.HandleFunc("GET /api/reports/tags/{tag}", tagHandler.GetReport)
+
+	// Custom field routes
+	protectedMux.HandleFunc("POST /api/custom-fields", customFieldHandler.Create)
+	protectedMux.HandleFunc("GET /api/custom-fields", customFieldHandler.GetAll)
+	protectedMux.HandleFunc("GET /api/custom-fields/{id}", customFieldHandler.GetByID)
+	protectedMux.HandleFunc("PUT /api/custom-fields/{id}", customFieldHandler.Update)
+	protectedMux.HandleFunc("DELETE /api/custom-fields/{id}", customFieldHandler.Delete)
+
+	// Payee routes
+	protectedMux.HandleFunc("POST /api/payees", payeeHandler.Create)
+	protectedMux.HandleFunc("GET /api/payees", payeeHandler.GetAll)
+	protectedMux.HandleFunc("GET /api/payees/{id}", payeeHandler.GetByID)
+	protectedMux.HandleFunc("PUT /api/payees/{id}", payeeHandler.Update)
+	protectedMux.HandleFunc("DELETE /api/payees/{id}", payeeHandler.Delete)
+	protectedMux.HandleFunc("POST /api/payees/{id}/merge", payeeHandler.Merge)
+	protectedMux.HandleFunc("GET /api/payees/{id}/stats", payeeHandler.GetStats)
+	protectedMux.HandleFunc("POST /api/payees/{id}/rules", payeeHandler.CreateRule)
+	protectedMux.HandleFunc("GET /api/payees/{id}/rules", payeeHandler.GetRules)
+	protectedMux.HandleFunc("DELETE /api/payee-rules/{id}", payeeHandler.DeleteRule)
+	protectedMux.HandleFunc("GET /api/payees/match", payeeHandler.Match)
+	protectedMux.HandleFunc("POST /api/payees/backfill", payeeHandler.Backfill)
+
+	// Report routes
+	protectedMux.HandleFunc("GET /api/reports/spending-by-category", reportHandler.SpendingByCategory)
+	protectedMux.HandleFunc("GET /api/reports/trends", reportHandler.Trends)
+	protectedMux.HandleFunc("GET /api/reports/variance", reportHandler.Variance)
+	protectedMux.HandleFunc("GET /api/reports/top-payees", reportHandler.TopPayees)
+	protectedMux.HandleFunc("GET /api/reports/spending-series", reportHandler.Series)
+	protectedMux.HandleFunc("GET /api/reports/net-worth", balanceHistoryHandler.NetWorth)
+
+	// Export routes
+	protectedMux.HandleFunc("GET /api/export/expenses", exportHandler.Expenses)
+	protectedMux.HandleFunc("GET /api/export/budgets", exportHandler.Budgets)
+	protectedMux.HandleFunc("GET /api/export/pockets", exportHandler.Pockets)
+	protectedMux.HandleFunc("GET /api/export/budget-rules", exportHandler.BudgetRules)
+
+	// Statement import routes
+	protectedMux.HandleFunc("POST /api/imports", importHandler.Upload)
+	protectedMux.HandleFunc("GET /api/imports", importHandler.GetAll)
+	protectedMux.HandleFunc("GET /api/imports/{id}", importHandler.GetByID)
+	protectedMux.HandleFunc("GET /api/imports/{id}/items", importHandler.GetItems)
+	protectedMux.HandleFunc("PUT /api/imports/{id}/items/{item_id}", importHandler.UpdateItem)
+	protectedMux.HandleFunc("POST /api/imports/{id}/items/{item_id}/approve", importHandler.ApproveItem)
+	protectedMux.HandleFunc("POST /api/imports/{id}/items/bulk", importHandler.BulkItems)
+	protectedMux.HandleFunc("POST /api/imports/{id}/rollback", importHandler.Rollback)
+	protectedMux.HandleFunc("GET /api/imports/banks", importHandler.Banks)
+	protectedMux.HandleFunc("GET /api/imports/accounts", importHandler.GetAccounts)
+	protectedMux.HandleFunc("PUT /api/imports/accounts", importHandler.SetAccount)
+	protectedMux.HandleFunc("DELETE /api/imports/accounts/{id}", importHandler.DeleteAccount)
+
 	// Apply auth middleware to protected routes
 	mux.Handle("/api/", authMiddleware.Authenticate(protectedMux))
 
@@ -122,8 +261,39 @@ func main() {
 		w.Write([]byte(`{"status":"ok"}`))
 	})
 
+	// Learn from the expenses recorded before the classifier existed
+	if err := classifier.EnsureTrained(context.Background()); err != nil {
+		log.Printf("Failed to train the classifier: %v", err)
+	}
+
+	// Snapshot every pocket once a day so quiet pockets still chart
+	go balanceHistoryService.RunDaily(context.Background())
+
 	log.Printf("Server starting on port %s", port)
 	if err := http.ListenAndServe(":"+port, mux); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// newBlobStore picks the attachment backend from ATTACHMENT_STORAGE:
+// "local" (default) writes below ATTACHMENT_DIR, "s3" uses the S3_* variables
+func newBlobStore() (storage.BlobStore, error) {
+	switch backend := os.Getenv("ATTACHMENT_STORAGE"); backend {
+	case "", "local":
+		dir := os.Getenv("ATTACHMENT_DIR")
+		if dir == "" {
+			dir = "./attachments"
+		}
+		return storage.NewLocalStore(dir)
+	case "s3":
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"time"
+)
+
+// Attachment is a receipt file attached to an expense. The blob itself lives
+// in the configured storage backend under StorageKey.
+type Attachment struct {
+	ID           int64     `json:"id"`
+	ExpenseID    int64     `json:"expense_id"`
+	UserID       int64     `json:"user_id"`
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	HasThumbnail bool      `json:"has_thumbnail"`
+	CreatedAt    time.Time `json:"created_at"`
+}
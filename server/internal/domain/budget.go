@@ -41,7 +41,9 @@ type UpdateBudgetRequest struct {
 type BudgetSummary struct {
 	Period           string  `json:"period"`
 	TotalAllocated   float64 `json:"total_allocated"`
-	TotalSpent       float64 `json:"total_spent"`
+	TotalSpent       float64 `json:"total_spent"` // Net of refunds
+	GrossSpent       float64 `json:"gross_spent"` // Spending before refunds
+	TotalRefunds     float64 `json:"total_refunds"`
 	TotalRemaining   float64 `json:"total_remaining"`
 	UnallocatedFunds float64 `json:"unallocated_funds"` // For zero-sum: should be 0
 }
@@ -1,30 +1,93 @@
 package domain
 
 import (
+	"strings"
 	"time"
 )
 
-// BudgetRule maps keywords to budget categories for auto-categorization
+// BudgetRule maps transactions to budget categories for auto-categorization.
+// A rule matches when its conditions hold, combined by Operator.
 type BudgetRule struct {
-	ID        int64     `json:"id"`
-	BudgetID  int64     `json:"budget_id"`
-	Keywords  string    `json:"keywords"` // Comma-separated keywords
-	Priority  int       `json:"priority"` // Higher priority rules match first
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64           `json:"id"`
+	BudgetID   int64           `json:"budget_id"`
+	Keywords   string          `json:"keywords"` // Comma-separated text values of the conditions
+	Operator   RuleOperator    `json:"operator"`
+	Conditions []RuleCondition `json:"conditions"`
+	Priority   int             `json:"priority"` // Higher priority rules match first
+	IsActive   bool            `json:"is_active"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+
+	// Times the rule categorized a transaction, see BudgetRuleService.RecordHit
+	HitCount      int        `json:"hit_count"`
+	LastMatchedAt *time.Time `json:"last_matched_at,omitempty"`
+}
+
+// RuleOperator combines the conditions of a rule or group
+type RuleOperator string
+
+const (
+	RuleAnd RuleOperator = "and" // Every condition must hold
+	RuleOr  RuleOperator = "or"  // One condition is enough
+)
+
+// RuleConditionType is what a rule condition tests
+type RuleConditionType string
+
+const (
+	ConditionContains   RuleConditionType = "contains"     // Description contains Value
+	ConditionEquals     RuleConditionType = "equals"       // Description is Value
+	ConditionStartsWith RuleConditionType = "starts_with"  // Description starts with Value
+	ConditionRegex      RuleConditionType = "regex"        // Description matches the regular expression Value
+	ConditionAmount     RuleConditionType = "amount"       // Min <= amount < Max; either bound may be omitted
+	ConditionPocket     RuleConditionType = "pocket"       // The transaction comes from pocket PocketID
+	ConditionWeekday    RuleConditionType = "weekday"      // Dated on one of Days, 0 being Sunday
+	ConditionDayOfMonth RuleConditionType = "day_of_month" // Dated on one of Days, from 1 to 31
+	ConditionAnd        RuleConditionType = "and"          // Every one of Conditions holds
+	ConditionOr         RuleConditionType = "or"           // One of Conditions holds
+)
+
+// RuleCondition is one test of a budget rule, or a group of them. Text is
+// compared case-insensitively.
+type RuleCondition struct {
+	Type       RuleConditionType `json:"type"`
+	Value      string            `json:"value,omitempty"`
+	Min        *float64          `json:"min,omitempty"`
+	Max        *float64          `json:"max,omitempty"`
+	PocketID   *int64            `json:"pocket_id,omitempty"`
+	Days       []int             `json:"days,omitempty"`
+	Conditions []RuleCondition   `json:"conditions,omitempty"`
+	Pocket     string            `json:"pocket,omitempty"` // Pocket name for PocketID, in rule packs only
 }
 
+// KeywordConditions turns comma-separated keywords into "contains"
+// conditions, to be combined with "or"
+func KeywordConditions(keywords string) []RuleCondition {
+	var conditions []RuleCondition
+	for _, keyword := range strings.Split(keywords, ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			conditions = append(conditions, RuleCondition{Type: ConditionContains, Value: keyword})
+		}
+	}
+	return conditions
+}
+
+// CreateBudgetRuleRequest takes either Keywords, matched when the description
+// contains any of them, or Conditions
 type CreateBudgetRuleRequest struct {
-	BudgetID int64  `json:"budget_id"`
-	Keywords string `json:"keywords"`
-	Priority int    `json:"priority"`
+	BudgetID   int64           `json:"budget_id"`
+	Keywords   string          `json:"keywords,omitempty"` // Comma-separated
+	Operator   RuleOperator    `json:"operator,omitempty"` // Defaults to "and"
+	Conditions []RuleCondition `json:"conditions,omitempty"`
+	Priority   int             `json:"priority"`
 }
 
 type UpdateBudgetRuleRequest struct {
-	Keywords *string `json:"keywords,omitempty"`
-	Priority *int    `json:"priority,omitempty"`
-	IsActive *bool   `json:"is_active,omitempty"`
+	Keywords   *string         `json:"keywords,omitempty"` // Replaces the conditions
+	Operator   *RuleOperator   `json:"operator,omitempty"`
+	Conditions []RuleCondition `json:"conditions,omitempty"` // Replaces all conditions when set
+	Priority   *int            `json:"priority,omitempty"`
+	IsActive   *bool           `json:"is_active,omitempty"`
 }
 
 // BudgetRuleWithBudget includes budget name for display
@@ -32,3 +95,228 @@ type BudgetRuleWithBudget struct {
 	BudgetRule
 	BudgetName string `json:"budget_name"`
 }
+
+// RuleTransaction is what budget rules are tested against. Conditions on an
+// attribute that is not known do not hold.
+type RuleTransaction struct {
+	Description string
+	Amount      *float64
+	PocketID    *int64
+	Date        *time.Time
+}
+
+// RuleMatch is the budget a transaction was matched to
+type RuleMatch struct {
+	BudgetID int64  `json:"budget_id"`
+	RuleID   *int64 `json:"rule_id,omitempty"` // Nil when matched through the payee's default category or the classifier
+	// Probability of the classifier's guess; nil for a rule or payee match, which are certain
+	Probability *float64 `json:"probability,omitempty"`
+}
+
+// MatchTransactionRequest is one transaction to test against the budget rules
+type MatchTransactionRequest struct {
+	Description string   `json:"description"`
+	Amount      *float64 `json:"amount,omitempty"`
+	PocketID    *int64   `json:"pocket_id,omitempty"`
+	Date        string   `json:"date,omitempty"` // Format: "2006-01-02"
+}
+
+type BatchMatchRequest struct {
+	Transactions []MatchTransactionRequest `json:"transactions"`
+}
+
+// RuleCandidate is an active rule that matches a transaction
+type RuleCandidate struct {
+	RuleID     int64           `json:"rule_id"`
+	BudgetID   int64           `json:"budget_id"`
+	BudgetName string          `json:"budget_name"`
+	Priority   int             `json:"priority"`
+	Matched    []RuleCondition `json:"matched"` // The conditions that held, e.g. the keyword found
+}
+
+// RuleExplanation tells which budget a transaction matches and why
+type RuleExplanation struct {
+	Description string          `json:"description"`
+	BudgetID    *int64          `json:"budget_id"`
+	Matched     bool            `json:"matched"`
+	Rule        *RuleCandidate  `json:"rule,omitempty"`  // The winning rule
+	Payee       *Payee          `json:"payee,omitempty"` // Whose default category matched, when no rule did
+	Candidates  []RuleCandidate `json:"candidates"`      // Every matching rule in evaluation order, the winner first
+	// The classifier's guess, when neither a rule nor the payee matched
+	Prediction *ClassifierPrediction `json:"prediction,omitempty"`
+}
+
+// ApplyRulesRequest re-categorizes existing expenses through the active rules.
+// The scope narrows which expenses are considered; every bound is optional.
+type ApplyRulesRequest struct {
+	StartDate     string `json:"start_date,omitempty"` // Format: "2006-01-02"
+	EndDate       string `json:"end_date,omitempty"`
+	BudgetID      *int64 `json:"budget_id,omitempty"`     // Only expenses currently in this budget
+	Uncategorized bool   `json:"uncategorized,omitempty"` // Only imported expenses neither a rule nor the user categorized
+	DryRun        bool   `json:"dry_run,omitempty"`       // Preview the moves without making them
+}
+
+// MoveStatus tells whether an expense was moved to the budget its rule picks
+type MoveStatus string
+
+const (
+	MovePlanned MoveStatus = "planned" // Would be moved; dry run only
+	MoveDone    MoveStatus = "moved"
+	MoveFailed  MoveStatus = "failed" // Kept in place, see Error
+)
+
+// ExpenseMove is one expense a rule assigns to another budget
+type ExpenseMove struct {
+	ExpenseID    int64      `json:"expense_id"`
+	Description  string     `json:"description"`
+	Amount       float64    `json:"amount"`
+	Date         time.Time  `json:"date"`
+	FromBudgetID int64      `json:"from_budget_id"`
+	ToBudgetID   int64      `json:"to_budget_id"`
+	RuleID       *int64     `json:"rule_id,omitempty"` // Nil when matched through the payee's default category
+	Status       MoveStatus `json:"status"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// RuleApplication reports the outcome of applying the rules to existing expenses
+type RuleApplication struct {
+	DryRun    bool          `json:"dry_run"`
+	Scanned   int           `json:"scanned"`   // Expenses in scope
+	Unchanged int           `json:"unchanged"` // Already in their rule's budget, or matched by no rule
+	Skipped   int           `json:"skipped"`   // Refunds and split expenses, which rules do not move
+	Moved     int           `json:"moved"`     // Or would be, on a dry run
+	Failed    int           `json:"failed"`
+	Moves     []ExpenseMove `json:"moves"`
+}
+
+// SimulateRulesRequest tries changes to the rules against existing expenses
+// without making them. The scope narrows the expenses as in ApplyRulesRequest.
+type SimulateRulesRequest struct {
+	StartDate     string `json:"start_date,omitempty"` // Format: "2006-01-02"
+	EndDate       string `json:"end_date,omitempty"`
+	BudgetID      *int64 `json:"budget_id,omitempty"`
+	Uncategorized bool   `json:"uncategorized,omitempty"`
+
+	Add    []CreateBudgetRuleRequest `json:"add,omitempty"` // Numbered -1, -2... in the results
+	Update []SimulatedRuleUpdate     `json:"update,omitempty"`
+	Delete []int64                   `json:"delete,omitempty"`
+}
+
+// SimulatedRuleUpdate changes an existing rule in a simulation
+type SimulatedRuleUpdate struct {
+	ID int64 `json:"id"`
+	UpdateBudgetRuleRequest
+}
+
+// SimulatedChange is an expense the changed rules would move out of the budget
+// it is in
+type SimulatedChange struct {
+	ExpenseID       int64     `json:"expense_id"`
+	Description     string    `json:"description"`
+	Amount          float64   `json:"amount"`
+	Date            time.Time `json:"date"`
+	FromBudgetID    int64     `json:"from_budget_id"` // Where the expense is now
+	ToBudgetID      int64     `json:"to_budget_id"`   // Where the changed rules would move it
+	ToRuleID        *int64    `json:"to_rule_id,omitempty"`
+	CurrentBudgetID int64     `json:"current_budget_id"` // Where the current rules put it
+	CurrentRuleID   *int64    `json:"current_rule_id,omitempty"`
+}
+
+// BudgetShift is how the changed rules would move money in or out of an envelope
+type BudgetShift struct {
+	BudgetID   int64   `json:"budget_id"`
+	BudgetName string  `json:"budget_name"`
+	Period     string  `json:"period"`
+	In         float64 `json:"in"`  // Expenses moving in
+	Out        float64 `json:"out"` // Expenses moving out
+	Net        float64 `json:"net"` // In minus out: the change in spending
+}
+
+// RuleSimulation is what applying changed rules would do to existing expenses
+type RuleSimulation struct {
+	Scanned int               `json:"scanned"` // Expenses in scope
+	Skipped int               `json:"skipped"` // Refunds and split expenses, which rules do not move
+	Changed int               `json:"changed"`
+	Changes []SimulatedChange `json:"changes"`
+	Shifts  []BudgetShift     `json:"shifts"` // By budget, for every budget affected
+}
+
+// RuleSuggestion proposes a rule for a description keyword that expenses
+// charged by hand keep landing in one budget with
+type RuleSuggestion struct {
+	Keyword     string   `json:"keyword"`
+	BudgetID    int64    `json:"budget_id"` // Budget of the latest such expense
+	BudgetName  string   `json:"budget_name"`
+	Support     int      `json:"support"`     // Expenses with the keyword in a budget of that name
+	Occurrences int      `json:"occurrences"` // Expenses with the keyword in any budget
+	Confidence  float64  `json:"confidence"`  // Support over occurrences
+	Examples    []string `json:"examples"`    // A few of the supporting descriptions
+}
+
+// RuleSuggestionFilter sets how strong a pattern must be to be suggested
+type RuleSuggestionFilter struct {
+	MinSupport    int     // Defaults to 3
+	MinConfidence float64 // Defaults to 0.8
+	Limit         int
+}
+
+// AcceptRuleSuggestionRequest creates the rule a suggestion proposes
+type AcceptRuleSuggestionRequest struct {
+	Keyword  string `json:"keyword"`
+	BudgetID *int64 `json:"budget_id,omitempty"` // Defaults to the suggested budget
+	Priority int    `json:"priority"`
+}
+
+// RuleRef identifies a rule in an analysis
+type RuleRef struct {
+	RuleID     int64  `json:"rule_id"`
+	BudgetID   int64  `json:"budget_id"`
+	BudgetName string `json:"budget_name"`
+	Priority   int    `json:"priority"`
+}
+
+// RuleUsage is a rule with how often it categorized transactions
+type RuleUsage struct {
+	RuleRef
+	Period        string     `json:"period"` // Period of the rule's budget
+	Keywords      string     `json:"keywords"`
+	IsActive      bool       `json:"is_active"`
+	HitCount      int        `json:"hit_count"`
+	LastMatchedAt *time.Time `json:"last_matched_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ShadowedRule is an active rule that never wins: every transaction it matches
+// is matched by rules earlier in evaluation order
+type ShadowedRule struct {
+	RuleUsage
+	ShadowedBy []RuleRef `json:"shadowed_by"`
+	Redundant  bool      `json:"redundant"` // The earlier rules route to the same category anyway
+}
+
+// KeywordOverlap is a description test that active rules of several
+// categories share
+type KeywordOverlap struct {
+	Type  RuleConditionType `json:"type"`
+	Value string            `json:"value"`
+	Rules []RuleRef         `json:"rules"` // In evaluation order; the first one wins
+}
+
+// PastPeriodRule is an active rule charging a budget of a past period
+type PastPeriodRule struct {
+	RuleUsage
+	// This month's budget of the same name, which matches move to; nil when
+	// there is none and matches stay in the old budget
+	CurrentBudgetID *int64 `json:"current_budget_id"`
+}
+
+// RuleAnalysis points out the rules that do not work as their authors likely
+// intended. Only active rules are analysed; Rules lists every rule.
+type RuleAnalysis struct {
+	Period       string           `json:"period"` // The current month
+	Shadowed     []ShadowedRule   `json:"shadowed"`
+	Overlaps     []KeywordOverlap `json:"overlaps"`
+	PastPeriod   []PastPeriodRule `json:"past_period"`
+	NeverMatched []RuleUsage      `json:"never_matched"`
+	Rules        []RuleUsage      `json:"rules"` // In evaluation order
+}
@@ -0,0 +1,24 @@
+package domain
+
+// ClassifierPrediction is the category the classifier finds most likely for a
+// transaction. Categories are budget names, in lower case.
+type ClassifierPrediction struct {
+	Category    string  `json:"category"`
+	Probability float64 `json:"probability"` // From 0 to 1, against the other categories
+}
+
+// ClassifierStats describes what the classifier has learned
+type ClassifierStats struct {
+	Documents  int `json:"documents"` // Expenses learned from
+	Categories int `json:"categories"`
+	Vocabulary int `json:"vocabulary"` // Distinct features seen
+}
+
+// ClassifierModel is the part of the trained classifier needed to classify a
+// set of features
+type ClassifierModel struct {
+	Documents  map[string]int            // Per category
+	Totals     map[string]int            // Features counted per category
+	Counts     map[string]map[string]int // Per feature, then category
+	Vocabulary int
+}
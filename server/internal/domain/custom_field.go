@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"strconv"
+	"time"
+)
+
+// CustomFieldType is the value type of a user-defined expense field
+type CustomFieldType string
+
+const (
+	CustomFieldText    CustomFieldType = "text"
+	CustomFieldNumber  CustomFieldType = "number"
+	CustomFieldDate    CustomFieldType = "date"
+	CustomFieldBoolean CustomFieldType = "boolean"
+)
+
+// CustomField defines a typed field that can be filled in on expenses
+type CustomField struct {
+	ID        int64           `json:"id"`
+	Name      string          `json:"name"`
+	Type      CustomFieldType `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type CreateCustomFieldRequest struct {
+	Name string          `json:"name"`
+	Type CustomFieldType `json:"type"`
+}
+
+type UpdateCustomFieldRequest struct {
+	Name *string `json:"name,omitempty"`
+}
+
+// IsValid reports whether t is a known field type
+func (t CustomFieldType) IsValid() bool {
+	switch t {
+	case CustomFieldText, CustomFieldNumber, CustomFieldDate, CustomFieldBoolean:
+		return true
+	}
+	return false
+}
+
+// Encode validates a decoded JSON value against the field type and returns its stored form
+func (t CustomFieldType) Encode(value any) (string, error) {
+	switch t {
+	case CustomFieldText:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case CustomFieldNumber:
+		if v, ok := value.(float64); ok {
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+	case CustomFieldDate:
+		if v, ok := value.(string); ok {
+			if _, err := time.Parse("2006-01-02", v); err == nil {
+				return v, nil
+			}
+		}
+	case CustomFieldBoolean:
+		if v, ok := value.(bool); ok {
+			return strconv.FormatBool(v), nil
+		}
+	}
+	return "", ErrInvalidInput
+}
+
+// Decode converts a stored value back to its JSON representation
+func (t CustomFieldType) Decode(stored string) any {
+	switch t {
+	case CustomFieldNumber:
+		if v, err := strconv.ParseFloat(stored, 64); err == nil {
+			return v
+		}
+	case CustomFieldBoolean:
+		if v, err := strconv.ParseBool(stored); err == nil {
+			return v
+		}
+	}
+	return stored
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"time"
+)
+
+// DuplicateMatch is an existing expense that looks like the same transaction
+// as another one: the same amount, a close date and a similar description
+type DuplicateMatch struct {
+	ExpenseID  int64   `json:"expense_id"`
+	Score      float64 `json:"score"`      // From 0 to 1; higher is more likely a duplicate
+	Similarity float64 `json:"similarity"` // Of the descriptions, from 0 to 1
+	DaysApart  int     `json:"days_apart"`
+}
+
+// DuplicatePair is two expenses that probably record the same transaction
+type DuplicatePair struct {
+	Expense    *Expense `json:"expense"`   // The older one, kept by default when merging
+	Duplicate  *Expense `json:"duplicate"` // The newer one
+	Score      float64  `json:"score"`
+	Similarity float64  `json:"similarity"`
+	DaysApart  int      `json:"days_apart"`
+}
+
+// DuplicateFilter narrows a duplicate scan
+type DuplicateFilter struct {
+	StartDate *time.Time
+	EndDate   *time.Time
+	MinScore  *float64 // Defaults to the score at which expenses are flagged on creation
+}
+
+// DuplicateAction resolves a pair of suspected duplicates
+type DuplicateAction string
+
+const (
+	DuplicateMerge   DuplicateAction = "merge"   // Delete the duplicate, folding its notes, payee, tags and attachments into the expense
+	DuplicateDismiss DuplicateAction = "dismiss" // Keep both; the pair is not reported again
+)
+
+type ResolveDuplicateRequest struct {
+	ExpenseID   int64           `json:"expense_id"` // Kept when merging
+	DuplicateID int64           `json:"duplicate_id"`
+	Action      DuplicateAction `json:"action"`
+}
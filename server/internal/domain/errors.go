@@ -9,8 +9,29 @@ var (
 	ErrDuplicateEntry     = errors.New("duplicate entry")
 	ErrPocketHasBudgets   = errors.New("pocket has associated budgets")
 	ErrBudgetHasExpenses  = errors.New("budget has associated expenses")
+	ErrExpenseHasRefunds  = errors.New("expense has associated refunds")
+	ErrRefundExceedsSpent = errors.New("refund exceeds the amount spent")
+	ErrQuotaExceeded      = errors.New("storage quota exceeded")
+	ErrFileTooLarge       = errors.New("file too large")
+	ErrUnsupportedMedia   = errors.New("unsupported media type")
 	ErrEmailAlreadyExists = errors.New("email already exists")
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUnauthorized       = errors.New("unauthorized")
 	ErrInvalidToken       = errors.New("invalid or expired token")
+	// The server could not choose a budget for an expense; see CategorizationError
+	ErrNeedsCategorization = errors.New("expense needs categorization")
 )
+
+// CategorizationError is ErrNeedsCategorization with the budgets the expense
+// could be charged to
+type CategorizationError struct {
+	Candidates []BudgetCandidate
+}
+
+func (e *CategorizationError) Error() string {
+	return ErrNeedsCategorization.Error()
+}
+
+func (e *CategorizationError) Unwrap() error {
+	return ErrNeedsCategorization
+}
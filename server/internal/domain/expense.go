@@ -4,34 +4,165 @@ import (
 	"time"
 )
 
-// Expense represents a spending transaction against a budget envelope
+// ExpenseType distinguishes spending from money returned to an envelope
+type ExpenseType string
+
+const (
+	ExpenseTypeExpense ExpenseType = "expense"
+	ExpenseTypeRefund  ExpenseType = "refund"
+)
+
+// Expense represents a spending transaction against a budget envelope.
+// A refund is stored with a positive amount and credits its envelope.
 type Expense struct {
-	ID          int64     `json:"id"`
-	BudgetID    int64     `json:"budget_id"`
-	Amount      float64   `json:"amount"`
-	Description string    `json:"description"`
-	Date        time.Time `json:"date"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           int64          `json:"id"`
+	BudgetID     int64          `json:"budget_id"` // For split expenses, the budget of the first line
+	Type         ExpenseType    `json:"type"`
+	RefundOfID   *int64         `json:"refund_of_id,omitempty"` // Original expense of a linked refund
+	PayeeID      *int64         `json:"payee_id,omitempty"`
+	Amount       float64        `json:"amount"`
+	Description  string         `json:"description"`
+	Notes        string         `json:"notes,omitempty"`
+	Date         time.Time      `json:"date"`
+	Splits       []ExpenseSplit `json:"splits,omitempty"` // Empty for single-budget expenses
+	Tags         []string       `json:"tags,omitempty"`
+	CustomFields map[string]any `json:"custom_fields,omitempty"` // Keyed by custom field name
+	// Expenses this one probably repeats; only reported on creation
+	PossibleDuplicates []DuplicateMatch `json:"possible_duplicates,omitempty"`
+	CreatedAt          time.Time        `json:"created_at"`
+	UpdatedAt          time.Time        `json:"updated_at"`
+
+	// How the budget was chosen when created without one; only reported on creation
+	Categorization *ExpenseCategorization `json:"categorization,omitempty"`
+	// What chose the budget when the user did not; cleared when the budget is changed
+	CategorizedBy CategorizationMethod `json:"categorized_by,omitempty"`
 }
 
-type CreateExpenseRequest struct {
+// ExpenseSplit is one line of a split expense, charged to its own budget envelope
+type ExpenseSplit struct {
+	ID          int64   `json:"id"`
+	ExpenseID   int64   `json:"expense_id"`
 	BudgetID    int64   `json:"budget_id"`
 	Amount      float64 `json:"amount"`
-	Description string  `json:"description"`
-	Date        string  `json:"date"` // Format: "2006-01-02"
+	Description string  `json:"description,omitempty"`
+}
+
+// IsSplit reports whether the expense is spread over several lines
+func (e *Expense) IsSplit() bool {
+	return len(e.Splits) > 0
+}
+
+// IsRefund reports whether the transaction credits its envelope
+func (e *Expense) IsRefund() bool {
+	return e.Type == ExpenseTypeRefund
+}
+
+// Allocations returns the amount charged to each budget envelope.
+// Refunds yield negative amounts since they reduce spending.
+func (e *Expense) Allocations() map[int64]float64 {
+	sign := 1.0
+	if e.IsRefund() {
+		sign = -1
+	}
+
+	allocations := make(map[int64]float64)
+	if !e.IsSplit() {
+		allocations[e.BudgetID] = sign * e.Amount
+		return allocations
+	}
+	for _, split := range e.Splits {
+		allocations[split.BudgetID] += sign * split.Amount
+	}
+	return allocations
+}
+
+// CategorizationMethod is what chose the budget of an expense created without
+// one, or suggested the budget of an imported line
+type CategorizationMethod string
+
+const (
+	CategorizedByRule       CategorizationMethod = "rule"
+	CategorizedByPayee      CategorizationMethod = "payee"      // The payee's default category
+	CategorizedByClassifier CategorizationMethod = "classifier" // Learned from past expenses
+	CategorizedByDefault    CategorizationMethod = "default"    // Nothing matched; the import's default budget
+)
+
+// Learnable reports whether a budget chosen this way tells the classifier
+// something: its own guesses and fallbacks to a default budget do not
+func (m CategorizationMethod) Learnable() bool {
+	return m != CategorizedByClassifier && m != CategorizedByDefault
+}
+
+// ExpenseCategorization explains the budget chosen for an expense
+type ExpenseCategorization struct {
+	Method      CategorizationMethod `json:"method"`
+	RuleID      *int64               `json:"rule_id,omitempty"`
+	Probability *float64             `json:"probability,omitempty"` // Of the classifier's guess
+}
+
+// BudgetCandidate is a budget an uncategorized expense could be charged to
+type BudgetCandidate struct {
+	BudgetID    int64    `json:"budget_id"`
+	Name        string   `json:"name"`
+	PocketID    int64    `json:"pocket_id"`
+	Remaining   float64  `json:"remaining"`
+	Probability *float64 `json:"probability,omitempty"` // The classifier's, for the budget it guessed
+}
+
+type CreateExpenseRequest struct {
+	BudgetID     int64                 `json:"budget_id,omitempty"` // Defaults to the original's budget for linked refunds, else chosen by the rules
+	Type         ExpenseType           `json:"type,omitempty"`      // Defaults to "expense"
+	RefundOfID   *int64                `json:"refund_of_id,omitempty"`
+	PayeeID      *int64                `json:"payee_id,omitempty"` // Resolved from the description when omitted
+	Amount       float64               `json:"amount"`
+	Description  string                `json:"description"`
+	Notes        string                `json:"notes,omitempty"`
+	Date         string                `json:"date"`             // Format: "2006-01-02"
+	Splits       []ExpenseSplitRequest `json:"splits,omitempty"` // When set, BudgetID is ignored
+	Tags         []string              `json:"tags,omitempty"`   // Unknown tags are created
+	CustomFields map[string]any        `json:"custom_fields,omitempty"`
+	// What chose BudgetID, for expenses created from imported lines
+	CategorizedBy CategorizationMethod `json:"-"`
 }
 
 type UpdateExpenseRequest struct {
-	BudgetID    *int64   `json:"budget_id,omitempty"`
-	Amount      *float64 `json:"amount,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	Date        *string  `json:"date,omitempty"`
+	BudgetID     *int64                `json:"budget_id,omitempty"`
+	PayeeID      *int64                `json:"payee_id,omitempty"` // Zero unlinks the payee
+	Amount       *float64              `json:"amount,omitempty"`
+	Description  *string               `json:"description,omitempty"`
+	Notes        *string               `json:"notes,omitempty"`
+	Date         *string               `json:"date,omitempty"`
+	Splits       []ExpenseSplitRequest `json:"splits,omitempty"`        // Replaces all lines; an empty list merges them back into one budget
+	Tags         []string              `json:"tags,omitempty"`          // Replaces all tags when set
+	CustomFields map[string]any        `json:"custom_fields,omitempty"` // Replaces all values when set
+}
+
+type ExpenseSplitRequest struct {
+	BudgetID    int64   `json:"budget_id"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description,omitempty"`
 }
 
 // ExpenseFilter for querying expenses
 type ExpenseFilter struct {
-	BudgetID  *int64
+	BudgetID  *int64 // Also matches split lines charged to the budget
+	PocketID  *int64
+	Period    string // Period of the expense's budgets, e.g. "2024-12"
 	StartDate *time.Time
 	EndDate   *time.Time
+	MinAmount *float64
+	MaxAmount *float64
+	Text      string   // Substring of description or notes; the query when searching
+	Tags      []string // Expenses must carry every tag
+	// Only expenses approved from import lines that neither a budget rule nor
+	// the user categorized, and still in the budget they were imported into
+	Uncategorized bool
+	ListOptions
+}
+
+// ExpenseSearchResult is one ranked search hit
+type ExpenseSearchResult struct {
+	Expense *Expense `json:"expense"`
+	Rank    float64  `json:"rank"`    // Lower is more relevant
+	Snippet string   `json:"snippet"` // Matching text with hits wrapped in <mark></mark>
 }
@@ -0,0 +1,19 @@
+package domain
+
+// ExportFormat is the file format of an export
+type ExportFormat string
+
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportXLSX ExportFormat = "xlsx"
+)
+
+// ExportOptions controls the layout of an exported file. The rows are chosen by
+// the listing filter passed alongside.
+type ExportOptions struct {
+	Format           ExportFormat // Defaults to CSV
+	Columns          []string     // Defaults to every column of the table, in order
+	Delimiter        rune         // CSV only, defaults to ','
+	DecimalSeparator rune         // CSV only, '.' or ','; defaults to '.'
+	BOM              bool         // CSV only, marks the file as UTF-8 for Excel
+}
@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"time"
+)
+
+// ImportStatus tells a live import batch from one that was rolled back
+type ImportStatus string
+
+const (
+	ImportStaged     ImportStatus = "staged"      // Lines can be reviewed and approved
+	ImportRolledBack ImportStatus = "rolled_back" // Its expenses were deleted; read-only
+)
+
+// ImportItemStatus records where one line of an imported statement stands
+type ImportItemStatus string
+
+const (
+	ImportItemPending    ImportItemStatus = "pending"     // Awaiting review
+	ImportItemImported   ImportItemStatus = "imported"    // Approved and recorded as an expense
+	ImportItemIgnored    ImportItemStatus = "ignored"     // Dismissed by the user
+	ImportItemDuplicate  ImportItemStatus = "duplicate"   // Staged before from another statement
+	ImportItemSkipped    ImportItemStatus = "skipped"     // Money arriving, which is not an expense
+	ImportItemRolledBack ImportItemStatus = "rolled_back" // Discarded with its batch
+)
+
+// Import is one uploaded bank statement, staged for review, and the tally of its lines
+type Import struct {
+	ID            int64        `json:"id"`
+	UserID        int64        `json:"user_id"`
+	Bank          string       `json:"bank"`
+	FileName      string       `json:"file_name"`
+	Status        ImportStatus `json:"status"`
+	DryRun        bool         `json:"dry_run,omitempty"` // Nothing was stored
+	Total         int          `json:"total"`
+	Pending       int          `json:"pending"`
+	Uncategorized int          `json:"uncategorized"` // Pending lines without a budget yet
+	Imported      int          `json:"imported"`
+	Ignored       int          `json:"ignored"`
+	Duplicates    int          `json:"duplicates"`
+	Skipped       int          `json:"skipped"`
+	Items         []ImportItem `json:"items,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// Count tallies an item under its status
+func (i *Import) Count(item *ImportItem) {
+	i.Total++
+	switch item.Status {
+	case ImportItemPending:
+		i.Pending++
+		if !item.Categorized() {
+			i.Uncategorized++
+		}
+	case ImportItemImported:
+		i.Imported++
+	case ImportItemIgnored:
+		i.Ignored++
+	case ImportItemDuplicate:
+		i.Duplicates++
+	case ImportItemSkipped:
+		i.Skipped++
+	}
+}
+
+// ImportItem is one transaction line of an imported statement
+type ImportItem struct {
+	ID          int64            `json:"id"`
+	ImportID    int64            `json:"import_id"`
+	Line        int              `json:"line"` // Position among the statement's transactions, from 1
+	Date        string           `json:"date"` // Format: "2006-01-02"
+	Description string           `json:"description"`
+	Amount      float64          `json:"amount"`
+	Direction   string           `json:"direction"` // "debit" or "credit"
+	Reference   string           `json:"reference,omitempty"`
+	Account     string           `json:"account,omitempty"` // Account of multi-account files such as OFX
+	Fingerprint string           `json:"-"`                 // Identifies the transaction across overlapping statements
+	Status      ImportItemStatus `json:"status"`
+	BudgetID    *int64           `json:"budget_id,omitempty"` // Suggested by the rules until recategorized
+	RuleID      *int64           `json:"rule_id,omitempty"`   // Budget rule behind the suggestion
+	// How sure the suggestion is: 1 from a rule or payee, the classifier's
+	// probability when it guessed, nil for the default budget or a manual choice
+	Confidence *float64              `json:"confidence,omitempty"`
+	Splits     []ExpenseSplitRequest `json:"splits,omitempty"` // When set, BudgetID is ignored
+	Manual     bool                  `json:"manual,omitempty"` // Set once the budget or splits were chosen by hand
+	// What suggested the budget; empty when nothing did or it was chosen by hand
+	CategorizedBy CategorizationMethod `json:"categorized_by,omitempty"`
+	// Existing expense the line probably repeats, e.g. one entered by hand
+	DuplicateOfID *int64 `json:"duplicate_of_id,omitempty"`
+	ExpenseID     *int64 `json:"expense_id,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
+
+// Categorized reports whether the item names the budgets it would be charged to
+func (i *ImportItem) Categorized() bool {
+	return i.BudgetID != nil || len(i.Splits) > 0
+}
+
+// ImportRequest describes an uploaded statement
+type ImportRequest struct {
+	Bank            string // Parser key; detected from the contents when empty
+	FileName        string
+	DefaultBudgetID *int64 // Suggested for debits no rule matches
+	DryRun          bool   // Report what would be staged without storing anything
+	// Approve lines whose suggestion has at least this confidence, from 0 (never) to 1
+	AutoApprove float64
+}
+
+// UpdateImportItemRequest reviews a pending item
+type UpdateImportItemRequest struct {
+	BudgetID    *int64                `json:"budget_id,omitempty"`
+	Description *string               `json:"description,omitempty"`
+	Splits      []ExpenseSplitRequest `json:"splits,omitempty"`  // Replaces all lines; an empty list removes them
+	Ignored     *bool                 `json:"ignored,omitempty"` // False returns an ignored item to pending
+}
+
+// ImportAction is a bulk operation on import items
+type ImportAction string
+
+const (
+	ImportApprove    ImportAction = "approve"
+	ImportIgnore     ImportAction = "ignore"
+	ImportRestore    ImportAction = "restore"    // Return ignored items to pending
+	ImportCategorize ImportAction = "categorize" // Set BudgetID on every item
+)
+
+// BulkImportItemsRequest applies an action to items of one import. Without
+// ItemIDs it applies to every pending item, or when approving to every
+// categorized pending item that does not look like a duplicate, and to every
+// ignored item when restoring.
+type BulkImportItemsRequest struct {
+	Action   ImportAction `json:"action"`
+	ItemIDs  []int64      `json:"item_ids,omitempty"`
+	BudgetID int64        `json:"budget_id,omitempty"` // For "categorize"
+}
+
+// ImportItemFilter narrows the items of an import
+type ImportItemFilter struct {
+	Status ImportItemStatus
+}
+
+// ImportAccount maps an account found in imported statements to a pocket, so
+// that its debits are only charged to the budgets of that pocket
+type ImportAccount struct {
+	ID        int64     `json:"id"`
+	Bank      string    `json:"bank"`    // Parser key, e.g. "ofx"
+	Account   string    `json:"account"` // As reported on import lines
+	PocketID  int64     `json:"pocket_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SetImportAccountRequest struct {
+	Bank     string `json:"bank"`
+	Account  string `json:"account"`
+	PocketID int64  `json:"pocket_id"`
+}
@@ -0,0 +1,46 @@
+package domain
+
+// SortField orders a list by one field
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ListOptions carries the sorting and cursor pagination shared by list endpoints.
+// A zero Limit without a Cursor returns the whole list.
+type ListOptions struct {
+	Sort   []SortField // Ties are broken by ID
+	Limit  int
+	Cursor string // Opaque, taken from Page.NextCursor
+}
+
+// Paginated reports whether the caller asked for a single page
+func (o ListOptions) Paginated() bool {
+	return o.Limit > 0 || o.Cursor != ""
+}
+
+// Page is one page of a list
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// BudgetFilter for querying budgets
+type BudgetFilter struct {
+	PocketID     *int64
+	Period       string
+	MinAllocated *float64
+	MaxAllocated *float64
+	Text         string // Substring of name or description
+	ListOptions
+}
+
+// BudgetRuleFilter for querying budget rules
+type BudgetRuleFilter struct {
+	BudgetID *int64
+	PocketID *int64
+	Period   string // Period of the rule's budget
+	IsActive *bool
+	Text     string // Substring of keywords or budget name
+	ListOptions
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"time"
+)
+
+// Payee is the canonical merchant or counterparty behind expense descriptions
+type Payee struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	DefaultCategory string    `json:"default_category,omitempty"` // Budget name used when auto-categorizing
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type CreatePayeeRequest struct {
+	Name            string `json:"name"`
+	DefaultCategory string `json:"default_category,omitempty"`
+}
+
+type UpdatePayeeRequest struct {
+	Name            *string `json:"name,omitempty"`
+	DefaultCategory *string `json:"default_category,omitempty"`
+}
+
+// MergePayeesRequest folds the source payees, their expenses and rules into the target
+type MergePayeesRequest struct {
+	SourceIDs []int64 `json:"source_ids"`
+}
+
+// PayeeRuleMatchType selects how a payee rule pattern is compared with a normalized description
+type PayeeRuleMatchType string
+
+const (
+	PayeeMatchContains PayeeRuleMatchType = "contains"
+	PayeeMatchPrefix   PayeeRuleMatchType = "prefix"
+	PayeeMatchExact    PayeeRuleMatchType = "exact"
+	PayeeMatchRegex    PayeeRuleMatchType = "regex"
+)
+
+// PayeeRule rewrites descriptions matching a pattern to a canonical payee
+type PayeeRule struct {
+	ID        int64              `json:"id"`
+	PayeeID   int64              `json:"payee_id"`
+	MatchType PayeeRuleMatchType `json:"match_type"`
+	Pattern   string             `json:"pattern"`
+	Priority  int                `json:"priority"` // Higher priority rules match first
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+type CreatePayeeRuleRequest struct {
+	MatchType PayeeRuleMatchType `json:"match_type"` // Defaults to "contains"
+	Pattern   string             `json:"pattern"`
+	Priority  int                `json:"priority"`
+}
+
+// PayeeMatch explains how a raw description was mapped to a payee
+type PayeeMatch struct {
+	Description string `json:"description"`
+	Normalized  string `json:"normalized"`
+	Payee       *Payee `json:"payee"`
+	RuleID      *int64 `json:"rule_id,omitempty"` // Nil when matched by payee name
+}
+
+// PayeeStats summarizes the spending history with a payee
+type PayeeStats struct {
+	PayeeID       int64              `json:"payee_id"`
+	Name          string             `json:"name"`
+	ExpenseCount  int                `json:"expense_count"`
+	TotalSpent    float64            `json:"total_spent"`
+	TotalRefunds  float64            `json:"total_refunds"`
+	AverageAmount float64            `json:"average_amount"`
+	FirstDate     string             `json:"first_date,omitempty"`
+	LastDate      string             `json:"last_date,omitempty"`
+	Monthly       []PayeeMonthlyStat `json:"monthly"`
+}
+
+type PayeeMonthlyStat struct {
+	Month        string  `json:"month"` // e.g., "2024-12"
+	ExpenseCount int     `json:"expense_count"`
+	TotalSpent   float64 `json:"total_spent"`
+}
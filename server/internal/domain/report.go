@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"time"
+)
+
+// ReportFilter narrows the expenses a report covers. Totals are net of refunds,
+// with the spending before refunds and the refunds reported beside them, and
+// split expenses count towards the budget of each line.
+type ReportFilter struct {
+	StartDate time.Time
+	EndDate   time.Time
+	PocketID  *int64
+}
+
+// SeriesGranularity is the bucket size of a spending series
+type SeriesGranularity string
+
+const (
+	GranularityDay   SeriesGranularity = "day"
+	GranularityWeek  SeriesGranularity = "week" // Weeks start on Monday
+	GranularityMonth SeriesGranularity = "month"
+)
+
+// CategoryReport splits spending in a date range by category, i.e. budget name
+type CategoryReport struct {
+	StartDate    string          `json:"start_date"`
+	EndDate      string          `json:"end_date"`
+	Total        float64         `json:"total"` // Net of refunds
+	GrossSpent   float64         `json:"gross_spent"`
+	TotalRefunds float64         `json:"total_refunds"`
+	Categories   []CategoryTotal `json:"categories"` // Largest first
+}
+
+type CategoryTotal struct {
+	Category     string  `json:"category"`
+	Total        float64 `json:"total"` // Net of refunds
+	GrossSpent   float64 `json:"gross_spent"`
+	TotalRefunds float64 `json:"total_refunds"`
+	ExpenseCount int     `json:"expense_count"`
+	Share        float64 `json:"share"` // Fraction of the report total, 0..1
+}
+
+// CategoryMonthTotal is the spending of one category in one month
+type CategoryMonthTotal struct {
+	Category     string
+	Month        string
+	Total        float64 // Net of refunds
+	GrossSpent   float64
+	TotalRefunds float64
+}
+
+// TrendReport holds one series per category over consecutive months,
+// with every series aligned to Periods
+type TrendReport struct {
+	Periods      []string      `json:"periods"` // e.g., ["2024-11", "2024-12"]
+	Totals       []float64     `json:"totals"`  // All categories per period, net of refunds
+	GrossTotals  []float64     `json:"gross_totals"`
+	RefundTotals []float64     `json:"refund_totals"`
+	Series       []TrendSeries `json:"series"`
+}
+
+type TrendSeries struct {
+	Category string     `json:"category"`
+	Values   []float64  `json:"values"` // Net of refunds
+	Gross    []float64  `json:"gross"`
+	Refunds  []float64  `json:"refunds"`
+	Changes  []*float64 `json:"changes"` // Percent change of the net value from the previous month, null when undefined
+}
+
+// VarianceReport compares allocations with actual spending for a period
+type VarianceReport struct {
+	Period         string           `json:"period"`
+	TotalAllocated float64          `json:"total_allocated"`
+	TotalSpent     float64          `json:"total_spent"`
+	TotalVariance  float64          `json:"total_variance"`
+	Budgets        []BudgetVariance `json:"budgets"`
+}
+
+type BudgetVariance struct {
+	BudgetID        int64   `json:"budget_id"`
+	Name            string  `json:"name"`
+	PocketID        int64   `json:"pocket_id"`
+	AllocatedAmount float64 `json:"allocated_amount"`
+	SpentAmount     float64 `json:"spent_amount"`
+	Variance        float64 `json:"variance"`     // Allocated minus spent; negative when overspent
+	PercentUsed     float64 `json:"percent_used"` // Zero for empty envelopes
+}
+
+// PayeeTotal is the spending with one payee in a date range
+type PayeeTotal struct {
+	PayeeID      int64   `json:"payee_id"`
+	Name         string  `json:"name"`
+	Total        float64 `json:"total"` // Net of refunds
+	GrossSpent   float64 `json:"gross_spent"`
+	TotalRefunds float64 `json:"total_refunds"`
+	ExpenseCount int     `json:"expense_count"`
+}
+
+// SeriesReport is a gap-free spending series for charts
+type SeriesReport struct {
+	Granularity  SeriesGranularity `json:"granularity"`
+	Total        float64           `json:"total"` // Net of refunds
+	GrossSpent   float64           `json:"gross_spent"`
+	TotalRefunds float64           `json:"total_refunds"`
+	Points       []SeriesPoint     `json:"points"`
+}
+
+type SeriesPoint struct {
+	Date         string  `json:"date"`  // First day of the bucket
+	Total        float64 `json:"total"` // Net of refunds
+	GrossSpent   float64 `json:"gross_spent"`
+	TotalRefunds float64 `json:"total_refunds"`
+	ExpenseCount int     `json:"expense_count"`
+}
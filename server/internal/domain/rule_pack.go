@@ -0,0 +1,83 @@
+package domain
+
+// RulePackVersion is the version of the rule pack format written by export
+const RulePackVersion = 1
+
+// RulePack is a portable set of budget rules. Rules name their category, the
+// budget name, instead of a budget ID, and pocket conditions name their
+// pocket, so a pack exported from one database imports into another.
+type RulePack struct {
+	Version     int        `json:"version"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Rules       []PackRule `json:"rules"`
+}
+
+// PackRule is a budget rule of a pack. Like CreateBudgetRuleRequest it takes
+// either Keywords or Conditions.
+type PackRule struct {
+	Category   string          `json:"category"`           // Budget name, matched case-insensitively
+	Keywords   string          `json:"keywords,omitempty"` // Comma-separated
+	Operator   RuleOperator    `json:"operator,omitempty"` // Defaults to "and"
+	Conditions []RuleCondition `json:"conditions,omitempty"`
+	Priority   int             `json:"priority"`
+	IsActive   *bool           `json:"is_active,omitempty"` // Defaults to true
+}
+
+// RulePackMode is how an imported pack combines with the existing rules
+type RulePackMode string
+
+const (
+	PackMerge   RulePackMode = "merge"   // Add the pack's rules to the existing ones
+	PackReplace RulePackMode = "replace" // Delete every existing rule first
+)
+
+// ImportRulePackRequest sets how a pack is imported or a preset installed
+type ImportRulePackRequest struct {
+	Mode   RulePackMode `json:"mode,omitempty"` // Defaults to "merge"
+	DryRun bool         `json:"dry_run,omitempty"`
+	// Budget names to use for the pack's categories, by category, for
+	// categories named differently here
+	Categories map[string]string `json:"categories,omitempty"`
+}
+
+// PackConflictKind is why a rule of a pack conflicts with the rules in place
+type PackConflictKind string
+
+const (
+	ConflictMissingCategory PackConflictKind = "missing_category" // No budget has the category's name; skipped
+	ConflictMissingPocket   PackConflictKind = "missing_pocket"   // No pocket has a condition's pocket name; skipped
+	ConflictInvalid         PackConflictKind = "invalid"          // Bad operator or conditions; skipped
+	ConflictDuplicate       PackConflictKind = "duplicate"        // The same rule exists already; skipped
+	// A keyword of the rule already routes to another category; imported, the
+	// higher priority wins
+	ConflictKeywordOverlap PackConflictKind = "keyword_overlap"
+)
+
+// PackConflict is a rule of a pack that could not be imported as is
+type PackConflict struct {
+	Index    int              `json:"index"` // Position of the rule in the pack, from 0
+	Category string           `json:"category"`
+	Kind     PackConflictKind `json:"kind"`
+	Message  string           `json:"message"`
+	RuleID   *int64           `json:"rule_id,omitempty"` // The existing rule it conflicts with
+}
+
+// RulePackImport reports the outcome of importing a pack
+type RulePackImport struct {
+	Mode      RulePackMode   `json:"mode"`
+	DryRun    bool           `json:"dry_run"`
+	Created   int            `json:"created"` // Or would be, on a dry run
+	Deleted   int            `json:"deleted"` // Existing rules removed by replace
+	Skipped   int            `json:"skipped"`
+	Rules     []BudgetRule   `json:"rules"` // The rules created; without IDs on a dry run
+	Conflicts []PackConflict `json:"conflicts"`
+}
+
+// RulePackPreset is a rule pack shipped with the server
+type RulePackPreset struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Categories  []string `json:"categories"` // The budget names its rules expect
+	Rules       int      `json:"rules"`
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"time"
+)
+
+// Platform is the kind of client a session was opened from
+type Platform string
+
+const (
+	PlatformAndroid Platform = "android"
+	PlatformIOS     Platform = "ios"
+)
+
+// IsValid reports whether p is a known platform; empty means unknown
+func (p Platform) IsValid() bool {
+	switch p {
+	case "", PlatformAndroid, PlatformIOS:
+		return true
+	}
+	return false
+}
+
+// Session is one login of a user, on one device. Its refresh tokens form a
+// family: each refresh uses up the current token and issues the next, and
+// revoking the session ends them all along with its access tokens.
+type Session struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+	// Device the session was opened from, as last seen
+	DeviceName string    `json:"device_name"`
+	Platform   Platform  `json:"platform"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"` // Whether the request listing sessions came from this one
+}
+
+// SessionClient describes the device a request comes from. The name and
+// platform are given by the app at login; the address and user agent are
+// read off each request.
+type SessionClient struct {
+	DeviceName string   `json:"device_name"`
+	Platform   Platform `json:"platform"`
+	IPAddress  string   `json:"-"`
+	UserAgent  string   `json:"-"`
+}
+
+// RefreshToken is a refresh token of a session. Only the hash of the token
+// is stored.
+type RefreshToken struct {
+	ID        int64
+	SessionID int64
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time // Set once exchanged; presenting it again is reuse
+	CreatedAt time.Time
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutResponse reports how many sessions a logout ended
+type LogoutResponse struct {
+	Sessions int64 `json:"sessions"`
+}
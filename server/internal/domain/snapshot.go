@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"time"
+)
+
+// SnapshotReason records why a pocket balance snapshot was taken
+type SnapshotReason string
+
+const (
+	SnapshotChange   SnapshotReason = "change"   // After funds, allocations or expenses changed
+	SnapshotDaily    SnapshotReason = "daily"    // End-of-day point, also when nothing changed
+	SnapshotBackfill SnapshotReason = "backfill" // Reconstructed from earlier records
+)
+
+// PocketSnapshot is the money held by a pocket at one moment. Balance is the
+// unallocated part; Allocated is what remains unspent in the pocket's envelopes.
+type PocketSnapshot struct {
+	ID         int64          `json:"id"`
+	PocketID   int64          `json:"pocket_id"`
+	Date       string         `json:"date"` // Format: "2006-01-02"
+	Balance    float64        `json:"balance"`
+	Allocated  float64        `json:"allocated"`
+	Reason     SnapshotReason `json:"reason"`
+	RecordedAt time.Time      `json:"recorded_at"`
+}
+
+// Total is the money the pocket holds, allocated or not
+func (s *PocketSnapshot) Total() float64 {
+	return s.Balance + s.Allocated
+}
+
+// BalanceHistory is a gap-free series of balances, each point holding the
+// value at the end of its bucket
+type BalanceHistory struct {
+	PocketID    *int64            `json:"pocket_id,omitempty"` // Nil for net worth across pockets
+	Granularity SeriesGranularity `json:"granularity"`
+	Points      []BalancePoint    `json:"points"`
+}
+
+type BalancePoint struct {
+	Date      string  `json:"date"` // First day of the bucket
+	Balance   float64 `json:"balance"`
+	Allocated float64 `json:"allocated"`
+	Total     float64 `json:"total"`
+}
+
+// BackfillResult reports the snapshots reconstructed by a backfill
+type BackfillResult struct {
+	Pockets   int `json:"pockets"`
+	Snapshots int `json:"snapshots"`
+}
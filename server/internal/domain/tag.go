@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// Tag is a free-form label attached to expenses, e.g. "trip-bali" or "reimbursable"
+type Tag struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateTagRequest struct {
+	Name string `json:"name"`
+}
+
+type UpdateTagRequest struct {
+	Name *string `json:"name,omitempty"`
+}
+
+// NormalizeTagName trims and lowercases a tag so "Trip-Bali " and "trip-bali" are the same tag
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// TagReport totals the expenses carrying a tag across envelopes and periods
+type TagReport struct {
+	Tag          string           `json:"tag"`
+	ExpenseCount int              `json:"expense_count"`
+	TotalSpent   float64          `json:"total_spent"` // Net of refunds
+	GrossSpent   float64          `json:"gross_spent"`
+	TotalRefunds float64          `json:"total_refunds"`
+	ByBudget     []TagBudgetTotal `json:"by_budget"`
+	ByPeriod     []TagPeriodTotal `json:"by_period"`
+}
+
+type TagBudgetTotal struct {
+	BudgetID   int64   `json:"budget_id"`
+	BudgetName string  `json:"budget_name"`
+	Period     string  `json:"period"`
+	TotalSpent float64 `json:"total_spent"`
+}
+
+type TagPeriodTotal struct {
+	Period     string  `json:"period"`
+	TotalSpent float64 `json:"total_spent"`
+}
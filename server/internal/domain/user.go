@@ -17,14 +17,20 @@ type RegisterRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Name     string `json:"name"`
+	SessionClient
 }
 
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	SessionClient
 }
 
+// AuthResponse carries a short-lived access token, sent as the bearer token,
+// and the refresh token that gets the next one
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"` // Of the access token
+	RefreshToken string    `json:"refresh_token"`
+	User         User      `json:"user"`
 }
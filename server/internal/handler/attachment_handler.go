@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/middleware"
+	"github.com/suprie/budget-manager/internal/service"
+)
+
+type AttachmentHandler struct {
+	service *service.AttachmentService
+}
+
+func NewAttachmentHandler(service *service.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{service: service}
+}
+
+// Upload stores the "file" part of a multipart/form-data request
+func (h *AttachmentHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, domain.ErrUnauthorized)
+		return
+	}
+
+	expenseID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	// Leave headroom for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxAttachmentSize+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			writeError(w, domain.ErrInvalidInput)
+			return
+		}
+		if err != nil {
+			writeError(w, uploadError(err))
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, service.MaxAttachmentSize+1))
+		if err != nil {
+			writeError(w, uploadError(err))
+			return
+		}
+
+		attachment, err := h.service.Upload(r.Context(), userID, expenseID, part.FileName(), data)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, attachment)
+		return
+	}
+}
+
+func (h *AttachmentHandler) GetByExpenseID(w http.ResponseWriter, r *http.Request) {
+	expenseID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	attachments, err := h.service.GetByExpenseID(r.Context(), expenseID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if attachments == nil {
+		attachments = []*domain.Attachment{}
+	}
+
+	writeJSON(w, http.StatusOK, attachments)
+}
+
+func (h *AttachmentHandler) Download(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, false)
+}
+
+func (h *AttachmentHandler) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, true)
+}
+
+func (h *AttachmentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	expenseID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("attachment_id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), expenseID, id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Message: "Attachment deleted successfully"})
+}
+
+func (h *AttachmentHandler) serve(w http.ResponseWriter, r *http.Request, thumb bool) {
+	expenseID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("attachment_id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	attachment, err := h.service.Get(r.Context(), expenseID, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	body, err := h.service.Open(r.Context(), attachment, thumb)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer body.Close()
+
+	contentType := attachment.ContentType
+	if thumb {
+		contentType = "image/jpeg"
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition",
+		mime.FormatMediaType("inline", map[string]string{"filename": attachment.FileName}))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+// uploadError maps body read failures, turning an oversized body into ErrFileTooLarge
+func uploadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return domain.ErrFileTooLarge
+	}
+	return domain.ErrInvalidInput
+}
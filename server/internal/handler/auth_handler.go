@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/suprie/budget-manager/internal/domain"
 	"github.com/suprie/budget-manager/internal/middleware"
@@ -24,6 +25,9 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	client := middleware.RequestClient(r)
+	req.IPAddress, req.UserAgent = client.IPAddress, client.UserAgent
+
 	resp, err := h.authService.Register(r.Context(), req)
 	if err != nil {
 		writeError(w, err)
@@ -40,6 +44,9 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	client := middleware.RequestClient(r)
+	req.IPAddress, req.UserAgent = client.IPAddress, client.UserAgent
+
 	resp, err := h.authService.Login(r.Context(), req)
 	if err != nil {
 		writeError(w, err)
@@ -64,3 +71,93 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, user)
 }
+
+// Refresh exchanges a refresh token for new tokens
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req domain.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	resp, err := h.authService.Refresh(r.Context(), req.RefreshToken, middleware.RequestClient(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Logout ends the session of the access token used
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := middleware.GetSessionID(r.Context())
+	if !ok {
+		writeError(w, domain.ErrUnauthorized)
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), sessionID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll ends every session of the user, on every device
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, domain.ErrUnauthorized)
+		return
+	}
+
+	sessions, err := h.authService.LogoutAll(r.Context(), userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, domain.LogoutResponse{Sessions: sessions})
+}
+
+// Sessions lists the devices the user is signed in on
+func (h *AuthHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, domain.ErrUnauthorized)
+		return
+	}
+	sessionID, _ := middleware.GetSessionID(r.Context())
+
+	sessions, err := h.authService.Sessions(r.Context(), userID, sessionID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession signs the user out on one device
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, domain.ErrUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	if err := h.authService.RevokeSession(r.Context(), userID, id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
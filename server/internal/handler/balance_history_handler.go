@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/service"
+)
+
+// BalanceHistoryHandler serves pocket balance history. Date ranges default to the current month.
+type BalanceHistoryHandler struct {
+	service *service.BalanceHistoryService
+}
+
+func NewBalanceHistoryHandler(service *service.BalanceHistoryService) *BalanceHistoryHandler {
+	return &BalanceHistoryHandler{service: service}
+}
+
+// PocketHistory handles ?from=&to=&granularity=day|week|month
+func (h *BalanceHistoryHandler) PocketHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	query := r.URL.Query()
+	history, err := h.service.PocketHistory(r.Context(), id, query.Get("from"), query.Get("to"),
+		domain.SeriesGranularity(query.Get("granularity")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// NetWorth handles ?from=&to=&granularity=day|week|month
+func (h *BalanceHistoryHandler) NetWorth(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	history, err := h.service.NetWorth(r.Context(), query.Get("from"), query.Get("to"),
+		domain.SeriesGranularity(query.Get("granularity")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+func (h *BalanceHistoryHandler) Backfill(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.Backfill(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/suprie/budget-manager/internal/domain"
@@ -49,14 +50,45 @@ func (h *BudgetHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, budget)
 }
 
+// GetAll lists budgets, filtered by pocket_id, period, min_allocated,
+// max_allocated and text, with the usual sort, limit and cursor options
 func (h *BudgetHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	budgets, err := h.service.GetAll(r.Context())
+	filter, err := budgetFilter(r.URL.Query())
 	if err != nil {
 		writeError(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, budgets)
+	page, err := h.service.List(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeList(w, filter.ListOptions, page)
+}
+
+// budgetFilter reads the listing filters shared by GET /api/budgets and its export
+func budgetFilter(query url.Values) (domain.BudgetFilter, error) {
+	filter := domain.BudgetFilter{
+		Period: query.Get("period"),
+		Text:   query.Get("text"),
+	}
+
+	var err error
+	if filter.ListOptions, err = listOptions(query); err != nil {
+		return filter, err
+	}
+	if filter.PocketID, err = queryInt64(query, "pocket_id"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.MinAllocated, err = queryFloat(query, "min_allocated"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.MaxAllocated, err = queryFloat(query, "max_allocated"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	return filter, nil
 }
 
 func (h *BudgetHandler) GetByPocketID(w http.ResponseWriter, r *http.Request) {
@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/suprie/budget-manager/internal/domain"
@@ -33,18 +34,45 @@ func (h *BudgetRuleHandler) Create(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, rule)
 }
 
+// GetAll lists rules, filtered by budget_id, pocket_id, period, is_active
+// and text, with the usual sort, limit and cursor options
 func (h *BudgetRuleHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	rules, err := h.ruleService.GetAll(r.Context())
+	filter, err := budgetRuleFilter(r.URL.Query())
 	if err != nil {
 		writeError(w, err)
 		return
 	}
 
-	if rules == nil {
-		rules = []domain.BudgetRuleWithBudget{}
+	page, err := h.ruleService.List(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
-	writeJSON(w, http.StatusOK, rules)
+	writeList(w, filter.ListOptions, page)
+}
+
+// budgetRuleFilter reads the listing filters shared by GET /api/budget-rules and its export
+func budgetRuleFilter(query url.Values) (domain.BudgetRuleFilter, error) {
+	filter := domain.BudgetRuleFilter{
+		Period: query.Get("period"),
+		Text:   query.Get("text"),
+	}
+
+	var err error
+	if filter.ListOptions, err = listOptions(query); err != nil {
+		return filter, err
+	}
+	if filter.BudgetID, err = queryInt64(query, "budget_id"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.PocketID, err = queryInt64(query, "pocket_id"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.IsActive, err = queryBool(query, "is_active"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	return filter, nil
 }
 
 func (h *BudgetRuleHandler) GetByID(w http.ResponseWriter, r *http.Request) {
@@ -124,25 +152,66 @@ func (h *BudgetRuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// MatchTransaction tests which budget a description would match
+// MatchTransaction explains which budget a transaction matches, given by
+// ?description= and optionally ?amount=, ?pocket_id= and ?date=, and counts
+// the hit of the winning rule
 func (h *BudgetRuleHandler) MatchTransaction(w http.ResponseWriter, r *http.Request) {
-	description := r.URL.Query().Get("description")
+	query := r.URL.Query()
+	description := query.Get("description")
 	if description == "" {
 		writeError(w, domain.ErrInvalidInput)
 		return
 	}
 
-	budgetID, err := h.ruleService.MatchTransaction(r.Context(), description)
+	tx := domain.RuleTransaction{Description: description}
+	var err error
+	if tx.Amount, err = queryFloat(query, "amount"); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if tx.PocketID, err = queryInt64(query, "pocket_id"); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if tx.Date, err = queryDate(query, "date"); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	explanation, err := h.ruleService.ExplainMatch(r.Context(), tx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, explanation)
+}
+
+// MatchBatch explains the matches of many transactions at once
+func (h *BudgetRuleHandler) MatchBatch(w http.ResponseWriter, r *http.Request) {
+	var req domain.BatchMatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	explanations, err := h.ruleService.ExplainBatch(r.Context(), req.Transactions)
 	if err != nil {
 		writeError(w, err)
 		return
 	}
 
-	response := map[string]interface{}{
-		"description": description,
-		"budget_id":   budgetID,
-		"matched":     budgetID != nil,
+	writeJSON(w, http.StatusOK, explanations)
+}
+
+// Analysis reports shadowed, overlapping, outdated and unused rules, with the
+// hit counts of every rule
+func (h *BudgetRuleHandler) Analysis(w http.ResponseWriter, r *http.Request) {
+	analysis, err := h.ruleService.Analysis(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
-	writeJSON(w, http.StatusOK, response)
+	writeJSON(w, http.StatusOK, analysis)
 }
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/service"
+)
+
+// CategorizationHandler applies the budget rules to expenses already recorded
+type CategorizationHandler struct {
+	service *service.CategorizationService
+}
+
+func NewCategorizationHandler(service *service.CategorizationService) *CategorizationHandler {
+	return &CategorizationHandler{service: service}
+}
+
+// Apply moves the expenses in scope to the budgets the rules pick, or previews
+// the moves on a dry run
+func (h *CategorizationHandler) Apply(w http.ResponseWriter, r *http.Request) {
+	var req domain.ApplyRulesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	result, err := h.service.Apply(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Suggestions proposes rules learned from manual categorization, filtered by
+// min_support, min_confidence and limit
+func (h *CategorizationHandler) Suggestions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter domain.RuleSuggestionFilter
+	minSupport, err := queryInt64(query, "min_support")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if minSupport != nil {
+		filter.MinSupport = int(*minSupport)
+	}
+	minConfidence, err := queryFloat(query, "min_confidence")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if minConfidence != nil {
+		filter.MinConfidence = *minConfidence
+	}
+	limit, err := queryInt64(query, "limit")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if limit != nil {
+		filter.Limit = int(*limit)
+	}
+
+	suggestions, err := h.service.Suggestions(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, suggestions)
+}
+
+// AcceptSuggestion creates the rule a suggestion proposes
+func (h *CategorizationHandler) AcceptSuggestion(w http.ResponseWriter, r *http.Request) {
+	var req domain.AcceptRuleSuggestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	rule, err := h.service.AcceptSuggestion(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+// ClassifierStats tells how much the classifier has learned
+func (h *CategorizationHandler) ClassifierStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.ClassifierStats(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// TrainClassifier retrains the classifier from scratch
+func (h *CategorizationHandler) TrainClassifier(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.TrainClassifier(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// Simulate reports what changed rules would do to the expenses in scope,
+// without changing anything
+func (h *CategorizationHandler) Simulate(w http.ResponseWriter, r *http.Request) {
+	var req domain.SimulateRulesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	result, err := h.service.Simulate(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/service"
+)
+
+type CustomFieldHandler struct {
+	service *service.CustomFieldService
+}
+
+func NewCustomFieldHandler(service *service.CustomFieldService) *CustomFieldHandler {
+	return &CustomFieldHandler{service: service}
+}
+
+func (h *CustomFieldHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req domain.CreateCustomFieldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	field, err := h.service.Create(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, field)
+}
+
+func (h *CustomFieldHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	field, err := h.service.GetByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, field)
+}
+
+func (h *CustomFieldHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	fields, err := h.service.GetAll(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if fields == nil {
+		fields = []*domain.CustomField{}
+	}
+
+	writeJSON(w, http.StatusOK, fields)
+}
+
+func (h *CustomFieldHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var req domain.UpdateCustomFieldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	field, err := h.service.Update(r.Context(), id, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, field)
+}
+
+func (h *CustomFieldHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Message: "Custom field deleted successfully"})
+}
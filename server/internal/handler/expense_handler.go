@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/suprie/budget-manager/internal/domain"
@@ -49,14 +50,131 @@ func (h *ExpenseHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, expense)
 }
 
+// GetAll lists expenses matching the query filters, see expenseFilter
 func (h *ExpenseHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	expenses, err := h.service.GetAll(r.Context())
+	filter, err := expenseFilter(r.URL.Query())
 	if err != nil {
 		writeError(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, expenses)
+	page, err := h.service.List(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeList(w, filter.ListOptions, page)
+}
+
+// Search ranks expenses matching ?q= with the same filters as GetAll
+func (h *ExpenseHandler) Search(w http.ResponseWriter, r *http.Request) {
+	filter, err := expenseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	filter.Text = r.URL.Query().Get("q")
+
+	results, err := h.service.Search(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if results == nil {
+		results = []domain.ExpenseSearchResult{}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// GetDuplicates lists pairs of expenses that probably record the same
+// transaction, optionally within ?start_date= and ?end_date= and from ?min_score=
+func (h *ExpenseHandler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter domain.DuplicateFilter
+	var err error
+	if filter.StartDate, err = queryDate(query, "start_date"); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if filter.EndDate, err = queryDate(query, "end_date"); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if filter.MinScore, err = queryFloat(query, "min_score"); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	pairs, err := h.service.ScanDuplicates(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if pairs == nil {
+		pairs = []domain.DuplicatePair{}
+	}
+
+	writeJSON(w, http.StatusOK, pairs)
+}
+
+// ResolveDuplicate merges or dismisses a pair of suspected duplicates
+func (h *ExpenseHandler) ResolveDuplicate(w http.ResponseWriter, r *http.Request) {
+	var req domain.ResolveDuplicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	expense, err := h.service.ResolveDuplicate(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, expense)
+}
+
+// expenseFilter reads budget_id, pocket_id, period, start_date, end_date,
+// min_amount, max_amount, text, repeated tag, and the list options
+func expenseFilter(query url.Values) (domain.ExpenseFilter, error) {
+	filter := domain.ExpenseFilter{
+		Period: query.Get("period"),
+		Text:   query.Get("text"),
+		Tags:   query["tag"],
+	}
+
+	var err error
+	if filter.ListOptions, err = listOptions(query); err != nil {
+		return filter, err
+	}
+	if filter.BudgetID, err = queryInt64(query, "budget_id"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.PocketID, err = queryInt64(query, "pocket_id"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.StartDate, err = queryDate(query, "start_date"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.EndDate, err = queryDate(query, "end_date"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.MinAmount, err = queryFloat(query, "min_amount"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	if filter.MaxAmount, err = queryFloat(query, "max_amount"); err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	uncategorized, err := queryBool(query, "uncategorized")
+	if err != nil {
+		return filter, domain.ErrInvalidInput
+	}
+	filter.Uncategorized = uncategorized != nil && *uncategorized
+	return filter, nil
 }
 
 func (h *ExpenseHandler) GetByBudgetID(w http.ResponseWriter, r *http.Request) {
@@ -129,3 +247,44 @@ func (h *ExpenseHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, SuccessResponse{Message: "Expense deleted successfully"})
 }
+
+// CreateRefund records a refund linked to the expense in the path
+func (h *ExpenseHandler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var req domain.CreateExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	req.Type = domain.ExpenseTypeRefund
+	req.RefundOfID = &id
+
+	refund, err := h.service.Create(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, refund)
+}
+
+func (h *ExpenseHandler) GetRefunds(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	refunds, err := h.service.GetRefunds(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, refunds)
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/service"
+)
+
+// ExportHandler streams spreadsheet exports. Each endpoint takes the filters and
+// sort of the matching listing plus the file options read by exportOptions.
+type ExportHandler struct {
+	service *service.ExportService
+}
+
+func NewExportHandler(service *service.ExportService) *ExportHandler {
+	return &ExportHandler{service: service}
+}
+
+func (h *ExportHandler) Expenses(w http.ResponseWriter, r *http.Request) {
+	filter, err := expenseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.export(w, r, "expenses", func(ctx context.Context, opts domain.ExportOptions, open func() io.Writer) error {
+		return h.service.Expenses(ctx, filter, opts, open)
+	})
+}
+
+func (h *ExportHandler) Budgets(w http.ResponseWriter, r *http.Request) {
+	filter, err := budgetFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.export(w, r, "budgets", func(ctx context.Context, opts domain.ExportOptions, open func() io.Writer) error {
+		return h.service.Budgets(ctx, filter, opts, open)
+	})
+}
+
+func (h *ExportHandler) Pockets(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, "pockets", h.service.Pockets)
+}
+
+func (h *ExportHandler) BudgetRules(w http.ResponseWriter, r *http.Request) {
+	filter, err := budgetRuleFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.export(w, r, "budget-rules", func(ctx context.Context, opts domain.ExportOptions, open func() io.Writer) error {
+		return h.service.BudgetRules(ctx, filter, opts, open)
+	})
+}
+
+// export runs an export as an attachment named after the table and today's date.
+// Errors after the first byte was sent can only be logged.
+func (h *ExportHandler) export(w http.ResponseWriter, r *http.Request, name string,
+	run func(context.Context, domain.ExportOptions, func() io.Writer) error) {
+	opts, err := exportOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	started := false
+	open := func() io.Writer {
+		started = true
+		filename := name + "-" + time.Now().Format("2006-01-02") + "." + string(opts.Format)
+		if opts.Format == domain.ExportXLSX {
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.WriteHeader(http.StatusOK)
+		return w
+	}
+
+	if err := run(r.Context(), opts, open); err != nil {
+		if !started {
+			writeError(w, err)
+			return
+		}
+		log.Printf("Export of %s failed: %v", name, err)
+	}
+}
+
+// exportOptions reads ?format=csv|xlsx, ?columns=date,amount, ?delimiter= (a single
+// character, or "tab"), ?decimal=.|, and ?bom=true
+func exportOptions(query url.Values) (domain.ExportOptions, error) {
+	opts := domain.ExportOptions{Format: domain.ExportFormat(query.Get("format"))}
+	if opts.Format == "" {
+		opts.Format = domain.ExportCSV
+	}
+
+	if columns := query.Get("columns"); columns != "" {
+		for _, column := range strings.Split(columns, ",") {
+			opts.Columns = append(opts.Columns, strings.TrimSpace(column))
+		}
+	}
+
+	var err error
+	if opts.Delimiter, err = queryRune(query, "delimiter"); err != nil {
+		return opts, err
+	}
+	if opts.DecimalSeparator, err = queryRune(query, "decimal"); err != nil {
+		return opts, err
+	}
+
+	bom, err := queryBool(query, "bom")
+	if err != nil {
+		return opts, domain.ErrInvalidInput
+	}
+	opts.BOM = bom != nil && *bom
+	return opts, nil
+}
+
+// queryRune reads a single-character parameter; "tab" stands for a tab
+func queryRune(values url.Values, key string) (rune, error) {
+	raw := values.Get(key)
+	switch {
+	case raw == "":
+		return 0, nil
+	case raw == "tab":
+		return '\t', nil
+	case utf8.RuneCountInString(raw) != 1:
+		return 0, domain.ErrInvalidInput
+	}
+	r, _ := utf8.DecodeRuneInString(raw)
+	return r, nil
+}
@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/middleware"
+	"github.com/suprie/budget-manager/internal/service"
+)
+
+type ImportHandler struct {
+	service *service.ImportService
+}
+
+func NewImportHandler(service *service.ImportService) *ImportHandler {
+	return &ImportHandler{service: service}
+}
+
+// Upload imports the statement in the "file" part of a multipart/form-data
+// request. ?bank= names the parser, which is otherwise detected;
+// ?default_budget_id= catches debits no rule matches; ?dry_run=true only reports;
+// ?auto_approve=0.9 approves lines whose suggestion is at least that sure.
+func (h *ImportHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, domain.ErrUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	req := domain.ImportRequest{Bank: query.Get("bank")}
+	var err error
+	if req.DefaultBudgetID, err = queryInt64(query, "default_budget_id"); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	dryRun, err := queryBool(query, "dry_run")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	req.DryRun = dryRun != nil && *dryRun
+	autoApprove, err := queryFloat(query, "auto_approve")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if autoApprove != nil {
+		req.AutoApprove = *autoApprove
+	}
+
+	// Leave headroom for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxStatementSize+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			writeError(w, domain.ErrInvalidInput)
+			return
+		}
+		if err != nil {
+			writeError(w, uploadError(err))
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, service.MaxStatementSize+1))
+		if err != nil {
+			writeError(w, uploadError(err))
+			return
+		}
+
+		req.FileName = part.FileName()
+		imp, err := h.service.Import(r.Context(), userID, req, data)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		status := http.StatusCreated
+		if imp.DryRun {
+			status = http.StatusOK
+		}
+		writeJSON(w, status, imp)
+		return
+	}
+}
+
+func (h *ImportHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	imports, err := h.service.List(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if imports == nil {
+		imports = []*domain.Import{}
+	}
+
+	writeJSON(w, http.StatusOK, imports)
+}
+
+func (h *ImportHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	imp, err := h.service.GetByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, imp)
+}
+
+// GetItems lists the lines of an import, optionally narrowed by ?status=
+func (h *ImportHandler) GetItems(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	filter := domain.ImportItemFilter{Status: domain.ImportItemStatus(r.URL.Query().Get("status"))}
+	items, err := h.service.Items(r.Context(), id, filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if items == nil {
+		items = []domain.ImportItem{}
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+// UpdateItem recategorizes, splits, renames, ignores or restores a pending line
+func (h *ImportHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	id, itemID, err := importItemIDs(r)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var req domain.UpdateImportItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	item, err := h.service.UpdateItem(r.Context(), id, itemID, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, item)
+}
+
+// ApproveItem records a pending line as an expense
+func (h *ImportHandler) ApproveItem(w http.ResponseWriter, r *http.Request) {
+	id, itemID, err := importItemIDs(r)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	item, err := h.service.ApproveItem(r.Context(), id, itemID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, item)
+}
+
+// BulkItems approves, ignores, restores or categorizes many lines at once
+func (h *ImportHandler) BulkItems(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var req domain.BulkImportItemsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	imp, err := h.service.Bulk(r.Context(), id, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, imp)
+}
+
+// Rollback deletes the expenses an import created and closes it
+func (h *ImportHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	imp, err := h.service.Rollback(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, imp)
+}
+
+// Banks lists the bank keys accepted by ?bank=
+func (h *ImportHandler) Banks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.Banks())
+}
+
+func (h *ImportHandler) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.service.ListAccounts(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if accounts == nil {
+		accounts = []domain.ImportAccount{}
+	}
+
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+// SetAccount maps a statement account to a pocket, replacing any earlier mapping
+func (h *ImportHandler) SetAccount(w http.ResponseWriter, r *http.Request) {
+	var req domain.SetImportAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	account, err := h.service.SetAccount(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account)
+}
+
+func (h *ImportHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	if err := h.service.DeleteAccount(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Message: "Import account deleted successfully"})
+}
+
+func importItemIDs(r *http.Request) (int64, int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	itemID, err := strconv.ParseInt(r.PathValue("item_id"), 10, 64)
+	return id, itemID, err
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/service"
+)
+
+type PayeeHandler struct {
+	service *service.PayeeService
+}
+
+func NewPayeeHandler(service *service.PayeeService) *PayeeHandler {
+	return &PayeeHandler{service: service}
+}
+
+func (h *PayeeHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req domain.CreatePayeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	payee, err := h.service.Create(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, payee)
+}
+
+func (h *PayeeHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	payee, err := h.service.GetByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payee)
+}
+
+func (h *PayeeHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	payees, err := h.service.GetAll(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if payees == nil {
+		payees = []*domain.Payee{}
+	}
+
+	writeJSON(w, http.StatusOK, payees)
+}
+
+func (h *PayeeHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var req domain.UpdatePayeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	payee, err := h.service.Update(r.Context(), id, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payee)
+}
+
+func (h *PayeeHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Message: "Payee deleted successfully"})
+}
+
+// Merge folds the payees listed in the body into the payee in the path
+func (h *PayeeHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var req domain.MergePayeesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	payee, err := h.service.Merge(r.Context(), id, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payee)
+}
+
+func (h *PayeeHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	stats, err := h.service.GetStats(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *PayeeHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var req domain.CreatePayeeRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	rule, err := h.service.CreateRule(r.Context(), id, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (h *PayeeHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	rules, err := h.service.GetRules(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if rules == nil {
+		rules = []domain.PayeeRule{}
+	}
+
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (h *PayeeHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	if err := h.service.DeleteRule(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Message: "Payee rule deleted successfully"})
+}
+
+// Match normalizes the description query parameter and resolves it to a payee
+func (h *PayeeHandler) Match(w http.ResponseWriter, r *http.Request) {
+	description := r.URL.Query().Get("description")
+	if description == "" {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	match, err := h.service.Resolve(r.Context(), description)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, match)
+}
+
+// Backfill links existing expenses without a payee using the current rules
+func (h *PayeeHandler) Backfill(w http.ResponseWriter, r *http.Request) {
+	linked, err := h.service.ResolveExpenses(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"linked": linked})
+}
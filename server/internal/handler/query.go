@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// Optional query parameter parsers: a missing parameter yields nil,
+// a malformed one an error
+
+func queryFloat(values url.Values, key string) (*float64, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func queryInt64(values url.Values, key string) (*int64, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func queryDate(values url.Values, key string) (*time.Time, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func queryBool(values url.Values, key string) (*bool, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// listOptions reads ?sort=-date,amount (a leading "-" sorts descending),
+// ?limit= and ?cursor=
+func listOptions(values url.Values) (domain.ListOptions, error) {
+	opts := domain.ListOptions{Cursor: values.Get("cursor")}
+
+	if sort := values.Get("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			if field == "" {
+				return opts, domain.ErrInvalidInput
+			}
+			opts.Sort = append(opts.Sort, domain.SortField{Field: field, Desc: desc})
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		var err error
+		if opts.Limit, err = strconv.Atoi(limit); err != nil {
+			return opts, domain.ErrInvalidInput
+		}
+	}
+	return opts, nil
+}
+
+// writeList responds with the page when the caller asked for one, and with
+// the bare list otherwise
+func writeList[T any](w http.ResponseWriter, opts domain.ListOptions, page *domain.Page[T]) {
+	if opts.Paginated() {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+	writeJSON(w, http.StatusOK, page.Items)
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/service"
+)
+
+// ReportHandler serves chart-ready spending reports. Date ranges default to the current month.
+type ReportHandler struct {
+	service *service.ReportService
+}
+
+func NewReportHandler(service *service.ReportService) *ReportHandler {
+	return &ReportHandler{service: service}
+}
+
+// SpendingByCategory handles ?start_date=&end_date=&pocket_id=
+func (h *ReportHandler) SpendingByCategory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pocketID, err := queryInt64(query, "pocket_id")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	report, err := h.service.SpendingByCategory(r.Context(),
+		query.Get("start_date"), query.Get("end_date"), pocketID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Trends handles ?end_period=2024-12&months=6&pocket_id=
+func (h *ReportHandler) Trends(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pocketID, err := queryInt64(query, "pocket_id")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var months int
+	if raw := query.Get("months"); raw != "" {
+		if months, err = strconv.Atoi(raw); err != nil {
+			writeError(w, domain.ErrInvalidInput)
+			return
+		}
+	}
+
+	report, err := h.service.Trends(r.Context(), query.Get("end_period"), months, pocketID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Variance handles ?period=2024-12&pocket_id=
+func (h *ReportHandler) Variance(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pocketID, err := queryInt64(query, "pocket_id")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	report, err := h.service.Variance(r.Context(), query.Get("period"), pocketID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// TopPayees handles ?start_date=&end_date=&limit=10&pocket_id=
+func (h *ReportHandler) TopPayees(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pocketID, err := queryInt64(query, "pocket_id")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	var limit int
+	if raw := query.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil {
+			writeError(w, domain.ErrInvalidInput)
+			return
+		}
+	}
+
+	payees, err := h.service.TopPayees(r.Context(),
+		query.Get("start_date"), query.Get("end_date"), limit, pocketID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payees)
+}
+
+// Series handles ?start_date=&end_date=&granularity=day|week|month&pocket_id=
+func (h *ReportHandler) Series(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pocketID, err := queryInt64(query, "pocket_id")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	report, err := h.service.Series(r.Context(), query.Get("start_date"), query.Get("end_date"),
+		domain.SeriesGranularity(query.Get("granularity")), pocketID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -13,6 +13,13 @@ type ErrorResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+// CategorizationErrorResponse asks the client to pick one of the candidates
+type CategorizationErrorResponse struct {
+	ErrorResponse
+	Code       string                   `json:"code"` // "needs_categorization"
+	Candidates []domain.BudgetCandidate `json:"candidates"`
+}
+
 type SuccessResponse struct {
 	Message string `json:"message"`
 }
@@ -24,6 +31,19 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 }
 
 func writeError(w http.ResponseWriter, err error) {
+	var categorization *domain.CategorizationError
+	if errors.As(err, &categorization) {
+		writeJSON(w, http.StatusUnprocessableEntity, CategorizationErrorResponse{
+			ErrorResponse: ErrorResponse{
+				Error:   http.StatusText(http.StatusUnprocessableEntity),
+				Message: "Choose a budget for the expense",
+			},
+			Code:       "needs_categorization",
+			Candidates: categorization.Candidates,
+		})
+		return
+	}
+
 	var status int
 	var message string
 
@@ -43,6 +63,24 @@ func writeError(w http.ResponseWriter, err error) {
 	case errors.Is(err, domain.ErrBudgetHasExpenses):
 		status = http.StatusConflict
 		message = "Cannot delete budget with associated expenses"
+	case errors.Is(err, domain.ErrExpenseHasRefunds):
+		status = http.StatusConflict
+		message = "Cannot delete expense with associated refunds"
+	case errors.Is(err, domain.ErrRefundExceedsSpent):
+		status = http.StatusBadRequest
+		message = "Refund exceeds the amount spent"
+	case errors.Is(err, domain.ErrDuplicateEntry):
+		status = http.StatusConflict
+		message = "Duplicate entry"
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		status = http.StatusRequestEntityTooLarge
+		message = "Attachment storage quota exceeded"
+	case errors.Is(err, domain.ErrFileTooLarge):
+		status = http.StatusRequestEntityTooLarge
+		message = "File too large"
+	case errors.Is(err, domain.ErrUnsupportedMedia):
+		status = http.StatusUnsupportedMediaType
+		message = "Unsupported file type"
 	case errors.Is(err, domain.ErrEmailAlreadyExists):
 		status = http.StatusConflict
 		message = "Email already exists"
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/pkg/yaml"
+)
+
+// maxRulePackSize caps the body of an imported rule pack
+const maxRulePackSize = 1 << 20
+
+// Export downloads the rules, filtered as in GetAll, as a rule pack in
+// ?format=json (the default) or yaml
+func (h *BudgetRuleHandler) Export(w http.ResponseWriter, r *http.Request) {
+	filter, err := budgetRuleFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pack, err := h.ruleService.Export(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeRulePack(w, r, pack, "budget-rules-"+time.Now().Format("2006-01-02"))
+}
+
+// Import reads a rule pack written in JSON or YAML and imports it with
+// ?mode=merge (the default) or replace; ?dry_run=true previews the outcome
+func (h *BudgetRuleHandler) Import(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := domain.ImportRulePackRequest{Mode: domain.RulePackMode(query.Get("mode"))}
+	dryRun, err := queryBool(query, "dry_run")
+	if err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if dryRun != nil {
+		req.DryRun = *dryRun
+	}
+
+	var pack domain.RulePack
+	if err := readRulePack(w, r, &pack); err != nil {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	result, err := h.ruleService.Import(r.Context(), pack, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Presets lists the rule packs shipped with the server
+func (h *BudgetRuleHandler) Presets(w http.ResponseWriter, r *http.Request) {
+	presets, err := h.ruleService.Presets()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, presets)
+}
+
+// Preset returns a shipped rule pack, in ?format=json (the default) or yaml
+func (h *BudgetRuleHandler) Preset(w http.ResponseWriter, r *http.Request) {
+	pack, err := h.ruleService.Preset(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeRulePack(w, r, pack, pack.Name)
+}
+
+// InstallPreset imports a shipped rule pack. The body, optional, sets the
+// mode, dry run and the budget names to use for the pack's categories.
+func (h *BudgetRuleHandler) InstallPreset(w http.ResponseWriter, r *http.Request) {
+	var req domain.ImportRulePackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+
+	result, err := h.ruleService.InstallPreset(r.Context(), r.PathValue("name"), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeRulePack sends a rule pack as an attachment named after name, in the
+// ?format the request asks for
+func writeRulePack(w http.ResponseWriter, r *http.Request, pack *domain.RulePack, name string) {
+	var data []byte
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		name += ".json"
+		data, err = json.MarshalIndent(pack, "", "  ")
+	case "yaml":
+		w.Header().Set("Content-Type", "application/yaml")
+		name += ".yaml"
+		data, err = yaml.Marshal(pack)
+	default:
+		writeError(w, domain.ErrInvalidInput)
+		return
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// readRulePack decodes a rule pack from the request body: YAML when the
+// content type says so or the body is not a JSON object, JSON otherwise
+func readRulePack(w http.ResponseWriter, r *http.Request, pack *domain.RulePack) error {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRulePackSize))
+	if err != nil {
+		return err
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if strings.Contains(mediaType, "yaml") || !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return yaml.Unmarshal(data, pack)
+	}
+	return json.Unmarshal(data, pack)
+}
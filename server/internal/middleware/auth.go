@@ -2,15 +2,21 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
 
+	"github.com/suprie/budget-manager/internal/domain"
 	"github.com/suprie/budget-manager/internal/service"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "user_id"
+const (
+	UserIDKey    contextKey = "user_id"
+	SessionIDKey contextKey = "session_id"
+)
 
 type AuthMiddleware struct {
 	authService *service.AuthService
@@ -34,13 +40,19 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		claims, err := m.authService.ValidateToken(parts[1])
-		if err != nil {
+		// Tokens of revoked sessions are refused like expired ones
+		claims, err := m.authService.Authenticate(r.Context(), parts[1], RequestClient(r))
+		if errors.Is(err, domain.ErrInvalidToken) {
 			http.Error(w, `{"error":"Unauthorized","message":"Invalid or expired token"}`, http.StatusUnauthorized)
 			return
 		}
+		if err != nil {
+			http.Error(w, `{"error":"Internal Server Error","message":"Internal server error"}`, http.StatusInternalServerError)
+			return
+		}
 
 		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -49,3 +61,19 @@ func GetUserID(ctx context.Context) (int64, bool) {
 	userID, ok := ctx.Value(UserIDKey).(int64)
 	return userID, ok
 }
+
+func GetSessionID(ctx context.Context) (int64, bool) {
+	sessionID, ok := ctx.Value(SessionIDKey).(int64)
+	return sessionID, ok
+}
+
+// RequestClient reads the address and user agent of the client making a
+// request. The address is that of the peer, so behind a reverse proxy it is
+// the proxy's.
+func RequestClient(r *http.Request) domain.SessionClient {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return domain.SessionClient{IPAddress: ip, UserAgent: r.UserAgent()}
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+type AttachmentRepository struct {
+	db *sql.DB
+}
+
+func NewAttachmentRepository(db *sql.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+func (r *AttachmentRepository) Create(ctx context.Context, attachment *domain.Attachment) error {
+	now := time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO attachments (expense_id, user_id, file_name, content_type, size, storage_key, thumbnail_key, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		attachment.ExpenseID, attachment.UserID, attachment.FileName, attachment.ContentType,
+		attachment.Size, attachment.StorageKey, attachment.ThumbnailKey, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	attachment.ID = id
+	attachment.CreatedAt = now
+	return nil
+}
+
+func (r *AttachmentRepository) GetByID(ctx context.Context, id int64) (*domain.Attachment, error) {
+	attachment := &domain.Attachment{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, expense_id, user_id, file_name, content_type, size, storage_key, thumbnail_key, created_at
+		 FROM attachments WHERE id = ?`, id,
+	).Scan(&attachment.ID, &attachment.ExpenseID, &attachment.UserID, &attachment.FileName,
+		&attachment.ContentType, &attachment.Size, &attachment.StorageKey,
+		&attachment.ThumbnailKey, &attachment.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	attachment.HasThumbnail = attachment.ThumbnailKey != ""
+	return attachment, nil
+}
+
+func (r *AttachmentRepository) GetByExpenseID(ctx context.Context, expenseID int64) ([]*domain.Attachment, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, expense_id, user_id, file_name, content_type, size, storage_key, thumbnail_key, created_at
+		 FROM attachments WHERE expense_id = ? ORDER BY id`, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*domain.Attachment
+	for rows.Next() {
+		attachment := &domain.Attachment{}
+		if err := rows.Scan(&attachment.ID, &attachment.ExpenseID, &attachment.UserID,
+			&attachment.FileName, &attachment.ContentType, &attachment.Size,
+			&attachment.StorageKey, &attachment.ThumbnailKey, &attachment.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachment.HasThumbnail = attachment.ThumbnailKey != ""
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// GetTotalSizeByUserID returns the bytes a user currently has stored
+func (r *AttachmentRepository) GetTotalSizeByUserID(ctx context.Context, userID int64) (int64, error) {
+	var total int64
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = ?`, userID,
+	).Scan(&total)
+	return total, err
+}
+
+func (r *AttachmentRepository) Delete(ctx context.Context, id int64) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM attachments WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *AttachmentRepository) DeleteByExpenseID(ctx context.Context, expenseID int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM attachments WHERE expense_id = ?`, expenseID)
+	return err
+}
+
+// MoveAll hands every attachment of one expense over to another
+func (r *AttachmentRepository) MoveAll(ctx context.Context, fromExpenseID, toExpenseID int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE attachments SET expense_id = ? WHERE expense_id = ?`, toExpenseID, fromExpenseID)
+	return err
+}
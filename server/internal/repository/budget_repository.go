@@ -19,7 +19,7 @@ func NewBudgetRepository(db *sql.DB) *BudgetRepository {
 
 func (r *BudgetRepository) Create(ctx context.Context, budget *domain.Budget) error {
 	now := time.Now()
-	result, err := r.db.ExecContext(ctx,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`INSERT INTO budgets (name, description, pocket_id, allocated_amount, spent_amount, period, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 		budget.Name, budget.Description, budget.PocketID, budget.AllocatedAmount,
@@ -42,7 +42,7 @@ func (r *BudgetRepository) Create(ctx context.Context, budget *domain.Budget) er
 
 func (r *BudgetRepository) GetByID(ctx context.Context, id int64) (*domain.Budget, error) {
 	budget := &domain.Budget{}
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`SELECT id, name, description, pocket_id, allocated_amount, spent_amount, period, created_at, updated_at
 		 FROM budgets WHERE id = ?`, id,
 	).Scan(&budget.ID, &budget.Name, &budget.Description, &budget.PocketID,
@@ -58,10 +58,47 @@ func (r *BudgetRepository) GetByID(ctx context.Context, id int64) (*domain.Budge
 	return budget, nil
 }
 
-func (r *BudgetRepository) GetAll(ctx context.Context) ([]*domain.Budget, error) {
-	rows, err := r.db.QueryContext(ctx,
+// budgetList sorts budget listings, latest period first by default
+var budgetList = listSpec[*domain.Budget]{
+	keys: map[string]sortKey[*domain.Budget]{
+		"id":               {column: "id", value: func(b *domain.Budget) any { return b.ID }},
+		"name":             {column: "name", value: func(b *domain.Budget) any { return b.Name }},
+		"period":           {column: "period", value: func(b *domain.Budget) any { return b.Period }},
+		"allocated_amount": {column: "allocated_amount", value: func(b *domain.Budget) any { return b.AllocatedAmount }},
+		"spent_amount":     {column: "spent_amount", value: func(b *domain.Budget) any { return b.SpentAmount }},
+		"created_at":       {column: "created_at", value: func(b *domain.Budget) any { return b.CreatedAt }},
+	},
+	defaultSort: []domain.SortField{{Field: "period", Desc: true}, {Field: "name"}},
+}
+
+// List returns the budgets matching the filter, one page at a time when a limit or cursor is set
+func (r *BudgetRepository) List(ctx context.Context, filter domain.BudgetFilter) (*domain.Page[*domain.Budget], error) {
+	q := &listQuery{}
+	if filter.PocketID != nil {
+		q.where(`pocket_id = ?`, *filter.PocketID)
+	}
+	if filter.Period != "" {
+		q.where(`period = ?`, filter.Period)
+	}
+	if filter.MinAllocated != nil {
+		q.where(`allocated_amount >= ?`, *filter.MinAllocated)
+	}
+	if filter.MaxAllocated != nil {
+		q.where(`allocated_amount <= ?`, *filter.MaxAllocated)
+	}
+	if filter.Text != "" {
+		pattern := "%" + filter.Text + "%"
+		q.where(`(name LIKE ? OR description LIKE ?)`, pattern, pattern)
+	}
+
+	order, err := budgetList.order(q, filter.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
 		`SELECT id, name, description, pocket_id, allocated_amount, spent_amount, period, created_at, updated_at
-		 FROM budgets ORDER BY period DESC, name`)
+		 FROM budgets`+q.whereClause()+order, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -77,11 +114,14 @@ func (r *BudgetRepository) GetAll(ctx context.Context) ([]*domain.Budget, error)
 		}
 		budgets = append(budgets, budget)
 	}
-	return budgets, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return budgetList.page(budgets, filter.ListOptions)
 }
 
 func (r *BudgetRepository) GetByPocketID(ctx context.Context, pocketID int64) ([]*domain.Budget, error) {
-	rows, err := r.db.QueryContext(ctx,
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
 		`SELECT id, name, description, pocket_id, allocated_amount, spent_amount, period, created_at, updated_at
 		 FROM budgets WHERE pocket_id = ? ORDER BY period DESC, name`, pocketID)
 	if err != nil {
@@ -103,7 +143,7 @@ func (r *BudgetRepository) GetByPocketID(ctx context.Context, pocketID int64) ([
 }
 
 func (r *BudgetRepository) GetByPeriod(ctx context.Context, period string) ([]*domain.Budget, error) {
-	rows, err := r.db.QueryContext(ctx,
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
 		`SELECT id, name, description, pocket_id, allocated_amount, spent_amount, period, created_at, updated_at
 		 FROM budgets WHERE period = ? ORDER BY name`, period)
 	if err != nil {
@@ -124,9 +164,49 @@ func (r *BudgetRepository) GetByPeriod(ctx context.Context, period string) ([]*d
 	return budgets, rows.Err()
 }
 
+// GetLatestByName returns the most recent budget with the given name (case-insensitive) up to maxPeriod
+func (r *BudgetRepository) GetLatestByName(ctx context.Context, name, maxPeriod string) (*domain.Budget, error) {
+	budget := &domain.Budget{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, name, description, pocket_id, allocated_amount, spent_amount, period, created_at, updated_at
+		 FROM budgets WHERE name = ? COLLATE NOCASE AND period <= ?
+		 ORDER BY period DESC, id DESC LIMIT 1`, name, maxPeriod,
+	).Scan(&budget.ID, &budget.Name, &budget.Description, &budget.PocketID,
+		&budget.AllocatedAmount, &budget.SpentAmount, &budget.Period,
+		&budget.CreatedAt, &budget.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+// GetLatestByNameInPocket is GetLatestByName limited to the budgets of one pocket
+func (r *BudgetRepository) GetLatestByNameInPocket(ctx context.Context, name string, pocketID int64, maxPeriod string) (*domain.Budget, error) {
+	budget := &domain.Budget{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, name, description, pocket_id, allocated_amount, spent_amount, period, created_at, updated_at
+		 FROM budgets WHERE name = ? COLLATE NOCASE AND pocket_id = ? AND period <= ?
+		 ORDER BY period DESC, id DESC LIMIT 1`, name, pocketID, maxPeriod,
+	).Scan(&budget.ID, &budget.Name, &budget.Description, &budget.PocketID,
+		&budget.AllocatedAmount, &budget.SpentAmount, &budget.Period,
+		&budget.CreatedAt, &budget.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
 func (r *BudgetRepository) Update(ctx context.Context, budget *domain.Budget) error {
 	budget.UpdatedAt = time.Now()
-	result, err := r.db.ExecContext(ctx,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`UPDATE budgets SET name = ?, description = ?, allocated_amount = ?, updated_at = ?
 		 WHERE id = ?`,
 		budget.Name, budget.Description, budget.AllocatedAmount, budget.UpdatedAt, budget.ID,
@@ -146,7 +226,7 @@ func (r *BudgetRepository) Update(ctx context.Context, budget *domain.Budget) er
 }
 
 func (r *BudgetRepository) UpdateSpentAmount(ctx context.Context, id int64, amount float64) error {
-	result, err := r.db.ExecContext(ctx,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`UPDATE budgets SET spent_amount = spent_amount + ?, updated_at = ? WHERE id = ?`,
 		amount, time.Now(), id,
 	)
@@ -167,8 +247,9 @@ func (r *BudgetRepository) UpdateSpentAmount(ctx context.Context, id int64, amou
 func (r *BudgetRepository) Delete(ctx context.Context, id int64) error {
 	// Check if budget has expenses
 	var count int
-	err := r.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM expenses WHERE budget_id = ?`, id,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM expenses WHERE budget_id = ?)
+		      + (SELECT COUNT(*) FROM expense_splits WHERE budget_id = ?)`, id, id,
 	).Scan(&count)
 	if err != nil {
 		return err
@@ -177,7 +258,18 @@ func (r *BudgetRepository) Delete(ctx context.Context, id int64) error {
 		return domain.ErrBudgetHasExpenses
 	}
 
-	result, err := r.db.ExecContext(ctx, `DELETE FROM budgets WHERE id = ?`, id)
+	// Staged statement lines may still name the budget; split lines lose the whole split
+	for _, query := range []string{
+		`UPDATE import_items SET budget_id = NULL WHERE budget_id = ?`,
+		`DELETE FROM import_item_splits
+		 WHERE item_id IN (SELECT item_id FROM import_item_splits WHERE budget_id = ?)`,
+	} {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM budgets WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
@@ -195,7 +287,7 @@ func (r *BudgetRepository) Delete(ctx context.Context, id int64) error {
 func (r *BudgetRepository) GetSummaryByPeriod(ctx context.Context, period string) (*domain.BudgetSummary, error) {
 	summary := &domain.BudgetSummary{Period: period}
 
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`SELECT COALESCE(SUM(allocated_amount), 0), COALESCE(SUM(spent_amount), 0)
 		 FROM budgets WHERE period = ?`, period,
 	).Scan(&summary.TotalAllocated, &summary.TotalSpent)
@@ -204,6 +296,18 @@ func (r *BudgetRepository) GetSummaryByPeriod(ctx context.Context, period string
 		return nil, err
 	}
 
+	// Refunds are already netted out of spent_amount; report them separately
+	err = conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(e.amount), 0)
+		 FROM expenses e JOIN budgets b ON e.budget_id = b.id
+		 WHERE b.period = ? AND e.type = ?`, period, domain.ExpenseTypeRefund,
+	).Scan(&summary.TotalRefunds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	summary.GrossSpent = summary.TotalSpent + summary.TotalRefunds
 	summary.TotalRemaining = summary.TotalAllocated - summary.TotalSpent
 	return summary, nil
 }
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/suprie/budget-manager/internal/domain"
@@ -16,12 +17,38 @@ func NewBudgetRuleRepository(db *sql.DB) *BudgetRuleRepository {
 	return &BudgetRuleRepository{db: db}
 }
 
+// budgetRuleColumns is the column list read by scanBudgetRule
+const budgetRuleColumns = `br.id, br.budget_id, br.keywords, br.operator, br.conditions, br.priority, br.is_active,
+	br.created_at, br.updated_at, br.hit_count, br.last_matched_at`
+
+// scanBudgetRule reads budgetRuleColumns, followed by any extra columns into extra
+func scanBudgetRule(row rowScanner, rule *domain.BudgetRule, extra ...any) error {
+	var conditions string
+	dest := []any{&rule.ID, &rule.BudgetID, &rule.Keywords, &rule.Operator, &conditions, &rule.Priority,
+		&rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt, &rule.HitCount, &rule.LastMatchedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	if conditions == "" {
+		// Written with keywords only, as by scripts unaware of conditions;
+		// read it as the startup migration converts it
+		rule.Operator, rule.Conditions = domain.RuleOr, domain.KeywordConditions(rule.Keywords)
+		return nil
+	}
+	return json.Unmarshal([]byte(conditions), &rule.Conditions)
+}
+
 func (r *BudgetRuleRepository) Create(ctx context.Context, rule *domain.BudgetRule) error {
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now()
-	result, err := r.db.ExecContext(ctx,
-		`INSERT INTO budget_rules (budget_id, keywords, priority, is_active, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		rule.BudgetID, rule.Keywords, rule.Priority, rule.IsActive, now, now,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO budget_rules (budget_id, keywords, operator, conditions, priority, is_active, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.BudgetID, rule.Keywords, rule.Operator, string(conditions), rule.Priority, rule.IsActive, now, now,
 	)
 	if err != nil {
 		return err
@@ -40,11 +67,9 @@ func (r *BudgetRuleRepository) Create(ctx context.Context, rule *domain.BudgetRu
 
 func (r *BudgetRuleRepository) GetByID(ctx context.Context, id int64) (*domain.BudgetRule, error) {
 	rule := &domain.BudgetRule{}
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, budget_id, keywords, priority, is_active, created_at, updated_at
-		 FROM budget_rules WHERE id = ?`, id,
-	).Scan(&rule.ID, &rule.BudgetID, &rule.Keywords, &rule.Priority,
-		&rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt)
+	err := scanBudgetRule(conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT `+budgetRuleColumns+` FROM budget_rules br WHERE br.id = ?`, id,
+	), rule)
 
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
@@ -55,14 +80,47 @@ func (r *BudgetRuleRepository) GetByID(ctx context.Context, id int64) (*domain.B
 	return rule, nil
 }
 
-func (r *BudgetRuleRepository) GetAll(ctx context.Context) ([]domain.BudgetRuleWithBudget, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT br.id, br.budget_id, br.keywords, br.priority, br.is_active,
-		        br.created_at, br.updated_at, b.name
+// budgetRuleList sorts rule listings in evaluation order by default
+var budgetRuleList = listSpec[domain.BudgetRuleWithBudget]{
+	keys: map[string]sortKey[domain.BudgetRuleWithBudget]{
+		"id":          {column: "br.id", value: func(r domain.BudgetRuleWithBudget) any { return r.ID }},
+		"priority":    {column: "br.priority", value: func(r domain.BudgetRuleWithBudget) any { return r.Priority }},
+		"budget_name": {column: "b.name", value: func(r domain.BudgetRuleWithBudget) any { return r.BudgetName }},
+		"created_at":  {column: "br.created_at", value: func(r domain.BudgetRuleWithBudget) any { return r.CreatedAt }},
+		"hit_count":   {column: "br.hit_count", value: func(r domain.BudgetRuleWithBudget) any { return r.HitCount }},
+	},
+	defaultSort: []domain.SortField{{Field: "priority", Desc: true}, {Field: "id"}},
+}
+
+// List returns the rules matching the filter, one page at a time when a limit or cursor is set
+func (r *BudgetRuleRepository) List(ctx context.Context, filter domain.BudgetRuleFilter) (*domain.Page[domain.BudgetRuleWithBudget], error) {
+	q := &listQuery{}
+	if filter.BudgetID != nil {
+		q.where(`br.budget_id = ?`, *filter.BudgetID)
+	}
+	if filter.PocketID != nil {
+		q.where(`b.pocket_id = ?`, *filter.PocketID)
+	}
+	if filter.Period != "" {
+		q.where(`b.period = ?`, filter.Period)
+	}
+	if filter.IsActive != nil {
+		q.where(`br.is_active = ?`, *filter.IsActive)
+	}
+	if filter.Text != "" {
+		pattern := "%" + filter.Text + "%"
+		q.where(`(br.keywords LIKE ? OR br.conditions LIKE ? OR b.name LIKE ?)`, pattern, pattern, pattern)
+	}
+
+	order, err := budgetRuleList.order(q, filter.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT `+budgetRuleColumns+`, b.name
 		 FROM budget_rules br
-		 JOIN budgets b ON br.budget_id = b.id
-		 ORDER BY br.priority DESC, br.id ASC`,
-	)
+		 JOIN budgets b ON br.budget_id = b.id`+q.whereClause()+order, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,31 +129,39 @@ func (r *BudgetRuleRepository) GetAll(ctx context.Context) ([]domain.BudgetRuleW
 	var rules []domain.BudgetRuleWithBudget
 	for rows.Next() {
 		var rule domain.BudgetRuleWithBudget
-		if err := rows.Scan(&rule.ID, &rule.BudgetID, &rule.Keywords, &rule.Priority,
-			&rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt, &rule.BudgetName); err != nil {
+		if err := scanBudgetRule(rows, &rule.BudgetRule, &rule.BudgetName); err != nil {
 			return nil, err
 		}
 		rules = append(rules, rule)
 	}
-
-	return rules, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return budgetRuleList.page(rules, filter.ListOptions)
 }
 
 func (r *BudgetRuleRepository) GetByBudgetID(ctx context.Context, budgetID int64) ([]domain.BudgetRule, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, budget_id, keywords, priority, is_active, created_at, updated_at
-		 FROM budget_rules WHERE budget_id = ? ORDER BY priority DESC`, budgetID,
-	)
+	return r.query(ctx,
+		`SELECT `+budgetRuleColumns+` FROM budget_rules br WHERE br.budget_id = ? ORDER BY br.priority DESC`, budgetID)
+}
+
+// GetActiveRules returns the active rules in evaluation order: by priority,
+// then oldest first, so that rules of equal priority always win in the same order
+func (r *BudgetRuleRepository) GetActiveRules(ctx context.Context) ([]domain.BudgetRuleWithBudget, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT `+budgetRuleColumns+`, b.name
+		 FROM budget_rules br
+		 JOIN budgets b ON br.budget_id = b.id
+		 WHERE br.is_active = 1 ORDER BY br.priority DESC, br.id`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var rules []domain.BudgetRule
+	var rules []domain.BudgetRuleWithBudget
 	for rows.Next() {
-		var rule domain.BudgetRule
-		if err := rows.Scan(&rule.ID, &rule.BudgetID, &rule.Keywords, &rule.Priority,
-			&rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		var rule domain.BudgetRuleWithBudget
+		if err := scanBudgetRule(rows, &rule.BudgetRule, &rule.BudgetName); err != nil {
 			return nil, err
 		}
 		rules = append(rules, rule)
@@ -104,11 +170,8 @@ func (r *BudgetRuleRepository) GetByBudgetID(ctx context.Context, budgetID int64
 	return rules, rows.Err()
 }
 
-func (r *BudgetRuleRepository) GetActiveRules(ctx context.Context) ([]domain.BudgetRule, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, budget_id, keywords, priority, is_active, created_at, updated_at
-		 FROM budget_rules WHERE is_active = 1 ORDER BY priority DESC`,
-	)
+func (r *BudgetRuleRepository) query(ctx context.Context, query string, args ...any) ([]domain.BudgetRule, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +180,7 @@ func (r *BudgetRuleRepository) GetActiveRules(ctx context.Context) ([]domain.Bud
 	var rules []domain.BudgetRule
 	for rows.Next() {
 		var rule domain.BudgetRule
-		if err := rows.Scan(&rule.ID, &rule.BudgetID, &rule.Keywords, &rule.Priority,
-			&rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		if err := scanBudgetRule(rows, &rule); err != nil {
 			return nil, err
 		}
 		rules = append(rules, rule)
@@ -128,12 +190,17 @@ func (r *BudgetRuleRepository) GetActiveRules(ctx context.Context) ([]domain.Bud
 }
 
 func (r *BudgetRuleRepository) Update(ctx context.Context, rule *domain.BudgetRule) error {
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return err
+	}
+
 	rule.UpdatedAt = time.Now()
-	result, err := r.db.ExecContext(ctx,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`UPDATE budget_rules
-		 SET keywords = ?, priority = ?, is_active = ?, updated_at = ?
+		 SET keywords = ?, operator = ?, conditions = ?, priority = ?, is_active = ?, updated_at = ?
 		 WHERE id = ?`,
-		rule.Keywords, rule.Priority, rule.IsActive, rule.UpdatedAt, rule.ID,
+		rule.Keywords, rule.Operator, string(conditions), rule.Priority, rule.IsActive, rule.UpdatedAt, rule.ID,
 	)
 	if err != nil {
 		return err
@@ -150,7 +217,12 @@ func (r *BudgetRuleRepository) Update(ctx context.Context, rule *domain.BudgetRu
 }
 
 func (r *BudgetRuleRepository) Delete(ctx context.Context, id int64) error {
-	result, err := r.db.ExecContext(ctx,
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE import_items SET rule_id = NULL WHERE rule_id = ?`, id); err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`DELETE FROM budget_rules WHERE id = ?`, id,
 	)
 	if err != nil {
@@ -166,3 +238,20 @@ func (r *BudgetRuleRepository) Delete(ctx context.Context, id int64) error {
 	}
 	return nil
 }
+
+// RecordHit counts a transaction categorized by the rule at the given time
+func (r *BudgetRuleRepository) RecordHit(ctx context.Context, id int64, at time.Time) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE budget_rules SET hit_count = hit_count + 1, last_matched_at = ? WHERE id = ?`, at, id)
+	return err
+}
+
+// DeleteAll deletes every rule, keeping the import items they categorized
+func (r *BudgetRuleRepository) DeleteAll(ctx context.Context) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE import_items SET rule_id = NULL WHERE rule_id IS NOT NULL`); err != nil {
+		return err
+	}
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM budget_rules`)
+	return err
+}
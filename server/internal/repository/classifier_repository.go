@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// ClassifierRepository stores the counts of the naive Bayes categorizer: how
+// many expenses each category holds and how often each feature occurs in it
+type ClassifierRepository struct {
+	db *sql.DB
+}
+
+func NewClassifierRepository(db *sql.DB) *ClassifierRepository {
+	return &ClassifierRepository{db: db}
+}
+
+// Add counts one document of a category with its features, or uncounts it
+// when delta is negative. Counts that drop to zero are removed.
+func (r *ClassifierRepository) Add(ctx context.Context, category string, features []string, delta int) error {
+	db := conn(ctx, r.db)
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO classifier_categories (category, documents) VALUES (?, ?)
+		 ON CONFLICT (category) DO UPDATE SET documents = documents + excluded.documents`,
+		category, delta,
+	); err != nil {
+		return err
+	}
+	for _, feature := range features {
+		if _, err := db.ExecContext(ctx,
+			`INSERT INTO classifier_features (category, feature, count) VALUES (?, ?, ?)
+			 ON CONFLICT (feature, category) DO UPDATE SET count = count + excluded.count`,
+			category, feature, delta,
+		); err != nil {
+			return err
+		}
+	}
+	if delta >= 0 {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM classifier_categories WHERE category = ? AND documents <= 0`, category); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `DELETE FROM classifier_features WHERE category = ? AND count <= 0`, category)
+	return err
+}
+
+// Reset forgets everything learned
+func (r *ClassifierRepository) Reset(ctx context.Context) error {
+	db := conn(ctx, r.db)
+	if _, err := db.ExecContext(ctx, `DELETE FROM classifier_features`); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `DELETE FROM classifier_categories`)
+	return err
+}
+
+func (r *ClassifierRepository) Stats(ctx context.Context) (*domain.ClassifierStats, error) {
+	stats := &domain.ClassifierStats{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT (SELECT COALESCE(SUM(documents), 0) FROM classifier_categories),
+		        (SELECT COUNT(*) FROM classifier_categories),
+		        (SELECT COUNT(DISTINCT feature) FROM classifier_features)`,
+	).Scan(&stats.Documents, &stats.Categories, &stats.Vocabulary)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Model loads the category totals and the counts of the given features
+func (r *ClassifierRepository) Model(ctx context.Context, features []string) (*domain.ClassifierModel, error) {
+	db := conn(ctx, r.db)
+	model := &domain.ClassifierModel{
+		Documents: make(map[string]int),
+		Totals:    make(map[string]int),
+		Counts:    make(map[string]map[string]int),
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT c.category, c.documents,
+		        (SELECT COALESCE(SUM(f.count), 0) FROM classifier_features f WHERE f.category = c.category)
+		 FROM classifier_categories c`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category string
+		var documents, total int
+		if err := rows.Scan(&category, &documents, &total); err != nil {
+			return nil, err
+		}
+		model.Documents[category], model.Totals[category] = documents, total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(DISTINCT feature) FROM classifier_features`,
+	).Scan(&model.Vocabulary); err != nil {
+		return nil, err
+	}
+	if len(features) == 0 {
+		return model, nil
+	}
+
+	args := make([]any, len(features))
+	for i, feature := range features {
+		args[i] = feature
+	}
+	rows, err = db.QueryContext(ctx,
+		`SELECT feature, category, count FROM classifier_features WHERE feature IN `+inList(len(features)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var feature, category string
+		var count int
+		if err := rows.Scan(&feature, &category, &count); err != nil {
+			return nil, err
+		}
+		if model.Counts[feature] == nil {
+			model.Counts[feature] = make(map[string]int)
+		}
+		model.Counts[feature][category] = count
+	}
+	return model, rows.Err()
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+type CustomFieldRepository struct {
+	db *sql.DB
+}
+
+func NewCustomFieldRepository(db *sql.DB) *CustomFieldRepository {
+	return &CustomFieldRepository{db: db}
+}
+
+func (r *CustomFieldRepository) Create(ctx context.Context, field *domain.CustomField) error {
+	now := time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO custom_fields (name, type, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		field.Name, field.Type, now, now,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return domain.ErrDuplicateEntry
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	field.ID = id
+	field.CreatedAt = now
+	field.UpdatedAt = now
+	return nil
+}
+
+func (r *CustomFieldRepository) GetByID(ctx context.Context, id int64) (*domain.CustomField, error) {
+	field := &domain.CustomField{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, name, type, created_at, updated_at FROM custom_fields WHERE id = ?`, id,
+	).Scan(&field.ID, &field.Name, &field.Type, &field.CreatedAt, &field.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+func (r *CustomFieldRepository) GetAll(ctx context.Context) ([]*domain.CustomField, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, name, type, created_at, updated_at FROM custom_fields ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fields []*domain.CustomField
+	for rows.Next() {
+		field := &domain.CustomField{}
+		if err := rows.Scan(&field.ID, &field.Name, &field.Type,
+			&field.CreatedAt, &field.UpdatedAt); err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, rows.Err()
+}
+
+func (r *CustomFieldRepository) Update(ctx context.Context, field *domain.CustomField) error {
+	field.UpdatedAt = time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE custom_fields SET name = ?, updated_at = ? WHERE id = ?`,
+		field.Name, field.UpdatedAt, field.ID,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return domain.ErrDuplicateEntry
+		}
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *CustomFieldRepository) Delete(ctx context.Context, id int64) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM expense_custom_values WHERE field_id = ?`, id); err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM custom_fields WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
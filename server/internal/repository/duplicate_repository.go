@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DuplicateRepository remembers expense pairs dismissed as not being duplicates
+type DuplicateRepository struct {
+	db *sql.DB
+}
+
+func NewDuplicateRepository(db *sql.DB) *DuplicateRepository {
+	return &DuplicateRepository{db: db}
+}
+
+// DuplicateKey identifies an unordered pair of expenses
+type DuplicateKey [2]int64
+
+// NewDuplicateKey orders the IDs so that either order gives the same key
+func NewDuplicateKey(a, b int64) DuplicateKey {
+	if a > b {
+		a, b = b, a
+	}
+	return DuplicateKey{a, b}
+}
+
+func (r *DuplicateRepository) Dismiss(ctx context.Context, key DuplicateKey) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT OR IGNORE INTO duplicate_dismissals (expense_id, other_id, created_at) VALUES (?, ?, ?)`,
+		key[0], key[1], time.Now(),
+	)
+	return err
+}
+
+// Dismissed returns every dismissed pair
+func (r *DuplicateRepository) Dismissed(ctx context.Context) (map[DuplicateKey]bool, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, `SELECT expense_id, other_id FROM duplicate_dismissals`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dismissed := make(map[DuplicateKey]bool)
+	for rows.Next() {
+		var key DuplicateKey
+		if err := rows.Scan(&key[0], &key[1]); err != nil {
+			return nil, err
+		}
+		dismissed[key] = true
+	}
+	return dismissed, rows.Err()
+}
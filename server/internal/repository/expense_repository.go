@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/suprie/budget-manager/internal/domain"
 )
@@ -17,12 +19,44 @@ func NewExpenseRepository(db *sql.DB) *ExpenseRepository {
 	return &ExpenseRepository{db: db}
 }
 
+// expenseColumns is the column list read by scanExpense
+const expenseColumns = `id, budget_id, type, refund_of_id, payee_id, amount, description, notes, date, created_at, updated_at,
+	COALESCE(categorized_by, '')`
+
+// expenseLinesCTE exposes every expense as per-budget lines: one line for a
+// single-budget expense and one per split for a split expense
+const expenseLinesCTE = `expense_lines AS (
+	SELECT e.id AS expense_id, e.budget_id, e.amount, e.type, e.date
+	FROM expenses e
+	WHERE NOT EXISTS (SELECT 1 FROM expense_splits s WHERE s.expense_id = e.id)
+	UNION ALL
+	SELECT e.id, s.budget_id, s.amount, e.type, e.date
+	FROM expense_splits s JOIN expenses e ON e.id = s.expense_id
+)`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanExpense(row rowScanner) (*domain.Expense, error) {
+	expense := &domain.Expense{}
+	err := row.Scan(&expense.ID, &expense.BudgetID, &expense.Type, &expense.RefundOfID, &expense.PayeeID,
+		&expense.Amount, &expense.Description, &expense.Notes, &expense.Date,
+		&expense.CreatedAt, &expense.UpdatedAt, &expense.CategorizedBy)
+	if err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
 func (r *ExpenseRepository) Create(ctx context.Context, expense *domain.Expense) error {
 	now := time.Now()
-	result, err := r.db.ExecContext(ctx,
-		`INSERT INTO expenses (budget_id, amount, description, date, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		expense.BudgetID, expense.Amount, expense.Description, expense.Date, now, now,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO expenses (budget_id, type, refund_of_id, payee_id, amount, description, notes, date, categorized_by,
+		 created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		expense.BudgetID, expense.Type, expense.RefundOfID, expense.PayeeID, expense.Amount, expense.Description,
+		expense.Notes, expense.Date, expense.CategorizedBy, now, now,
 	)
 	if err != nil {
 		return err
@@ -40,12 +74,9 @@ func (r *ExpenseRepository) Create(ctx context.Context, expense *domain.Expense)
 }
 
 func (r *ExpenseRepository) GetByID(ctx context.Context, id int64) (*domain.Expense, error) {
-	expense := &domain.Expense{}
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, budget_id, amount, description, date, created_at, updated_at
-		 FROM expenses WHERE id = ?`, id,
-	).Scan(&expense.ID, &expense.BudgetID, &expense.Amount, &expense.Description,
-		&expense.Date, &expense.CreatedAt, &expense.UpdatedAt)
+	expense, err := scanExpense(conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT `+expenseColumns+` FROM expenses WHERE id = ?`, id,
+	))
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrNotFound
@@ -53,56 +84,121 @@ func (r *ExpenseRepository) GetByID(ctx context.Context, id int64) (*domain.Expe
 	if err != nil {
 		return nil, err
 	}
+
+	if err := r.loadDetails(ctx, []*domain.Expense{expense}); err != nil {
+		return nil, err
+	}
 	return expense, nil
 }
 
-func (r *ExpenseRepository) GetAll(ctx context.Context) ([]*domain.Expense, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, budget_id, amount, description, date, created_at, updated_at
-		 FROM expenses ORDER BY date DESC, id DESC`)
-	if err != nil {
-		return nil, err
+// expenseList sorts expense listings, newest first by default
+var expenseList = listSpec[*domain.Expense]{
+	keys: map[string]sortKey[*domain.Expense]{
+		"id":          {column: "e.id", value: func(e *domain.Expense) any { return e.ID }},
+		"date":        {column: "e.date", value: func(e *domain.Expense) any { return e.Date }},
+		"amount":      {column: "e.amount", value: func(e *domain.Expense) any { return e.Amount }},
+		"description": {column: "e.description", value: func(e *domain.Expense) any { return e.Description }},
+		"created_at":  {column: "e.created_at", value: func(e *domain.Expense) any { return e.CreatedAt }},
+	},
+	defaultSort: []domain.SortField{{Field: "date", Desc: true}, {Field: "id", Desc: true}},
+}
+
+// List returns the expenses matching the filter, one page at a time when a limit or cursor is set
+func (r *ExpenseRepository) List(ctx context.Context, filter domain.ExpenseFilter) (*domain.Page[*domain.Expense], error) {
+	q := &listQuery{}
+	applyExpenseFilter(q, filter)
+	if filter.Text != "" {
+		pattern := "%" + filter.Text + "%"
+		q.where(`(e.description LIKE ? OR e.notes LIKE ?)`, pattern, pattern)
 	}
-	defer rows.Close()
 
-	var expenses []*domain.Expense
-	for rows.Next() {
-		expense := &domain.Expense{}
-		if err := rows.Scan(&expense.ID, &expense.BudgetID, &expense.Amount,
-			&expense.Description, &expense.Date, &expense.CreatedAt, &expense.UpdatedAt); err != nil {
-			return nil, err
-		}
-		expenses = append(expenses, expense)
+	order, err := expenseList.order(q, filter.ListOptions)
+	if err != nil {
+		return nil, err
 	}
-	return expenses, rows.Err()
-}
 
-func (r *ExpenseRepository) GetByBudgetID(ctx context.Context, budgetID int64) ([]*domain.Expense, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, budget_id, amount, description, date, created_at, updated_at
-		 FROM expenses WHERE budget_id = ? ORDER BY date DESC, id DESC`, budgetID)
+	expenses, err := r.query(ctx, `SELECT `+expenseColumns+` FROM expenses e`+q.whereClause()+order, q.args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return expenseList.page(expenses, filter.ListOptions)
+}
 
-	var expenses []*domain.Expense
-	for rows.Next() {
-		expense := &domain.Expense{}
-		if err := rows.Scan(&expense.ID, &expense.BudgetID, &expense.Amount,
-			&expense.Description, &expense.Date, &expense.CreatedAt, &expense.UpdatedAt); err != nil {
-			return nil, err
+// applyExpenseFilter adds every filter condition except the text match, which
+// List and Search treat differently
+func applyExpenseFilter(q *listQuery, filter domain.ExpenseFilter) {
+	if filter.BudgetID != nil {
+		q.where(`(e.budget_id = ? OR e.id IN (SELECT expense_id FROM expense_splits WHERE budget_id = ?))`,
+			*filter.BudgetID, *filter.BudgetID)
+	}
+	if filter.PocketID != nil {
+		q.where(`(e.budget_id IN (SELECT id FROM budgets WHERE pocket_id = ?)
+			OR e.id IN (SELECT s.expense_id FROM expense_splits s
+				JOIN budgets b ON b.id = s.budget_id WHERE b.pocket_id = ?))`,
+			*filter.PocketID, *filter.PocketID)
+	}
+	if filter.Period != "" {
+		q.where(`(e.budget_id IN (SELECT id FROM budgets WHERE period = ?)
+			OR e.id IN (SELECT s.expense_id FROM expense_splits s
+				JOIN budgets b ON b.id = s.budget_id WHERE b.period = ?))`,
+			filter.Period, filter.Period)
+	}
+	if filter.StartDate != nil {
+		q.where(`e.date >= ?`, *filter.StartDate)
+	}
+	if filter.EndDate != nil {
+		q.where(`e.date <= ?`, *filter.EndDate)
+	}
+	if filter.MinAmount != nil {
+		q.where(`e.amount >= ?`, *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		q.where(`e.amount <= ?`, *filter.MaxAmount)
+	}
+	if filter.Uncategorized {
+		// Still in the budget the line was imported into: a move by hand or by
+		// the rules since categorized it
+		q.where(`EXISTS (SELECT 1 FROM import_items it
+			WHERE it.expense_id = e.id AND it.rule_id IS NULL AND it.manual = 0 AND it.budget_id = e.budget_id)`)
+	}
+	if len(filter.Tags) > 0 {
+		args := make([]any, 0, len(filter.Tags)+1)
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
 		}
-		expenses = append(expenses, expense)
+		args = append(args, len(filter.Tags))
+		q.where(`e.id IN (
+			SELECT et.expense_id FROM expense_tags et JOIN tags t ON t.id = et.tag_id
+			WHERE t.name IN `+inList(len(filter.Tags))+`
+			GROUP BY et.expense_id HAVING COUNT(*) = ?
+		)`, args...)
 	}
-	return expenses, rows.Err()
+}
+
+func (r *ExpenseRepository) GetByBudgetID(ctx context.Context, budgetID int64) ([]*domain.Expense, error) {
+	return r.query(ctx,
+		`SELECT `+expenseColumns+` FROM expenses
+		 WHERE budget_id = ? OR id IN (SELECT expense_id FROM expense_splits WHERE budget_id = ?)
+		 ORDER BY date DESC, id DESC`, budgetID, budgetID)
 }
 
 func (r *ExpenseRepository) GetByDateRange(ctx context.Context, startDate, endDate time.Time) ([]*domain.Expense, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, budget_id, amount, description, date, created_at, updated_at
-		 FROM expenses WHERE date >= ? AND date <= ? ORDER BY date DESC, id DESC`,
+	return r.query(ctx,
+		`SELECT `+expenseColumns+` FROM expenses
+		 WHERE date >= ? AND date <= ? ORDER BY date DESC, id DESC`,
 		startDate, endDate)
+}
+
+// GetRefunds returns the refunds linked to an expense
+func (r *ExpenseRepository) GetRefunds(ctx context.Context, expenseID int64) ([]*domain.Expense, error) {
+	return r.query(ctx,
+		`SELECT `+expenseColumns+` FROM expenses
+		 WHERE refund_of_id = ? ORDER BY date, id`, expenseID)
+}
+
+// query runs a SELECT over expenseColumns and loads the details of the results
+func (r *ExpenseRepository) query(ctx context.Context, query string, args ...any) ([]*domain.Expense, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -110,22 +206,26 @@ func (r *ExpenseRepository) GetByDateRange(ctx context.Context, startDate, endDa
 
 	var expenses []*domain.Expense
 	for rows.Next() {
-		expense := &domain.Expense{}
-		if err := rows.Scan(&expense.ID, &expense.BudgetID, &expense.Amount,
-			&expense.Description, &expense.Date, &expense.CreatedAt, &expense.UpdatedAt); err != nil {
+		expense, err := scanExpense(rows)
+		if err != nil {
 			return nil, err
 		}
 		expenses = append(expenses, expense)
 	}
-	return expenses, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return expenses, r.loadDetails(ctx, expenses)
 }
 
 func (r *ExpenseRepository) Update(ctx context.Context, expense *domain.Expense) error {
 	expense.UpdatedAt = time.Now()
-	result, err := r.db.ExecContext(ctx,
-		`UPDATE expenses SET budget_id = ?, amount = ?, description = ?, date = ?, updated_at = ?
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE expenses SET budget_id = ?, payee_id = ?, amount = ?, description = ?, notes = ?, date = ?,
+		 categorized_by = ?, updated_at = ?
 		 WHERE id = ?`,
-		expense.BudgetID, expense.Amount, expense.Description, expense.Date, expense.UpdatedAt, expense.ID,
+		expense.BudgetID, expense.PayeeID, expense.Amount, expense.Description, expense.Notes, expense.Date,
+		expense.CategorizedBy, expense.UpdatedAt, expense.ID,
 	)
 	if err != nil {
 		return err
@@ -142,7 +242,20 @@ func (r *ExpenseRepository) Update(ctx context.Context, expense *domain.Expense)
 }
 
 func (r *ExpenseRepository) Delete(ctx context.Context, id int64) error {
-	result, err := r.db.ExecContext(ctx, `DELETE FROM expenses WHERE id = ?`, id)
+	for _, query := range []string{
+		`DELETE FROM expense_splits WHERE expense_id = ?`,
+		`DELETE FROM expense_tags WHERE expense_id = ?`,
+		`DELETE FROM expense_custom_values WHERE expense_id = ?`,
+		`UPDATE import_items SET expense_id = NULL WHERE expense_id = ?`,
+		`UPDATE import_items SET duplicate_of_id = NULL WHERE duplicate_of_id = ?`,
+		`DELETE FROM duplicate_dismissals WHERE ? IN (expense_id, other_id)`,
+	} {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM expenses WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
@@ -156,3 +269,260 @@ func (r *ExpenseRepository) Delete(ctx context.Context, id int64) error {
 	}
 	return nil
 }
+
+// ReplaceSplits deletes the existing lines of an expense and inserts the given ones
+func (r *ExpenseRepository) ReplaceSplits(ctx context.Context, expenseID int64, splits []domain.ExpenseSplit) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM expense_splits WHERE expense_id = ?`, expenseID); err != nil {
+		return err
+	}
+
+	for i := range splits {
+		splits[i].ExpenseID = expenseID
+		result, err := conn(ctx, r.db).ExecContext(ctx,
+			`INSERT INTO expense_splits (expense_id, budget_id, amount, description)
+			 VALUES (?, ?, ?, ?)`,
+			expenseID, splits[i].BudgetID, splits[i].Amount, splits[i].Description,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		splits[i].ID = id
+	}
+	return nil
+}
+
+// ReplaceTags sets the tags of an expense
+func (r *ExpenseRepository) ReplaceTags(ctx context.Context, expenseID int64, tagIDs []int64) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM expense_tags WHERE expense_id = ?`, expenseID); err != nil {
+		return err
+	}
+
+	for _, tagID := range tagIDs {
+		if _, err := conn(ctx, r.db).ExecContext(ctx,
+			`INSERT OR IGNORE INTO expense_tags (expense_id, tag_id) VALUES (?, ?)`,
+			expenseID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceCustomValues sets the custom field values of an expense, keyed by field ID
+func (r *ExpenseRepository) ReplaceCustomValues(ctx context.Context, expenseID int64, values map[int64]string) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM expense_custom_values WHERE expense_id = ?`, expenseID); err != nil {
+		return err
+	}
+
+	for fieldID, value := range values {
+		if _, err := conn(ctx, r.db).ExecContext(ctx,
+			`INSERT INTO expense_custom_values (expense_id, field_id, value) VALUES (?, ?, ?)`,
+			expenseID, fieldID, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detailBatchSize keeps IN lists well below SQLite's bound-variable limit
+const detailBatchSize = 500
+
+// loadDetails fills in split lines, tags and custom field values, batching the lookups
+func (r *ExpenseRepository) loadDetails(ctx context.Context, expenses []*domain.Expense) error {
+	for start := 0; start < len(expenses); start += detailBatchSize {
+		end := min(start+detailBatchSize, len(expenses))
+		if err := r.loadDetailBatch(ctx, expenses[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ExpenseRepository) loadDetailBatch(ctx context.Context, expenses []*domain.Expense) error {
+	byID := make(map[int64]*domain.Expense, len(expenses))
+	placeholders := make([]string, 0, len(expenses))
+	args := make([]any, 0, len(expenses))
+	for _, expense := range expenses {
+		byID[expense.ID] = expense
+		placeholders = append(placeholders, "?")
+		args = append(args, expense.ID)
+	}
+	in := `(` + strings.Join(placeholders, ",") + `)`
+
+	if err := r.loadSplitBatch(ctx, byID, in, args); err != nil {
+		return err
+	}
+	if err := r.loadTagBatch(ctx, byID, in, args); err != nil {
+		return err
+	}
+	return r.loadCustomValueBatch(ctx, byID, in, args)
+}
+
+func (r *ExpenseRepository) loadSplitBatch(ctx context.Context, byID map[int64]*domain.Expense, in string, args []any) error {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, expense_id, budget_id, amount, description
+		 FROM expense_splits WHERE expense_id IN `+in+` ORDER BY id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var split domain.ExpenseSplit
+		if err := rows.Scan(&split.ID, &split.ExpenseID, &split.BudgetID,
+			&split.Amount, &split.Description); err != nil {
+			return err
+		}
+		if expense, ok := byID[split.ExpenseID]; ok {
+			expense.Splits = append(expense.Splits, split)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *ExpenseRepository) loadTagBatch(ctx context.Context, byID map[int64]*domain.Expense, in string, args []any) error {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT et.expense_id, t.name
+		 FROM expense_tags et JOIN tags t ON t.id = et.tag_id
+		 WHERE et.expense_id IN `+in+` ORDER BY t.name`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var expenseID int64
+		var name string
+		if err := rows.Scan(&expenseID, &name); err != nil {
+			return err
+		}
+		if expense, ok := byID[expenseID]; ok {
+			expense.Tags = append(expense.Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *ExpenseRepository) loadCustomValueBatch(ctx context.Context, byID map[int64]*domain.Expense, in string, args []any) error {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT v.expense_id, f.name, f.type, v.value
+		 FROM expense_custom_values v JOIN custom_fields f ON f.id = v.field_id
+		 WHERE v.expense_id IN `+in, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var expenseID int64
+		var name, value string
+		var fieldType domain.CustomFieldType
+		if err := rows.Scan(&expenseID, &name, &fieldType, &value); err != nil {
+			return err
+		}
+		if expense, ok := byID[expenseID]; ok {
+			if expense.CustomFields == nil {
+				expense.CustomFields = make(map[string]any)
+			}
+			expense.CustomFields[name] = fieldType.Decode(value)
+		}
+	}
+	return rows.Err()
+}
+
+// Search ranks expenses against the filter's text, using the FTS5 index when the
+// SQLite build provides it and LIKE matching otherwise. Sorting and cursors do not apply.
+func (r *ExpenseRepository) Search(ctx context.Context, filter domain.ExpenseFilter) ([]domain.ExpenseSearchResult, error) {
+	terms := searchTerms(filter.Text)
+	if len(terms) == 0 {
+		return nil, domain.ErrInvalidInput
+	}
+
+	var indexed int
+	if err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'expenses_fts_insert'`,
+	).Scan(&indexed); err != nil {
+		return nil, err
+	}
+
+	q := &listQuery{}
+	if indexed > 0 {
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + term + `"*`
+		}
+		q.where(`expenses_fts MATCH ?`, strings.Join(quoted, " "))
+	} else {
+		for _, term := range terms {
+			pattern := "%" + term + "%"
+			q.where(`(e.description LIKE ? OR e.notes LIKE ?
+				OR e.payee_id IN (SELECT id FROM payees WHERE name LIKE ?))`, pattern, pattern, pattern)
+		}
+	}
+	applyExpenseFilter(q, filter)
+
+	var query string
+	if indexed > 0 {
+		// Descriptions weigh most, then payee names, then notes
+		query = `SELECT e.id, bm25(expenses_fts, 10.0, 2.0, 5.0) AS rank,
+		        snippet(expenses_fts, -1, '<mark>', '</mark>', '…', 12)
+		 FROM expenses_fts JOIN expenses e ON e.id = expenses_fts.rowid` + q.whereClause() + `
+		 ORDER BY rank, e.date DESC, e.id DESC LIMIT ?`
+	} else {
+		query = `SELECT e.id, 0, e.description FROM expenses e` + q.whereClause() + `
+		 ORDER BY e.date DESC, e.id DESC LIMIT ?`
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, append(q.args, filter.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []domain.ExpenseSearchResult
+	var ids []any
+	for rows.Next() {
+		var id int64
+		var result domain.ExpenseSearchResult
+		if err := rows.Scan(&id, &result.Rank, &result.Snippet); err != nil {
+			return nil, err
+		}
+		result.Expense = &domain.Expense{ID: id}
+		results = append(results, result)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	expenses, err := r.query(ctx,
+		`SELECT `+expenseColumns+` FROM expenses WHERE id IN `+inList(len(ids)), ids...)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*domain.Expense, len(expenses))
+	for _, expense := range expenses {
+		byID[expense.ID] = expense
+	}
+	for i := range results {
+		results[i].Expense = byID[results[i].Expense.ID]
+	}
+	return results, nil
+}
+
+// searchTerms splits a search query into words, dropping FTS5 syntax characters
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// importSelect reads imports with the tally of their items, for scanImport
+const importSelect = `SELECT i.id, i.user_id, i.bank, i.file_name, i.status, i.created_at,
+	COUNT(it.id),
+	COUNT(CASE WHEN it.status = 'pending' THEN 1 END),
+	COUNT(CASE WHEN it.status = 'pending' AND it.budget_id IS NULL
+		AND NOT EXISTS (SELECT 1 FROM import_item_splits s WHERE s.item_id = it.id) THEN 1 END),
+	COUNT(CASE WHEN it.status = 'imported' THEN 1 END),
+	COUNT(CASE WHEN it.status = 'ignored' THEN 1 END),
+	COUNT(CASE WHEN it.status = 'duplicate' THEN 1 END),
+	COUNT(CASE WHEN it.status = 'skipped' THEN 1 END)
+	FROM imports i LEFT JOIN import_items it ON it.import_id = i.id`
+
+// importItemColumns is the column list read by scanImportItem
+const importItemColumns = `id, import_id, line, date, description, amount, direction, reference,
+	account, fingerprint, status, budget_id, rule_id, confidence, duplicate_of_id, expense_id, message, manual,
+	COALESCE(categorized_by, '')`
+
+type ImportRepository struct {
+	db *sql.DB
+}
+
+func NewImportRepository(db *sql.DB) *ImportRepository {
+	return &ImportRepository{db: db}
+}
+
+func (r *ImportRepository) Create(ctx context.Context, imp *domain.Import) error {
+	now := time.Now()
+	imp.Status = domain.ImportStaged
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO imports (user_id, bank, file_name, status, created_at) VALUES (?, ?, ?, ?, ?)`,
+		imp.UserID, imp.Bank, imp.FileName, imp.Status, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	imp.ID = id
+	imp.CreatedAt = now
+	return nil
+}
+
+func (r *ImportRepository) GetByID(ctx context.Context, id int64) (*domain.Import, error) {
+	imp, err := scanImport(conn(ctx, r.db).QueryRowContext(ctx,
+		importSelect+` WHERE i.id = ? GROUP BY i.id`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// List returns every import, newest first
+func (r *ImportRepository) List(ctx context.Context) ([]*domain.Import, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		importSelect+` GROUP BY i.id ORDER BY i.created_at DESC, i.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var imports []*domain.Import
+	for rows.Next() {
+		imp, err := scanImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, imp)
+	}
+	return imports, rows.Err()
+}
+
+func (r *ImportRepository) SetStatus(ctx context.Context, id int64, status domain.ImportStatus) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE imports SET status = ? WHERE id = ?`, status, id)
+	return err
+}
+
+func (r *ImportRepository) CreateItem(ctx context.Context, item *domain.ImportItem) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO import_items (import_id, line, date, description, amount, direction, reference,
+		 account, fingerprint, status, budget_id, rule_id, confidence, duplicate_of_id, expense_id, message, categorized_by)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		item.ImportID, item.Line, item.Date, item.Description, item.Amount, item.Direction, item.Reference,
+		item.Account, item.Fingerprint, item.Status, item.BudgetID, item.RuleID, item.Confidence, item.DuplicateOfID,
+		item.ExpenseID, item.Message, item.CategorizedBy,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	item.ID = id
+	return nil
+}
+
+// UpdateItem stores the review state of an item; splits are stored by ReplaceItemSplits
+func (r *ImportRepository) UpdateItem(ctx context.Context, item *domain.ImportItem) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE import_items SET description = ?, status = ?, budget_id = ?, rule_id = ?, confidence = ?,
+		 expense_id = ?, message = ?, manual = ?, categorized_by = ?
+		 WHERE id = ?`,
+		item.Description, item.Status, item.BudgetID, item.RuleID, item.Confidence, item.ExpenseID, item.Message,
+		item.Manual, item.CategorizedBy, item.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// ReplaceItemSplits deletes the split lines of an item and inserts the given ones
+func (r *ImportRepository) ReplaceItemSplits(ctx context.Context, itemID int64, splits []domain.ExpenseSplitRequest) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM import_item_splits WHERE item_id = ?`, itemID); err != nil {
+		return err
+	}
+	for _, split := range splits {
+		if _, err := conn(ctx, r.db).ExecContext(ctx,
+			`INSERT INTO import_item_splits (item_id, budget_id, amount, description) VALUES (?, ?, ?, ?)`,
+			itemID, split.BudgetID, split.Amount, split.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetItem returns an item of an import with its split lines
+func (r *ImportRepository) GetItem(ctx context.Context, importID, itemID int64) (*domain.ImportItem, error) {
+	item, err := scanImportItem(conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT `+importItemColumns+` FROM import_items WHERE id = ? AND import_id = ?`, itemID, importID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	splits, err := r.getSplits(ctx, `s.item_id = ?`, itemID)
+	if err != nil {
+		return nil, err
+	}
+	item.Splits = splits[item.ID]
+	return item, nil
+}
+
+// GetItems returns the items of an import in statement order, with their split lines
+func (r *ImportRepository) GetItems(ctx context.Context, importID int64, filter domain.ImportItemFilter) ([]domain.ImportItem, error) {
+	query := `SELECT ` + importItemColumns + ` FROM import_items WHERE import_id = ?`
+	args := []any{importID}
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query+` ORDER BY line`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []domain.ImportItem
+	for rows.Next() {
+		item, err := scanImportItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	splits, err := r.getSplits(ctx, `i.import_id = ?`, importID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Splits = splits[items[i].ID]
+	}
+	return items, nil
+}
+
+// getSplits returns the split lines of the items matching where, keyed by item
+func (r *ImportRepository) getSplits(ctx context.Context, where string, args ...any) (map[int64][]domain.ExpenseSplitRequest, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT s.item_id, s.budget_id, s.amount, s.description
+		 FROM import_item_splits s JOIN import_items i ON i.id = s.item_id
+		 WHERE `+where+` ORDER BY s.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	splits := make(map[int64][]domain.ExpenseSplitRequest)
+	for rows.Next() {
+		var itemID int64
+		var split domain.ExpenseSplitRequest
+		if err := rows.Scan(&itemID, &split.BudgetID, &split.Amount, &split.Description); err != nil {
+			return nil, err
+		}
+		splits[itemID] = append(splits[itemID], split)
+	}
+	return splits, rows.Err()
+}
+
+// IsStaged reports whether a transaction with the fingerprint awaits review, was
+// ignored, or was imported and its expense still exists
+func (r *ImportRepository) IsStaged(ctx context.Context, fingerprint string) (bool, error) {
+	var exists bool
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM import_items WHERE fingerprint = ?
+		 AND (status IN ('pending', 'ignored') OR (status = 'imported' AND expense_id IS NOT NULL)))`,
+		fingerprint,
+	).Scan(&exists)
+	return exists, err
+}
+
+// SetAccount maps an account to a pocket, replacing any earlier mapping
+func (r *ImportRepository) SetAccount(ctx context.Context, account *domain.ImportAccount) error {
+	now := time.Now()
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`INSERT INTO import_accounts (bank, account, pocket_id, created_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (bank, account) DO UPDATE SET pocket_id = excluded.pocket_id
+		 RETURNING id, created_at`,
+		account.Bank, account.Account, account.PocketID, now,
+	).Scan(&account.ID, &account.CreatedAt)
+	return err
+}
+
+func (r *ImportRepository) ListAccounts(ctx context.Context) ([]domain.ImportAccount, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, bank, account, pocket_id, created_at FROM import_accounts ORDER BY bank, account`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []domain.ImportAccount
+	for rows.Next() {
+		var account domain.ImportAccount
+		if err := rows.Scan(&account.ID, &account.Bank, &account.Account,
+			&account.PocketID, &account.CreatedAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// GetAccountPocket returns the pocket an account is mapped to, or nil
+func (r *ImportRepository) GetAccountPocket(ctx context.Context, bank, account string) (*int64, error) {
+	var pocketID int64
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT pocket_id FROM import_accounts WHERE bank = ? AND account = ?`, bank, account,
+	).Scan(&pocketID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pocketID, nil
+}
+
+func (r *ImportRepository) DeleteAccount(ctx context.Context, id int64) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM import_accounts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func scanImport(row rowScanner) (*domain.Import, error) {
+	imp := &domain.Import{}
+	err := row.Scan(&imp.ID, &imp.UserID, &imp.Bank, &imp.FileName, &imp.Status, &imp.CreatedAt,
+		&imp.Total, &imp.Pending, &imp.Uncategorized, &imp.Imported, &imp.Ignored, &imp.Duplicates, &imp.Skipped)
+	return imp, err
+}
+
+func scanImportItem(row rowScanner) (*domain.ImportItem, error) {
+	item := &domain.ImportItem{}
+	err := row.Scan(&item.ID, &item.ImportID, &item.Line, &item.Date, &item.Description,
+		&item.Amount, &item.Direction, &item.Reference, &item.Account, &item.Fingerprint, &item.Status,
+		&item.BudgetID, &item.RuleID, &item.Confidence, &item.DuplicateOfID, &item.ExpenseID, &item.Message,
+		&item.Manual, &item.CategorizedBy)
+	return item, err
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// timestampFormat is how go-sqlite3 stores time.Time values, so cursor values
+// compare exactly like the stored columns
+const timestampFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// listQuery accumulates the WHERE clause of a list query
+type listQuery struct {
+	conditions []string
+	args       []any
+}
+
+func (q *listQuery) where(condition string, args ...any) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+func (q *listQuery) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return ` WHERE ` + strings.Join(q.conditions, " AND ")
+}
+
+// inList returns "(?, ?, ...)" with one placeholder per value
+func inList(n int) string {
+	return `(?` + strings.Repeat(", ?", n-1) + `)`
+}
+
+// sortKey is a column a list can be ordered by, with the accessor that reads
+// its value back from a result to build the next cursor
+type sortKey[T any] struct {
+	column string
+	value  func(T) any
+}
+
+// listSpec describes the sortable columns of one kind of list. Every spec
+// has an "id" key, which breaks ties so that cursors are stable.
+type listSpec[T any] struct {
+	keys        map[string]sortKey[T]
+	defaultSort []domain.SortField
+}
+
+// listCursor is the decoded form of a next_cursor
+type listCursor struct {
+	Sort   string `json:"s"`
+	Values []any  `json:"v"`
+}
+
+// fields resolves the requested sort, falling back to the default and
+// appending the id tie-breaker in the direction of the last field
+func (s listSpec[T]) fields(sort []domain.SortField) ([]domain.SortField, error) {
+	if len(sort) == 0 {
+		sort = s.defaultSort
+	}
+
+	fields := make([]domain.SortField, 0, len(sort)+1)
+	for _, field := range sort {
+		if _, ok := s.keys[field.Field]; !ok {
+			return nil, domain.ErrInvalidInput
+		}
+		fields = append(fields, field)
+		if field.Field == "id" {
+			return fields, nil
+		}
+	}
+	return append(fields, domain.SortField{Field: "id", Desc: sort[len(sort)-1].Desc}), nil
+}
+
+// order adds the position of the cursor to q and returns the ORDER BY and LIMIT
+// clauses. One row more than the limit is fetched to detect a following page.
+func (s listSpec[T]) order(q *listQuery, opts domain.ListOptions) (string, error) {
+	fields, err := s.fields(opts.Sort)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Cursor != "" {
+		values, err := decodeCursor(opts.Cursor, sortSignature(fields))
+		if err != nil || len(values) != len(fields) {
+			return "", domain.ErrInvalidInput
+		}
+
+		// Rows after the cursor: the first differing sort column decides
+		var alternatives []string
+		var args []any
+		for i, field := range fields {
+			var parts []string
+			for j := 0; j < i; j++ {
+				parts = append(parts, s.keys[fields[j].Field].column+` = ?`)
+				args = append(args, values[j])
+			}
+			op := ` > ?`
+			if field.Desc {
+				op = ` < ?`
+			}
+			parts = append(parts, s.keys[field.Field].column+op)
+			args = append(args, values[i])
+			alternatives = append(alternatives, `(`+strings.Join(parts, " AND ")+`)`)
+		}
+		q.where(`(`+strings.Join(alternatives, " OR ")+`)`, args...)
+	}
+
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = s.keys[field.Field].column
+		if field.Desc {
+			columns[i] += ` DESC`
+		}
+	}
+
+	clause := ` ORDER BY ` + strings.Join(columns, ", ")
+	if opts.Limit > 0 {
+		clause += ` LIMIT ` + strconv.Itoa(opts.Limit+1)
+	}
+	return clause, nil
+}
+
+// page drops the lookahead row fetched by order and encodes the cursor of the next page
+func (s listSpec[T]) page(items []T, opts domain.ListOptions) (*domain.Page[T], error) {
+	if items == nil {
+		items = []T{}
+	}
+	if opts.Limit <= 0 || len(items) <= opts.Limit {
+		return &domain.Page[T]{Items: items}, nil
+	}
+
+	items = items[:opts.Limit]
+	fields, err := s.fields(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	last := items[len(items)-1]
+	values := make([]any, len(fields))
+	for i, field := range fields {
+		value := s.keys[field.Field].value(last)
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(timestampFormat)
+		}
+		values[i] = value
+	}
+
+	cursor, err := encodeCursor(sortSignature(fields), values)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Page[T]{Items: items, NextCursor: cursor}, nil
+}
+
+// sortSignature ties a cursor to the sort it was created for
+func sortSignature(fields []domain.SortField) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field.Field
+		if field.Desc {
+			parts[i] = "-" + field.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func encodeCursor(signature string, values []any) (string, error) {
+	data, err := json.Marshal(listCursor{Sort: signature, Values: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor, signature string) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded listCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	if decoded.Sort != signature {
+		return nil, domain.ErrInvalidInput
+	}
+	return decoded.Values, nil
+}
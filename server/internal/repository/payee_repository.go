@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+type PayeeRepository struct {
+	db *sql.DB
+}
+
+func NewPayeeRepository(db *sql.DB) *PayeeRepository {
+	return &PayeeRepository{db: db}
+}
+
+func (r *PayeeRepository) Create(ctx context.Context, payee *domain.Payee) error {
+	now := time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO payees (name, default_category, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		payee.Name, payee.DefaultCategory, now, now,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return domain.ErrDuplicateEntry
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	payee.ID = id
+	payee.CreatedAt = now
+	payee.UpdatedAt = now
+	return nil
+}
+
+func (r *PayeeRepository) GetByID(ctx context.Context, id int64) (*domain.Payee, error) {
+	payee := &domain.Payee{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, name, default_category, created_at, updated_at FROM payees WHERE id = ?`, id,
+	).Scan(&payee.ID, &payee.Name, &payee.DefaultCategory, &payee.CreatedAt, &payee.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return payee, nil
+}
+
+func (r *PayeeRepository) GetAll(ctx context.Context) ([]*domain.Payee, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, name, default_category, created_at, updated_at FROM payees ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payees []*domain.Payee
+	for rows.Next() {
+		payee := &domain.Payee{}
+		if err := rows.Scan(&payee.ID, &payee.Name, &payee.DefaultCategory,
+			&payee.CreatedAt, &payee.UpdatedAt); err != nil {
+			return nil, err
+		}
+		payees = append(payees, payee)
+	}
+	return payees, rows.Err()
+}
+
+func (r *PayeeRepository) Update(ctx context.Context, payee *domain.Payee) error {
+	payee.UpdatedAt = time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE payees SET name = ?, default_category = ?, updated_at = ? WHERE id = ?`,
+		payee.Name, payee.DefaultCategory, payee.UpdatedAt, payee.ID,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return domain.ErrDuplicateEntry
+		}
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a payee and its rules, unlinking its expenses
+func (r *PayeeRepository) Delete(ctx context.Context, id int64) error {
+	for _, query := range []string{
+		`UPDATE expenses SET payee_id = NULL WHERE payee_id = ?`,
+		`DELETE FROM payee_rules WHERE payee_id = ?`,
+	} {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM payees WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// Merge moves the expenses and rules of the source payees to the target and deletes the sources
+func (r *PayeeRepository) Merge(ctx context.Context, targetID int64, sourceIDs []int64) error {
+	for _, sourceID := range sourceIDs {
+		for _, query := range []string{
+			`UPDATE expenses SET payee_id = ? WHERE payee_id = ?`,
+			`UPDATE payee_rules SET payee_id = ? WHERE payee_id = ?`,
+		} {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, query, targetID, sourceID); err != nil {
+				return err
+			}
+		}
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx,
+			`DELETE FROM payees WHERE id = ?`, sourceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PayeeRepository) CreateRule(ctx context.Context, rule *domain.PayeeRule) error {
+	now := time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO payee_rules (payee_id, match_type, pattern, priority, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		rule.PayeeID, rule.MatchType, rule.Pattern, rule.Priority, now, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	rule.ID = id
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	return nil
+}
+
+func (r *PayeeRepository) GetRulesByPayeeID(ctx context.Context, payeeID int64) ([]domain.PayeeRule, error) {
+	return r.queryRules(ctx,
+		`SELECT id, payee_id, match_type, pattern, priority, created_at, updated_at
+		 FROM payee_rules WHERE payee_id = ? ORDER BY priority DESC, id ASC`, payeeID)
+}
+
+// GetAllRules returns every rule in evaluation order
+func (r *PayeeRepository) GetAllRules(ctx context.Context) ([]domain.PayeeRule, error) {
+	return r.queryRules(ctx,
+		`SELECT id, payee_id, match_type, pattern, priority, created_at, updated_at
+		 FROM payee_rules ORDER BY priority DESC, id ASC`)
+}
+
+func (r *PayeeRepository) queryRules(ctx context.Context, query string, args ...any) ([]domain.PayeeRule, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []domain.PayeeRule
+	for rows.Next() {
+		var rule domain.PayeeRule
+		if err := rows.Scan(&rule.ID, &rule.PayeeID, &rule.MatchType, &rule.Pattern,
+			&rule.Priority, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *PayeeRepository) DeleteRule(ctx context.Context, id int64) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM payee_rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// GetUnlinkedExpenses returns the IDs and descriptions of expenses without a payee
+func (r *PayeeRepository) GetUnlinkedExpenses(ctx context.Context) (map[int64]string, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, description FROM expenses WHERE payee_id IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expenses := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var description string
+		if err := rows.Scan(&id, &description); err != nil {
+			return nil, err
+		}
+		expenses[id] = description
+	}
+	return expenses, rows.Err()
+}
+
+func (r *PayeeRepository) LinkExpense(ctx context.Context, expenseID, payeeID int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE expenses SET payee_id = ? WHERE id = ?`, payeeID, expenseID)
+	return err
+}
+
+func (r *PayeeRepository) GetStats(ctx context.Context, payee *domain.Payee) (*domain.PayeeStats, error) {
+	stats := &domain.PayeeStats{
+		PayeeID: payee.ID,
+		Name:    payee.Name,
+		Monthly: []domain.PayeeMonthlyStat{},
+	}
+
+	var firstDate, lastDate sql.NullString
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(CASE WHEN type = 'refund' THEN 0 ELSE 1 END), 0),
+		        COALESCE(SUM(CASE WHEN type = 'refund' THEN 0 ELSE amount END), 0),
+		        COALESCE(SUM(CASE WHEN type = 'refund' THEN amount ELSE 0 END), 0),
+		        MIN(date), MAX(date)
+		 FROM expenses WHERE payee_id = ?`, payee.ID,
+	).Scan(&stats.ExpenseCount, &stats.TotalSpent, &stats.TotalRefunds, &firstDate, &lastDate)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.ExpenseCount > 0 {
+		stats.AverageAmount = stats.TotalSpent / float64(stats.ExpenseCount)
+	}
+	stats.FirstDate = dayPart(firstDate.String)
+	stats.LastDate = dayPart(lastDate.String)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT strftime('%Y-%m', date) AS month, COUNT(*), COALESCE(SUM(amount), 0)
+		 FROM expenses WHERE payee_id = ? AND type != 'refund'
+		 GROUP BY month ORDER BY month`, payee.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stat domain.PayeeMonthlyStat
+		if err := rows.Scan(&stat.Month, &stat.ExpenseCount, &stat.TotalSpent); err != nil {
+			return nil, err
+		}
+		stats.Monthly = append(stats.Monthly, stat)
+	}
+	return stats, rows.Err()
+}
+
+// dayPart trims a stored timestamp to its "2006-01-02" date
+func dayPart(value string) string {
+	if len(value) > 10 {
+		return value[:10]
+	}
+	return value
+}
@@ -19,7 +19,7 @@ func NewPocketRepository(db *sql.DB) *PocketRepository {
 
 func (r *PocketRepository) Create(ctx context.Context, pocket *domain.Pocket) error {
 	now := time.Now()
-	result, err := r.db.ExecContext(ctx,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`INSERT INTO pockets (name, description, balance, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?)`,
 		pocket.Name, pocket.Description, pocket.Balance, now, now,
@@ -41,7 +41,7 @@ func (r *PocketRepository) Create(ctx context.Context, pocket *domain.Pocket) er
 
 func (r *PocketRepository) GetByID(ctx context.Context, id int64) (*domain.Pocket, error) {
 	pocket := &domain.Pocket{}
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`SELECT id, name, description, balance, created_at, updated_at
 		 FROM pockets WHERE id = ?`, id,
 	).Scan(&pocket.ID, &pocket.Name, &pocket.Description, &pocket.Balance,
@@ -57,7 +57,7 @@ func (r *PocketRepository) GetByID(ctx context.Context, id int64) (*domain.Pocke
 }
 
 func (r *PocketRepository) GetAll(ctx context.Context) ([]*domain.Pocket, error) {
-	rows, err := r.db.QueryContext(ctx,
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
 		`SELECT id, name, description, balance, created_at, updated_at
 		 FROM pockets ORDER BY name`)
 	if err != nil {
@@ -79,7 +79,7 @@ func (r *PocketRepository) GetAll(ctx context.Context) ([]*domain.Pocket, error)
 
 func (r *PocketRepository) Update(ctx context.Context, pocket *domain.Pocket) error {
 	pocket.UpdatedAt = time.Now()
-	result, err := r.db.ExecContext(ctx,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`UPDATE pockets SET name = ?, description = ?, balance = ?, updated_at = ?
 		 WHERE id = ?`,
 		pocket.Name, pocket.Description, pocket.Balance, pocket.UpdatedAt, pocket.ID,
@@ -101,7 +101,7 @@ func (r *PocketRepository) Update(ctx context.Context, pocket *domain.Pocket) er
 func (r *PocketRepository) Delete(ctx context.Context, id int64) error {
 	// Check if pocket has budgets
 	var count int
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`SELECT COUNT(*) FROM budgets WHERE pocket_id = ?`, id,
 	).Scan(&count)
 	if err != nil {
@@ -111,7 +111,16 @@ func (r *PocketRepository) Delete(ctx context.Context, id int64) error {
 		return domain.ErrPocketHasBudgets
 	}
 
-	result, err := r.db.ExecContext(ctx, `DELETE FROM pockets WHERE id = ?`, id)
+	for _, query := range []string{
+		`DELETE FROM pocket_snapshots WHERE pocket_id = ?`,
+		`DELETE FROM import_accounts WHERE pocket_id = ?`,
+	} {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM pockets WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
@@ -127,7 +136,7 @@ func (r *PocketRepository) Delete(ctx context.Context, id int64) error {
 }
 
 func (r *PocketRepository) UpdateBalance(ctx context.Context, id int64, amount float64) error {
-	result, err := r.db.ExecContext(ctx,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`UPDATE pockets SET balance = balance + ?, updated_at = ? WHERE id = ?`,
 		amount, time.Now(), id,
 	)
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// netAmount is the spending of an expense line, negative for refunds
+const netAmount = `CASE WHEN l.type = 'refund' THEN -l.amount ELSE l.amount END`
+
+// spendingTotals sums the lines of a group into net spending, spending before
+// refunds and refunds, in that order
+const spendingTotals = `SUM(` + netAmount + `),
+	SUM(CASE WHEN l.type != 'refund' THEN l.amount ELSE 0 END),
+	SUM(CASE WHEN l.type = 'refund' THEN l.amount ELSE 0 END)`
+
+// spendingCount counts the expenses, not refunds, behind a group of lines
+const spendingCount = `COUNT(DISTINCT CASE WHEN l.type != 'refund' THEN l.expense_id END)`
+
+// seriesBuckets maps each granularity to the first day of a line's bucket
+var seriesBuckets = map[domain.SeriesGranularity]string{
+	domain.GranularityDay:   `substr(l.date, 1, 10)`,
+	domain.GranularityWeek:  `date(substr(l.date, 1, 10), '-6 days', 'weekday 1')`,
+	domain.GranularityMonth: `substr(l.date, 1, 7) || '-01'`,
+}
+
+type ReportRepository struct {
+	db *sql.DB
+}
+
+func NewReportRepository(db *sql.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+// lines returns the WHERE clause and arguments selecting the expense lines of a report
+func (r *ReportRepository) lines(filter domain.ReportFilter) (string, []any) {
+	where := `l.date >= ? AND l.date <= ?`
+	args := []any{filter.StartDate, filter.EndDate}
+	if filter.PocketID != nil {
+		where += ` AND b.pocket_id = ?`
+		args = append(args, *filter.PocketID)
+	}
+	return where, args
+}
+
+// SpendingByCategory totals spending per budget name, largest first
+func (r *ReportRepository) SpendingByCategory(ctx context.Context, filter domain.ReportFilter) ([]domain.CategoryTotal, error) {
+	where, args := r.lines(filter)
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`WITH `+expenseLinesCTE+`
+		 SELECT b.name, `+spendingTotals+`, `+spendingCount+`
+		 FROM expense_lines l
+		 JOIN budgets b ON b.id = l.budget_id
+		 WHERE `+where+`
+		 GROUP BY b.name
+		 ORDER BY 2 DESC, b.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []domain.CategoryTotal
+	for rows.Next() {
+		var total domain.CategoryTotal
+		if err := rows.Scan(&total.Category, &total.Total, &total.GrossSpent, &total.TotalRefunds, &total.ExpenseCount); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+// MonthlyByCategory totals spending per budget name and calendar month
+func (r *ReportRepository) MonthlyByCategory(ctx context.Context, filter domain.ReportFilter) ([]domain.CategoryMonthTotal, error) {
+	where, args := r.lines(filter)
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`WITH `+expenseLinesCTE+`
+		 SELECT b.name, substr(l.date, 1, 7) AS month, `+spendingTotals+`
+		 FROM expense_lines l
+		 JOIN budgets b ON b.id = l.budget_id
+		 WHERE `+where+`
+		 GROUP BY b.name, month
+		 ORDER BY b.name, month`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []domain.CategoryMonthTotal
+	for rows.Next() {
+		var total domain.CategoryMonthTotal
+		if err := rows.Scan(&total.Category, &total.Month, &total.Total, &total.GrossSpent, &total.TotalRefunds); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+// Variance compares the allocation of each budget in a period with its spending
+func (r *ReportRepository) Variance(ctx context.Context, period string, pocketID *int64) ([]domain.BudgetVariance, error) {
+	where := `period = ?`
+	args := []any{period}
+	if pocketID != nil {
+		where += ` AND pocket_id = ?`
+		args = append(args, *pocketID)
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, name, pocket_id, allocated_amount, spent_amount,
+		        allocated_amount - spent_amount,
+		        CASE WHEN allocated_amount > 0 THEN spent_amount * 100.0 / allocated_amount ELSE 0 END
+		 FROM budgets
+		 WHERE `+where+`
+		 ORDER BY allocated_amount - spent_amount, name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variances []domain.BudgetVariance
+	for rows.Next() {
+		var variance domain.BudgetVariance
+		if err := rows.Scan(&variance.BudgetID, &variance.Name, &variance.PocketID,
+			&variance.AllocatedAmount, &variance.SpentAmount,
+			&variance.Variance, &variance.PercentUsed); err != nil {
+			return nil, err
+		}
+		variances = append(variances, variance)
+	}
+	return variances, rows.Err()
+}
+
+// TopPayees returns the payees with the highest spending, largest first
+func (r *ReportRepository) TopPayees(ctx context.Context, filter domain.ReportFilter, limit int) ([]domain.PayeeTotal, error) {
+	where, args := r.lines(filter)
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`WITH `+expenseLinesCTE+`
+		 SELECT p.id, p.name, `+spendingTotals+`, `+spendingCount+`
+		 FROM expense_lines l
+		 JOIN budgets b ON b.id = l.budget_id
+		 JOIN expenses e ON e.id = l.expense_id
+		 JOIN payees p ON p.id = e.payee_id
+		 WHERE `+where+`
+		 GROUP BY p.id, p.name
+		 ORDER BY 3 DESC, p.name
+		 LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []domain.PayeeTotal
+	for rows.Next() {
+		var total domain.PayeeTotal
+		if err := rows.Scan(&total.PayeeID, &total.Name, &total.Total, &total.GrossSpent, &total.TotalRefunds, &total.ExpenseCount); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+// Series totals spending per day, week or month. Buckets without spending are omitted.
+func (r *ReportRepository) Series(ctx context.Context, filter domain.ReportFilter, granularity domain.SeriesGranularity) ([]domain.SeriesPoint, error) {
+	bucket, ok := seriesBuckets[granularity]
+	if !ok {
+		return nil, domain.ErrInvalidInput
+	}
+
+	where, args := r.lines(filter)
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`WITH `+expenseLinesCTE+`
+		 SELECT `+bucket+` AS bucket, `+spendingTotals+`, `+spendingCount+`
+		 FROM expense_lines l
+		 JOIN budgets b ON b.id = l.budget_id
+		 WHERE `+where+`
+		 GROUP BY bucket
+		 ORDER BY bucket`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []domain.SeriesPoint
+	for rows.Next() {
+		var point domain.SeriesPoint
+		if err := rows.Scan(&point.Date, &point.Total, &point.GrossSpent, &point.TotalRefunds, &point.ExpenseCount); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+const sessionColumns = `id, user_id, created_at, revoked_at, device_name, platform, ip_address, user_agent, last_seen_at`
+
+func scanSession(row rowScanner) (*domain.Session, error) {
+	session := &domain.Session{}
+	var lastSeenAt *time.Time
+	err := row.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.RevokedAt,
+		&session.DeviceName, &session.Platform, &session.IPAddress, &session.UserAgent, &lastSeenAt)
+	// Sessions opened before last_seen_at was recorded were last seen at creation
+	session.LastSeenAt = session.CreatedAt
+	if lastSeenAt != nil {
+		session.LastSeenAt = *lastSeenAt
+	}
+	return session, err
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	now := time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO sessions (user_id, device_name, platform, ip_address, user_agent, created_at, last_seen_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, session.DeviceName, session.Platform, session.IPAddress, session.UserAgent, now, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	session.ID = id
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	return nil
+}
+
+func (r *SessionRepository) GetByID(ctx context.Context, id int64) (*domain.Session, error) {
+	session, err := scanSession(conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListActiveByUserID returns the sessions of a user that were not revoked and
+// still hold a refresh token valid at now, most recently seen first
+func (r *SessionRepository) ListActiveByUserID(ctx context.Context, userID int64, now time.Time) ([]domain.Session, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions s
+		 WHERE user_id = ? AND revoked_at IS NULL
+		   AND EXISTS (SELECT 1 FROM refresh_tokens t
+		               WHERE t.session_id = s.id AND t.used_at IS NULL AND t.expires_at > ?)
+		 ORDER BY COALESCE(last_seen_at, created_at) DESC, id DESC`, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []domain.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch records that a session was just used, from the given address and
+// user agent
+func (r *SessionRepository) Touch(ctx context.Context, id int64, client domain.SessionClient, at time.Time) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE sessions SET last_seen_at = ?, ip_address = ?, user_agent = ? WHERE id = ?`,
+		at, client.IPAddress, client.UserAgent, id)
+	return err
+}
+
+// Revoke ends a session, reporting false when it had already ended
+func (r *SessionRepository) Revoke(ctx context.Context, id int64) (bool, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// RevokeAllByUserID ends every session of a user, returning how many were open
+func (r *SessionRepository) RevokeAllByUserID(ctx context.Context, userID int64) (int64, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *SessionRepository) CreateRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+	now := time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO refresh_tokens (session_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		token.SessionID, token.TokenHash, token.ExpiresAt, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	token.ID = id
+	token.CreatedAt = now
+	return nil
+}
+
+func (r *SessionRepository) GetRefreshToken(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	token := &domain.RefreshToken{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, session_id, token_hash, expires_at, used_at, created_at
+		 FROM refresh_tokens WHERE token_hash = ?`, hash,
+	).Scan(&token.ID, &token.SessionID, &token.TokenHash, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// UseRefreshToken marks a refresh token exchanged, reporting false when it
+// already was, so that of two requests racing with one token only one wins
+func (r *SessionRepository) UseRefreshToken(ctx context.Context, id int64) (bool, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// snapshotValues selects the current state of each pocket p as snapshot columns
+const snapshotValues = `p.id, ?, p.balance,
+	COALESCE((SELECT SUM(b.allocated_amount - b.spent_amount) FROM budgets b WHERE b.pocket_id = p.id), 0),
+	?, ?`
+
+type SnapshotRepository struct {
+	db *sql.DB
+}
+
+func NewSnapshotRepository(db *sql.DB) *SnapshotRepository {
+	return &SnapshotRepository{db: db}
+}
+
+// Record snapshots the current state of the given pockets
+func (r *SnapshotRepository) Record(ctx context.Context, pocketIDs ...int64) error {
+	if len(pocketIDs) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(pocketIDs))
+	for _, id := range pocketIDs {
+		args = append(args, id)
+	}
+	_, err := r.record(ctx, `p.id IN `+inList(len(args)), args, domain.SnapshotChange)
+	return err
+}
+
+// RecordForBudgets snapshots the current state of the pockets funding the given budgets
+func (r *SnapshotRepository) RecordForBudgets(ctx context.Context, budgetIDs ...int64) error {
+	if len(budgetIDs) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(budgetIDs))
+	for _, id := range budgetIDs {
+		args = append(args, id)
+	}
+	_, err := r.record(ctx,
+		`p.id IN (SELECT pocket_id FROM budgets WHERE id IN `+inList(len(args))+`)`, args, domain.SnapshotChange)
+	return err
+}
+
+// RecordDaily snapshots every pocket without a daily snapshot for today and
+// returns the number of snapshots taken
+func (r *SnapshotRepository) RecordDaily(ctx context.Context) (int64, error) {
+	return r.record(ctx,
+		`NOT EXISTS (SELECT 1 FROM pocket_snapshots s
+			WHERE s.pocket_id = p.id AND s.reason = 'daily' AND s.date = ?)`,
+		[]any{time.Now().Format("2006-01-02")}, domain.SnapshotDaily)
+}
+
+func (r *SnapshotRepository) record(ctx context.Context, where string, args []any, reason domain.SnapshotReason) (int64, error) {
+	now := time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO pocket_snapshots (pocket_id, date, balance, allocated, reason, recorded_at)
+		 SELECT `+snapshotValues+` FROM pockets p WHERE `+where,
+		append([]any{now.Format("2006-01-02"), reason, now}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetLatestPerDay returns the last snapshot of each pocket and day between from
+// and to, preceded by each pocket's last snapshot before from
+func (r *SnapshotRepository) GetLatestPerDay(ctx context.Context, pocketID *int64, from, to string) ([]domain.PocketSnapshot, error) {
+	where := `date <= ?`
+	args := []any{to}
+	if pocketID != nil {
+		where += ` AND pocket_id = ?`
+		args = append(args, *pocketID)
+	}
+	args = append(args, from, from)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`WITH ranked AS (
+			SELECT id, pocket_id, date, balance, allocated, reason, recorded_at,
+			       ROW_NUMBER() OVER (PARTITION BY pocket_id, date ORDER BY recorded_at DESC, id DESC) AS rn
+			FROM pocket_snapshots WHERE `+where+`
+		 )
+		 SELECT id, pocket_id, date, balance, allocated, reason, recorded_at
+		 FROM ranked
+		 WHERE rn = 1 AND (date >= ? OR date = (
+			SELECT MAX(s.date) FROM pocket_snapshots s WHERE s.pocket_id = ranked.pocket_id AND s.date < ?
+		 ))
+		 ORDER BY date, pocket_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []domain.PocketSnapshot
+	for rows.Next() {
+		var snapshot domain.PocketSnapshot
+		if err := rows.Scan(&snapshot.ID, &snapshot.PocketID, &snapshot.Date, &snapshot.Balance,
+			&snapshot.Allocated, &snapshot.Reason, &snapshot.RecordedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// Backfill replaces the reconstructed history of a pocket. Starting from its current
+// state, it walks back through the spending and allocations of the pocket's budgets and
+// writes one snapshot per day on which something changed, up to the first recorded
+// snapshot. Fund additions were not dated before snapshots existed, so money added
+// earlier shows up as present from the first reconstructed day.
+func (r *SnapshotRepository) Backfill(ctx context.Context, pocket *domain.Pocket) (int, error) {
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM pocket_snapshots WHERE pocket_id = ? AND reason = 'backfill'`, pocket.ID); err != nil {
+		return 0, err
+	}
+
+	var cutoff sql.NullString
+	if err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT MIN(date) FROM pocket_snapshots WHERE pocket_id = ?`, pocket.ID,
+	).Scan(&cutoff); err != nil {
+		return 0, err
+	}
+
+	type budgetState struct {
+		allocated float64
+		start     string
+		spent     map[string]float64 // Net spending per day
+	}
+	budgets := make(map[int64]*budgetState)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, allocated_amount, substr(created_at, 1, 10) FROM budgets WHERE pocket_id = ?`, pocket.ID)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int64
+		state := &budgetState{spent: make(map[string]float64)}
+		if err := rows.Scan(&id, &state.allocated, &state.start); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		budgets[id] = state
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rows, err = conn(ctx, r.db).QueryContext(ctx,
+		`WITH `+expenseLinesCTE+`
+		 SELECT l.budget_id, substr(l.date, 1, 10) AS day, SUM(`+netAmount+`)
+		 FROM expense_lines l
+		 JOIN budgets b ON b.id = l.budget_id
+		 WHERE b.pocket_id = ?
+		 GROUP BY l.budget_id, day`, pocket.ID)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var budgetID int64
+		var day string
+		var amount float64
+		if err := rows.Scan(&budgetID, &day, &amount); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		state := budgets[budgetID]
+		state.spent[day] += amount
+		// Backdated expenses mean the envelope existed before it was recorded
+		state.start = min(state.start, day)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// The total only changes through spending, since allocations move money within
+	// the pocket, so each day's total is today's plus whatever was spent after it
+	total := pocket.Balance
+	days := []string{pocket.CreatedAt.Format("2006-01-02")}
+	for _, state := range budgets {
+		total += state.allocated
+		days = append(days, state.start)
+		for day, amount := range state.spent {
+			total -= amount
+			days = append(days, day)
+		}
+	}
+	slices.Sort(days)
+	days = slices.Compact(days)
+
+	today := time.Now().Format("2006-01-02")
+	written := 0
+	for _, day := range days {
+		if day > today || (cutoff.Valid && day >= cutoff.String) {
+			break
+		}
+
+		var allocated, spentAfter float64
+		for _, state := range budgets {
+			remaining := state.allocated
+			for spentDay, amount := range state.spent {
+				if spentDay <= day {
+					remaining -= amount
+				} else {
+					spentAfter += amount
+				}
+			}
+			if state.start <= day {
+				allocated += remaining
+			}
+		}
+
+		endOfDay, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			return written, err
+		}
+		if _, err := conn(ctx, r.db).ExecContext(ctx,
+			`INSERT INTO pocket_snapshots (pocket_id, date, balance, allocated, reason, recorded_at)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			pocket.ID, day, total+spentAfter-allocated, allocated, domain.SnapshotBackfill,
+			endOfDay.Add(24*time.Hour-time.Second),
+		); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+type TagRepository struct {
+	db *sql.DB
+}
+
+func NewTagRepository(db *sql.DB) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+func (r *TagRepository) Create(ctx context.Context, tag *domain.Tag) error {
+	now := time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`INSERT INTO tags (name, created_at, updated_at) VALUES (?, ?, ?)`,
+		tag.Name, now, now,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return domain.ErrDuplicateEntry
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	tag.ID = id
+	tag.CreatedAt = now
+	tag.UpdatedAt = now
+	return nil
+}
+
+func (r *TagRepository) GetByID(ctx context.Context, id int64) (*domain.Tag, error) {
+	tag := &domain.Tag{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, name, created_at, updated_at FROM tags WHERE id = ?`, id,
+	).Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (r *TagRepository) GetByName(ctx context.Context, name string) (*domain.Tag, error) {
+	tag := &domain.Tag{}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, name, created_at, updated_at FROM tags WHERE name = ?`, name,
+	).Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (r *TagRepository) GetAll(ctx context.Context) ([]*domain.Tag, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, name, created_at, updated_at FROM tags ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*domain.Tag
+	for rows.Next() {
+		tag := &domain.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (r *TagRepository) Update(ctx context.Context, tag *domain.Tag) error {
+	tag.UpdatedAt = time.Now()
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE tags SET name = ?, updated_at = ? WHERE id = ?`,
+		tag.Name, tag.UpdatedAt, tag.ID,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return domain.ErrDuplicateEntry
+		}
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *TagRepository) Delete(ctx context.Context, id int64) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM expense_tags WHERE tag_id = ?`, id); err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM tags WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// GetReport totals the expenses carrying a tag, optionally limited to a date range
+func (r *TagRepository) GetReport(ctx context.Context, tag *domain.Tag, startDate, endDate *time.Time) (*domain.TagReport, error) {
+	report := &domain.TagReport{
+		Tag:      tag.Name,
+		ByBudget: []domain.TagBudgetTotal{},
+		ByPeriod: []domain.TagPeriodTotal{},
+	}
+
+	where := `et.tag_id = ?`
+	args := []any{tag.ID}
+	if startDate != nil {
+		where += ` AND l.date >= ?`
+		args = append(args, *startDate)
+	}
+	if endDate != nil {
+		where += ` AND l.date <= ?`
+		args = append(args, *endDate)
+	}
+
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`WITH `+expenseLinesCTE+`
+		 SELECT COUNT(DISTINCT l.expense_id),
+		        COALESCE(SUM(CASE WHEN l.type = 'refund' THEN 0 ELSE l.amount END), 0),
+		        COALESCE(SUM(CASE WHEN l.type = 'refund' THEN l.amount ELSE 0 END), 0)
+		 FROM expense_lines l
+		 JOIN expense_tags et ON et.expense_id = l.expense_id
+		 WHERE `+where, args...,
+	).Scan(&report.ExpenseCount, &report.GrossSpent, &report.TotalRefunds)
+	if err != nil {
+		return nil, err
+	}
+	report.TotalSpent = report.GrossSpent - report.TotalRefunds
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`WITH `+expenseLinesCTE+`
+		 SELECT b.id, b.name, b.period,
+		        SUM(CASE WHEN l.type = 'refund' THEN -l.amount ELSE l.amount END)
+		 FROM expense_lines l
+		 JOIN expense_tags et ON et.expense_id = l.expense_id
+		 JOIN budgets b ON b.id = l.budget_id
+		 WHERE `+where+`
+		 GROUP BY b.id, b.name, b.period
+		 ORDER BY b.period, b.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	periods := make(map[string]int)
+	for rows.Next() {
+		var total domain.TagBudgetTotal
+		if err := rows.Scan(&total.BudgetID, &total.BudgetName, &total.Period, &total.TotalSpent); err != nil {
+			return nil, err
+		}
+		report.ByBudget = append(report.ByBudget, total)
+
+		// Rows are ordered by period, so each period is appended once
+		i, ok := periods[total.Period]
+		if !ok {
+			i = len(report.ByPeriod)
+			periods[total.Period] = i
+			report.ByPeriod = append(report.ByPeriod, domain.TagPeriodTotal{Period: total.Period})
+		}
+		report.ByPeriod[i].TotalSpent += total.TotalSpent
+	}
+	return report, rows.Err()
+}
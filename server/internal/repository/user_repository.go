@@ -20,7 +20,7 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 	now := time.Now()
-	result, err := r.db.ExecContext(ctx,
+	result, err := conn(ctx, r.db).ExecContext(ctx,
 		`INSERT INTO users (email, password_hash, name, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?)`,
 		user.Email, user.PasswordHash, user.Name, now, now,
@@ -45,7 +45,7 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 
 func (r *UserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
 	user := &domain.User{}
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`SELECT id, email, password_hash, name, created_at, updated_at
 		 FROM users WHERE id = ?`, id,
 	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name,
@@ -62,7 +62,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id int64) (*domain.User, e
 
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	user := &domain.User{}
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`SELECT id, email, password_hash, name, created_at, updated_at
 		 FROM users WHERE email = ?`, email,
 	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name,
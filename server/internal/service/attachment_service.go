@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+	"github.com/suprie/budget-manager/pkg/storage"
+	"github.com/suprie/budget-manager/pkg/thumbnail"
+)
+
+// MaxAttachmentSize is the largest single file accepted for upload
+const MaxAttachmentSize = 10 << 20
+
+// thumbnailSize is the longest side of generated thumbnails, in pixels
+const thumbnailSize = 256
+
+// attachmentTypes lists the accepted content types, detected from the file
+// contents rather than trusted from the client, with their file extensions
+var attachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+type AttachmentService struct {
+	attachmentRepo *repository.AttachmentRepository
+	expenseRepo    *repository.ExpenseRepository
+	store          storage.BlobStore
+	quota          int64
+}
+
+// NewAttachmentService creates the service. quota is the number of bytes each
+// user may store across all of their attachments.
+func NewAttachmentService(attachmentRepo *repository.AttachmentRepository, expenseRepo *repository.ExpenseRepository, store storage.BlobStore, quota int64) *AttachmentService {
+	return &AttachmentService{
+		attachmentRepo: attachmentRepo,
+		expenseRepo:    expenseRepo,
+		store:          store,
+		quota:          quota,
+	}
+}
+
+func (s *AttachmentService) Upload(ctx context.Context, userID, expenseID int64, fileName string, data []byte) (*domain.Attachment, error) {
+	if len(data) == 0 {
+		return nil, domain.ErrInvalidInput
+	}
+	if len(data) > MaxAttachmentSize {
+		return nil, domain.ErrFileTooLarge
+	}
+
+	if _, err := s.expenseRepo.GetByID(ctx, expenseID); err != nil {
+		return nil, err
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	ext, ok := attachmentTypes[contentType]
+	if !ok {
+		return nil, domain.ErrUnsupportedMedia
+	}
+
+	used, err := s.attachmentRepo.GetTotalSizeByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if used+int64(len(data)) > s.quota {
+		return nil, domain.ErrQuotaExceeded
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &domain.Attachment{
+		ExpenseID:   expenseID,
+		UserID:      userID,
+		FileName:    cleanFileName(fileName, name+ext),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		StorageKey:  fmt.Sprintf("attachments/%d/%s%s", expenseID, name, ext),
+	}
+
+	if err := s.store.Put(ctx, attachment.StorageKey, data, contentType); err != nil {
+		return nil, err
+	}
+
+	// A missing thumbnail is not fatal; clients fall back to the full image
+	if strings.HasPrefix(contentType, "image/") {
+		if thumb, err := thumbnail.Generate(bytes.NewReader(data), thumbnailSize); err == nil {
+			key := fmt.Sprintf("attachments/%d/%s.thumb.jpg", expenseID, name)
+			if err := s.store.Put(ctx, key, thumb, "image/jpeg"); err == nil {
+				attachment.ThumbnailKey = key
+				attachment.HasThumbnail = true
+			}
+		}
+	}
+
+	if err := s.attachmentRepo.Create(ctx, attachment); err != nil {
+		s.RemoveBlobs(ctx, []*domain.Attachment{attachment})
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+func (s *AttachmentService) GetByExpenseID(ctx context.Context, expenseID int64) ([]*domain.Attachment, error) {
+	if _, err := s.expenseRepo.GetByID(ctx, expenseID); err != nil {
+		return nil, err
+	}
+	return s.attachmentRepo.GetByExpenseID(ctx, expenseID)
+}
+
+// Get returns an attachment, making sure it belongs to the given expense
+func (s *AttachmentService) Get(ctx context.Context, expenseID, id int64) (*domain.Attachment, error) {
+	attachment, err := s.attachmentRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.ExpenseID != expenseID {
+		return nil, domain.ErrNotFound
+	}
+	return attachment, nil
+}
+
+// Open returns the contents of an attachment or of its thumbnail
+func (s *AttachmentService) Open(ctx context.Context, attachment *domain.Attachment, thumb bool) (io.ReadCloser, error) {
+	key := attachment.StorageKey
+	if thumb {
+		if !attachment.HasThumbnail {
+			return nil, domain.ErrNotFound
+		}
+		key = attachment.ThumbnailKey
+	}
+
+	r, err := s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	return r, err
+}
+
+func (s *AttachmentService) Delete(ctx context.Context, expenseID, id int64) error {
+	attachment, err := s.Get(ctx, expenseID, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.attachmentRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.RemoveBlobs(ctx, []*domain.Attachment{attachment})
+	return nil
+}
+
+// DetachAll deletes the attachment records of an expense and returns them so
+// their blobs can be removed with RemoveBlobs once the surrounding transaction
+// has committed
+func (s *AttachmentService) DetachAll(ctx context.Context, expenseID int64) ([]*domain.Attachment, error) {
+	attachments, err := s.attachmentRepo.GetByExpenseID(ctx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachmentRepo.DeleteByExpenseID(ctx, expenseID); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// MoveAll hands the attachments of one expense over to another, as when
+// merging duplicates
+func (s *AttachmentService) MoveAll(ctx context.Context, fromExpenseID, toExpenseID int64) error {
+	return s.attachmentRepo.MoveAll(ctx, fromExpenseID, toExpenseID)
+}
+
+// RemoveBlobs deletes the stored files of attachments. Failures are logged
+// rather than returned since the records are already gone.
+func (s *AttachmentService) RemoveBlobs(ctx context.Context, attachments []*domain.Attachment) {
+	for _, attachment := range attachments {
+		for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+			if key == "" {
+				continue
+			}
+			if err := s.store.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete attachment blob %s: %v", key, err)
+			}
+		}
+	}
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// cleanFileName keeps only the base name of a client-supplied file name
+func cleanFileName(name, fallback string) string {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" || name == "" {
+		return fallback
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+	"github.com/suprie/budget-manager/pkg/database"
+	"github.com/suprie/budget-manager/pkg/storage"
+)
+
+// newAttachmentService returns a service over a fresh database and local store,
+// with one user (ID 1) and one expense (ID 1)
+func newAttachmentService(t *testing.T, quota int64) *AttachmentService {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.NewSQLiteDB(database.Config{Path: filepath.Join(dir, "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range []string{
+		`INSERT INTO users (email, password_hash, name) VALUES ('a@b.c', 'x', 'A')`,
+		`INSERT INTO pockets (name) VALUES ('Main')`,
+		`INSERT INTO budgets (name, pocket_id, period) VALUES ('Home', 1, '2025-01')`,
+		`INSERT INTO expenses (budget_id, amount, description, date) VALUES (1, 100, 'Receipt', '2025-01-02')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := storage.NewLocalStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAttachmentService(repository.NewAttachmentRepository(db), repository.NewExpenseRepository(db), store, quota)
+}
+
+// pdf returns a file of the given size that sniffs as a PDF
+func pdf(size int) []byte {
+	data := bytes.Repeat([]byte{' '}, size)
+	copy(data, "%PDF-1.4\n")
+	return data
+}
+
+func TestAttachmentUploadLimits(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("file size", func(t *testing.T) {
+		s := newAttachmentService(t, 100<<20)
+		if _, err := s.Upload(ctx, 1, 1, "max.pdf", pdf(MaxAttachmentSize)); err != nil {
+			t.Fatalf("upload of exactly 10MB: %v", err)
+		}
+		if _, err := s.Upload(ctx, 1, 1, "big.pdf", pdf(MaxAttachmentSize+1)); !errors.Is(err, domain.ErrFileTooLarge) {
+			t.Errorf("upload over 10MB: got %v, want ErrFileTooLarge", err)
+		}
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		s := newAttachmentService(t, 1000)
+		if _, err := s.Upload(ctx, 1, 1, "a.pdf", pdf(600)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Upload(ctx, 1, 1, "b.pdf", pdf(401)); !errors.Is(err, domain.ErrQuotaExceeded) {
+			t.Errorf("upload past the quota: got %v, want ErrQuotaExceeded", err)
+		}
+		if _, err := s.Upload(ctx, 1, 1, "c.pdf", pdf(400)); err != nil {
+			t.Errorf("upload filling the quota exactly: %v", err)
+		}
+	})
+
+	t.Run("content type", func(t *testing.T) {
+		s := newAttachmentService(t, 1000)
+		if _, err := s.Upload(ctx, 1, 1, "notes.pdf", []byte("plain text, whatever the name says")); !errors.Is(err, domain.ErrUnsupportedMedia) {
+			t.Errorf("upload of text: got %v, want ErrUnsupportedMedia", err)
+		}
+	})
+}
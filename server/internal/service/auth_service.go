@@ -2,6 +2,10 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -11,21 +15,35 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour // Renewed by every refresh
+
+	// lastSeenInterval is how stale a session's last-seen time may get before
+	// a request updates it, sparing a write on every request
+	lastSeenInterval = time.Minute
+)
+
 type AuthService struct {
-	userRepo  *repository.UserRepository
-	jwtSecret []byte
+	userRepo    *repository.UserRepository
+	sessionRepo *repository.SessionRepository
+	txManager   *repository.TxManager
+	jwtSecret   []byte
 }
 
-func NewAuthService(userRepo *repository.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(userRepo *repository.UserRepository, sessionRepo *repository.SessionRepository, txManager *repository.TxManager, jwtSecret string) *AuthService {
 	return &AuthService{
-		userRepo:  userRepo,
-		jwtSecret: []byte(jwtSecret),
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		txManager:   txManager,
+		jwtSecret:   []byte(jwtSecret),
 	}
 }
 
 type Claims struct {
-	UserID int64  `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    int64  `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID int64  `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -34,7 +52,7 @@ func (s *AuthService) Register(ctx context.Context, req domain.RegisterRequest)
 		return nil, domain.ErrInvalidInput
 	}
 
-	if len(req.Password) < 6 {
+	if len(req.Password) < 6 || !req.Platform.IsValid() {
 		return nil, domain.ErrInvalidInput
 	}
 
@@ -53,19 +71,11 @@ func (s *AuthService) Register(ctx context.Context, req domain.RegisterRequest)
 		return nil, err
 	}
 
-	token, err := s.generateToken(user)
-	if err != nil {
-		return nil, err
-	}
-
-	return &domain.AuthResponse{
-		Token: token,
-		User:  *user,
-	}, nil
+	return s.startSession(ctx, user, req.SessionClient)
 }
 
 func (s *AuthService) Login(ctx context.Context, req domain.LoginRequest) (*domain.AuthResponse, error) {
-	if req.Email == "" || req.Password == "" {
+	if req.Email == "" || req.Password == "" || !req.Platform.IsValid() {
 		return nil, domain.ErrInvalidInput
 	}
 
@@ -81,15 +91,139 @@ func (s *AuthService) Login(ctx context.Context, req domain.LoginRequest) (*doma
 		return nil, domain.ErrInvalidCredentials
 	}
 
-	token, err := s.generateToken(user)
+	return s.startSession(ctx, user, req.SessionClient)
+}
+
+// Refresh exchanges a refresh token for a new access token and the next
+// refresh token of its session. Each refresh token works once: presenting one
+// that was already exchanged means it leaked, so the whole session is revoked.
+// The session is marked seen from client.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client domain.SessionClient) (*domain.AuthResponse, error) {
+	if refreshToken == "" {
+		return nil, domain.ErrInvalidInput
+	}
+
+	var resp *domain.AuthResponse
+	reused := false
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		token, err := s.sessionRepo.GetRefreshToken(ctx, hashToken(refreshToken))
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		session, err := s.sessionRepo.GetByID(ctx, token.SessionID)
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil {
+			return domain.ErrInvalidToken
+		}
+		// An exchanged token presented again is reuse even once it expired,
+		// so expiry only turns away tokens that were never exchanged
+		if token.UsedAt == nil && time.Now().After(token.ExpiresAt) {
+			return domain.ErrInvalidToken
+		}
+
+		used, err := s.sessionRepo.UseRefreshToken(ctx, token.ID)
+		if err != nil {
+			return err
+		}
+		if !used {
+			// Committed, unlike an error, so the revocation sticks
+			reused = true
+			_, err := s.sessionRepo.Revoke(ctx, session.ID)
+			return err
+		}
+
+		if err := s.sessionRepo.Touch(ctx, session.ID, client, time.Now()); err != nil {
+			return err
+		}
+		user, err := s.userRepo.GetByID(ctx, session.UserID)
+		if err != nil {
+			return err
+		}
+		resp, err = s.issueTokens(ctx, user, session.ID)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	if reused {
+		return nil, domain.ErrInvalidToken
+	}
+	return resp, nil
+}
 
-	return &domain.AuthResponse{
-		Token: token,
-		User:  *user,
-	}, nil
+// Logout revokes a session, its refresh tokens and its access tokens
+func (s *AuthService) Logout(ctx context.Context, sessionID int64) error {
+	_, err := s.sessionRepo.Revoke(ctx, sessionID)
+	return err
+}
+
+// LogoutAll revokes every session of a user, returning how many were open
+func (s *AuthService) LogoutAll(ctx context.Context, userID int64) (int64, error) {
+	return s.sessionRepo.RevokeAllByUserID(ctx, userID)
+}
+
+// Authenticate validates an access token and checks that its session was
+// not revoked, marking the session seen from client. Tokens issued before
+// sessions existed carry none and are refused.
+func (s *AuthService) Authenticate(ctx context.Context, tokenString string, client domain.SessionClient) (*Claims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.SessionID == 0 {
+		return nil, domain.ErrInvalidToken
+	}
+
+	session, err := s.sessionRepo.GetByID(ctx, claims.SessionID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil || session.UserID != claims.UserID {
+		return nil, domain.ErrInvalidToken
+	}
+
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) >= lastSeenInterval || session.IPAddress != client.IPAddress {
+		if err := s.sessionRepo.Touch(ctx, session.ID, client, now); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// Sessions lists the signed-in devices of a user: sessions that were neither
+// revoked nor left to expire. The one with currentID is flagged current.
+func (s *AuthService) Sessions(ctx context.Context, userID, currentID int64) ([]domain.Session, error) {
+	sessions, err := s.sessionRepo.ListActiveByUserID(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs a user out on one device, cutting off its refresh and
+// access tokens at once. Sessions of other users are not found.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return domain.ErrNotFound
+	}
+	_, err = s.sessionRepo.Revoke(ctx, session.ID)
+	return err
 }
 
 func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
@@ -116,12 +250,65 @@ func (s *AuthService) GetUserByID(ctx context.Context, id int64) (*domain.User,
 	return s.userRepo.GetByID(ctx, id)
 }
 
-func (s *AuthService) generateToken(user *domain.User) (string, error) {
+// startSession opens a session for a user who just signed in on client
+func (s *AuthService) startSession(ctx context.Context, user *domain.User, client domain.SessionClient) (*domain.AuthResponse, error) {
+	var resp *domain.AuthResponse
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		session := &domain.Session{
+			UserID:     user.ID,
+			DeviceName: client.DeviceName,
+			Platform:   client.Platform,
+			IPAddress:  client.IPAddress,
+			UserAgent:  client.UserAgent,
+		}
+		if err := s.sessionRepo.Create(ctx, session); err != nil {
+			return err
+		}
+		var err error
+		resp, err = s.issueTokens(ctx, user, session.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// issueTokens issues an access token and the next refresh token of a session
+func (s *AuthService) issueTokens(ctx context.Context, user *domain.User, sessionID int64) (*domain.AuthResponse, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessionRepo.CreateRefreshToken(ctx, &domain.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(accessTokenTTL)
+	token, err := s.generateToken(user, sessionID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AuthResponse{
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		User:         *user,
+	}, nil
+}
+
+func (s *AuthService) generateToken(user *domain.User, sessionID int64, expiresAt time.Time) (string, error) {
 	claims := Claims{
-		UserID: user.ID,
-		Email:  user.Email,
+		UserID:    user.ID,
+		Email:     user.Email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * 7 * time.Hour)), // 7 days
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   user.Email,
 		},
@@ -130,3 +317,19 @@ func (s *AuthService) generateToken(user *domain.User) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(s.jwtSecret)
 }
+
+// newRefreshToken returns 256 random bits, URL-safe
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored. They are random enough that a
+// fast hash suffices.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
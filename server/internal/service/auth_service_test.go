@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+	"github.com/suprie/budget-manager/pkg/database"
+)
+
+// Replaying an exchanged refresh token revokes its session, even once the
+// token expired
+func TestRefreshReuseOfExpiredToken(t *testing.T) {
+	db, err := database.NewSQLiteDB(database.Config{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	auth := NewAuthService(repository.NewUserRepository(db), repository.NewSessionRepository(db),
+		repository.NewTxManager(db), "secret")
+	first, err := auth.Register(ctx, domain.RegisterRequest{Email: "a@b.c", Password: "secret", Name: "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.Refresh(ctx, first.RefreshToken, domain.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`UPDATE refresh_tokens SET expires_at = ? WHERE token_hash = ?`,
+		time.Now().Add(-time.Hour), hashToken(first.RefreshToken)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Refresh(ctx, first.RefreshToken, domain.SessionClient{}); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Fatalf("replaying the expired token: got %v, want %v", err, domain.ErrInvalidToken)
+	}
+	if _, err := auth.Refresh(ctx, second.RefreshToken, domain.SessionClient{}); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("the session survived the replay: refreshing got %v, want %v", err, domain.ErrInvalidToken)
+	}
+}
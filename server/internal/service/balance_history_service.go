@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+)
+
+// BalanceHistoryService charts pocket balances from the snapshots recorded by the
+// pocket, budget and expense services, the daily job and the backfill
+type BalanceHistoryService struct {
+	snapshotRepo *repository.SnapshotRepository
+	pocketRepo   *repository.PocketRepository
+	txManager    *repository.TxManager
+}
+
+func NewBalanceHistoryService(
+	snapshotRepo *repository.SnapshotRepository,
+	pocketRepo *repository.PocketRepository,
+	txManager *repository.TxManager,
+) *BalanceHistoryService {
+	return &BalanceHistoryService{
+		snapshotRepo: snapshotRepo,
+		pocketRepo:   pocketRepo,
+		txManager:    txManager,
+	}
+}
+
+// PocketHistory returns the balance of one pocket at the end of each bucket
+func (s *BalanceHistoryService) PocketHistory(ctx context.Context, id int64, from, to string, granularity domain.SeriesGranularity) (*domain.BalanceHistory, error) {
+	if _, err := s.pocketRepo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.history(ctx, &id, from, to, granularity)
+}
+
+// NetWorth returns the combined balance of all pockets at the end of each bucket
+func (s *BalanceHistoryService) NetWorth(ctx context.Context, from, to string, granularity domain.SeriesGranularity) (*domain.BalanceHistory, error) {
+	return s.history(ctx, nil, from, to, granularity)
+}
+
+func (s *BalanceHistoryService) history(ctx context.Context, pocketID *int64, from, to string, granularity domain.SeriesGranularity) (*domain.BalanceHistory, error) {
+	filter, err := reportFilter(from, to, nil)
+	if err != nil {
+		return nil, err
+	}
+	if granularity == "" {
+		granularity = domain.GranularityDay
+	}
+
+	buckets, err := seriesBuckets(filter.StartDate, filter.EndDate, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := s.snapshotRepo.GetLatestPerDay(ctx, pocketID,
+		filter.StartDate.Format("2006-01-02"), filter.EndDate.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Carry each pocket's latest snapshot forward to the end of every bucket
+	history := &domain.BalanceHistory{
+		PocketID:    pocketID,
+		Granularity: granularity,
+		Points:      make([]domain.BalancePoint, 0, len(buckets)),
+	}
+	latest := make(map[int64]domain.PocketSnapshot)
+	next := 0
+	for i, bucket := range buckets {
+		end := filter.EndDate
+		if i+1 < len(buckets) {
+			end = buckets[i+1].AddDate(0, 0, -1)
+		}
+		for ; next < len(snapshots) && snapshots[next].Date <= end.Format("2006-01-02"); next++ {
+			latest[snapshots[next].PocketID] = snapshots[next]
+		}
+
+		point := domain.BalancePoint{Date: bucket.Format("2006-01-02")}
+		for _, snapshot := range latest {
+			point.Balance += snapshot.Balance
+			point.Allocated += snapshot.Allocated
+		}
+		point.Total = point.Balance + point.Allocated
+		history.Points = append(history.Points, point)
+	}
+	return history, nil
+}
+
+// Backfill reconstructs the history of every pocket from its budgets and expenses
+func (s *BalanceHistoryService) Backfill(ctx context.Context) (*domain.BackfillResult, error) {
+	result := &domain.BackfillResult{}
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		pockets, err := s.pocketRepo.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, pocket := range pockets {
+			written, err := s.snapshotRepo.Backfill(ctx, pocket)
+			if err != nil {
+				return err
+			}
+			result.Pockets++
+			result.Snapshots += written
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RunDaily takes the daily snapshot now and after every following midnight until ctx is done
+func (s *BalanceHistoryService) RunDaily(ctx context.Context) {
+	for {
+		if _, err := s.snapshotRepo.RecordDaily(ctx); err != nil {
+			log.Printf("Failed to record daily pocket snapshots: %v", err)
+		}
+
+		now := time.Now()
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(midnight.Sub(now)):
+		}
+	}
+}
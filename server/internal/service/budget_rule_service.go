@@ -1,8 +1,12 @@
 package service
 
 import (
+	"cmp"
 	"context"
-	"strings"
+	"errors"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/suprie/budget-manager/internal/domain"
 	"github.com/suprie/budget-manager/internal/repository"
@@ -11,23 +15,60 @@ import (
 type BudgetRuleService struct {
 	ruleRepo   *repository.BudgetRuleRepository
 	budgetRepo *repository.BudgetRepository
+	pocketRepo *repository.PocketRepository
+	payees     *PayeeService
+	classifier *Classifier
+	txManager  *repository.TxManager
+	patterns   sync.Map // Compiled regex conditions by expression
 }
 
-func NewBudgetRuleService(ruleRepo *repository.BudgetRuleRepository, budgetRepo *repository.BudgetRepository) *BudgetRuleService {
+func NewBudgetRuleService(ruleRepo *repository.BudgetRuleRepository, budgetRepo *repository.BudgetRepository, pocketRepo *repository.PocketRepository, payees *PayeeService, classifier *Classifier, txManager *repository.TxManager) *BudgetRuleService {
 	return &BudgetRuleService{
 		ruleRepo:   ruleRepo,
 		budgetRepo: budgetRepo,
+		pocketRepo: pocketRepo,
+		payees:     payees,
+		classifier: classifier,
+		txManager:  txManager,
 	}
 }
 
 func (s *BudgetRuleService) Create(ctx context.Context, req domain.CreateBudgetRuleRequest) (*domain.BudgetRule, error) {
+	rule, err := s.newRule(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ruleRepo.Create(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// newRule builds and validates the rule a create request describes
+func (s *BudgetRuleService) newRule(ctx context.Context, req domain.CreateBudgetRuleRequest) (*domain.BudgetRule, error) {
 	if req.BudgetID <= 0 {
 		return nil, domain.ErrInvalidInput
 	}
 
-	keywords := strings.TrimSpace(req.Keywords)
-	if keywords == "" {
+	rule := &domain.BudgetRule{
+		BudgetID:   req.BudgetID,
+		Operator:   req.Operator,
+		Conditions: req.Conditions,
+		Priority:   req.Priority,
+		IsActive:   true,
+	}
+	switch {
+	case req.Keywords != "" && len(req.Conditions) > 0:
 		return nil, domain.ErrInvalidInput
+	case req.Keywords != "":
+		rule.Operator, rule.Conditions = domain.RuleOr, domain.KeywordConditions(req.Keywords)
+	case rule.Operator == "":
+		rule.Operator = domain.RuleAnd
+	}
+	if err := s.setConditions(ctx, rule); err != nil {
+		return nil, err
 	}
 
 	// Verify budget exists
@@ -36,17 +77,6 @@ func (s *BudgetRuleService) Create(ctx context.Context, req domain.CreateBudgetR
 		return nil, err
 	}
 
-	rule := &domain.BudgetRule{
-		BudgetID: req.BudgetID,
-		Keywords: keywords,
-		Priority: req.Priority,
-		IsActive: true,
-	}
-
-	if err := s.ruleRepo.Create(ctx, rule); err != nil {
-		return nil, err
-	}
-
 	return rule, nil
 }
 
@@ -54,15 +84,19 @@ func (s *BudgetRuleService) GetByID(ctx context.Context, id int64) (*domain.Budg
 	return s.ruleRepo.GetByID(ctx, id)
 }
 
-func (s *BudgetRuleService) GetAll(ctx context.Context) ([]domain.BudgetRuleWithBudget, error) {
-	return s.ruleRepo.GetAll(ctx)
+// List returns the rules matching the filter, one page at a time when a limit or cursor is set
+func (s *BudgetRuleService) List(ctx context.Context, filter domain.BudgetRuleFilter) (*domain.Page[domain.BudgetRuleWithBudget], error) {
+	if err := checkListOptions(&filter.ListOptions); err != nil {
+		return nil, err
+	}
+	return s.ruleRepo.List(ctx, filter)
 }
 
 func (s *BudgetRuleService) GetByBudgetID(ctx context.Context, budgetID int64) ([]domain.BudgetRule, error) {
 	return s.ruleRepo.GetByBudgetID(ctx, budgetID)
 }
 
-func (s *BudgetRuleService) GetActiveRules(ctx context.Context) ([]domain.BudgetRule, error) {
+func (s *BudgetRuleService) GetActiveRules(ctx context.Context) ([]domain.BudgetRuleWithBudget, error) {
 	return s.ruleRepo.GetActiveRules(ctx)
 }
 
@@ -72,12 +106,32 @@ func (s *BudgetRuleService) Update(ctx context.Context, id int64, req domain.Upd
 		return nil, err
 	}
 
-	if req.Keywords != nil {
-		keywords := strings.TrimSpace(*req.Keywords)
-		if keywords == "" {
-			return nil, domain.ErrInvalidInput
-		}
-		rule.Keywords = keywords
+	if err := s.applyUpdate(ctx, rule, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.ruleRepo.Update(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// applyUpdate changes a rule as an update request asks, validating the result
+func (s *BudgetRuleService) applyUpdate(ctx context.Context, rule *domain.BudgetRule, req domain.UpdateBudgetRuleRequest) error {
+	switch {
+	case req.Keywords != nil && req.Conditions != nil:
+		return domain.ErrInvalidInput
+	case req.Keywords != nil:
+		rule.Operator, rule.Conditions = domain.RuleOr, domain.KeywordConditions(*req.Keywords)
+	case req.Conditions != nil:
+		rule.Conditions = req.Conditions
+	}
+	if req.Operator != nil {
+		rule.Operator = *req.Operator
+	}
+	if err := s.setConditions(ctx, rule); err != nil {
+		return err
 	}
 
 	if req.Priority != nil {
@@ -88,35 +142,347 @@ func (s *BudgetRuleService) Update(ctx context.Context, id int64, req domain.Upd
 		rule.IsActive = *req.IsActive
 	}
 
-	if err := s.ruleRepo.Update(ctx, rule); err != nil {
-		return nil, err
-	}
+	return nil
+}
 
-	return rule, nil
+// setConditions validates the operator and conditions of a rule and refreshes its keywords
+func (s *BudgetRuleService) setConditions(ctx context.Context, rule *domain.BudgetRule) error {
+	if err := checkOperator(rule.Operator); err != nil {
+		return err
+	}
+	if err := s.checkConditions(ctx, rule.Conditions); err != nil {
+		return err
+	}
+	rule.Keywords = conditionKeywords(rule.Conditions)
+	return nil
 }
 
 func (s *BudgetRuleService) Delete(ctx context.Context, id int64) error {
 	return s.ruleRepo.Delete(ctx, id)
 }
 
-// MatchTransaction finds the best matching budget for a transaction description
-func (s *BudgetRuleService) MatchTransaction(ctx context.Context, description string) (*int64, error) {
+// MatchTransaction finds the best matching budget for a transaction and
+// records the hit of the rule that matched
+func (s *BudgetRuleService) MatchTransaction(ctx context.Context, tx domain.RuleTransaction) (*int64, error) {
+	match, err := s.Match(ctx, tx)
+	if err != nil || match == nil {
+		return nil, err
+	}
+	if match.RuleID != nil {
+		if err := s.RecordHit(ctx, *match.RuleID); err != nil {
+			return nil, err
+		}
+	}
+	return &match.BudgetID, nil
+}
+
+// RecordHit counts a transaction the rule categorized. Previews such as
+// Explain and dry runs do not count.
+func (s *BudgetRuleService) RecordHit(ctx context.Context, ruleID int64) error {
+	return s.ruleRepo.RecordHit(ctx, ruleID, time.Now())
+}
+
+// Match is MatchTransaction reporting the rule that matched, or nil when nothing did
+func (s *BudgetRuleService) Match(ctx context.Context, tx domain.RuleTransaction) (*domain.RuleMatch, error) {
+	explanation, err := s.Explain(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return explanationMatch(explanation), nil
+}
+
+// explanationMatch is the budget an explanation settles on, or nil
+func explanationMatch(explanation *domain.RuleExplanation) *domain.RuleMatch {
+	if !explanation.Matched {
+		return nil
+	}
+	match := &domain.RuleMatch{BudgetID: *explanation.BudgetID}
+	switch {
+	case explanation.Rule != nil:
+		match.RuleID = &explanation.Rule.RuleID
+	case explanation.Prediction != nil:
+		match.Probability = &explanation.Prediction.Probability
+	}
+	return match
+}
+
+// MatchBudget is Match for a transaction of the given period. Rules name the
+// budget of one period, so the match moves to the budget of the same name in
+// that period when there is one. With a pocket, the match must be a budget of
+// that pocket, or one of the same name in it; otherwise there is no match.
+func (s *BudgetRuleService) MatchBudget(ctx context.Context, tx domain.RuleTransaction, period string, pocketID *int64) (*domain.RuleMatch, error) {
+	matcher, err := s.matcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.matchBudget(ctx, matcher, tx, period, pocketID)
+}
+
+// matchBudget is MatchBudget against rules and payees already loaded
+func (s *BudgetRuleService) matchBudget(ctx context.Context, matcher *ruleMatcher, tx domain.RuleTransaction, period string, pocketID *int64) (*domain.RuleMatch, error) {
+	explanation, err := s.explain(ctx, matcher, tx)
+	if err != nil {
+		return nil, err
+	}
+	match := explanationMatch(explanation)
+	if match == nil {
+		return nil, nil
+	}
+
+	budget, err := s.budgetRepo.GetByID(ctx, match.BudgetID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, nil // The rule outlived its budget
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var same *domain.Budget
+	switch {
+	case pocketID != nil:
+		same, err = s.budgetRepo.GetLatestByNameInPocket(ctx, budget.Name, *pocketID, period)
+		if errors.Is(err, domain.ErrNotFound) {
+			if budget.PocketID == *pocketID {
+				return match, nil
+			}
+			return nil, nil
+		}
+	case budget.Period == period:
+		return match, nil
+	default:
+		same, err = s.budgetRepo.GetLatestByName(ctx, budget.Name, period)
+		if errors.Is(err, domain.ErrNotFound) {
+			return match, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	match.BudgetID = same.ID
+	return match, nil
+}
+
+// ruleMatcher holds what explaining a transaction reads besides the budgets:
+// the active rules in evaluation order and the payees. Batches load it once.
+// Callers that do not act on the classifier's guesses skip asking for them.
+type ruleMatcher struct {
+	rules          []domain.BudgetRuleWithBudget
+	payees         *payeeMatcher
+	skipClassifier bool
+}
+
+// matcher loads the active rules and the payees
+func (s *BudgetRuleService) matcher(ctx context.Context) (*ruleMatcher, error) {
 	rules, err := s.ruleRepo.GetActiveRules(ctx)
 	if err != nil {
 		return nil, err
 	}
+	payees, err := s.payees.matcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ruleMatcher{rules: rules, payees: payees}, nil
+}
 
-	descLower := strings.ToLower(description)
+// maxBatchMatch caps the transactions of one batch match
+const maxBatchMatch = 1000
 
-	for _, rule := range rules {
-		keywords := strings.Split(rule.Keywords, ",")
-		for _, keyword := range keywords {
-			keyword = strings.TrimSpace(strings.ToLower(keyword))
-			if keyword != "" && strings.Contains(descLower, keyword) {
-				return &rule.BudgetID, nil
+// Explain tests a transaction against every active rule. The first matching
+// rule in evaluation order wins: highest priority first, then the oldest rule.
+// Without a matching rule, the default category of the description's payee
+// decides, and failing that the classifier guesses from past expenses.
+func (s *BudgetRuleService) Explain(ctx context.Context, tx domain.RuleTransaction) (*domain.RuleExplanation, error) {
+	matcher, err := s.matcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.explain(ctx, matcher, tx)
+}
+
+// ExplainMatch is Explain for a transaction being categorized, recording the
+// hit of the winning rule
+func (s *BudgetRuleService) ExplainMatch(ctx context.Context, tx domain.RuleTransaction) (*domain.RuleExplanation, error) {
+	explanation, err := s.Explain(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if explanation.Rule != nil {
+		if err := s.RecordHit(ctx, explanation.Rule.RuleID); err != nil {
+			return nil, err
+		}
+	}
+	return explanation, nil
+}
+
+// ExplainBatch explains many transactions at once, in order
+func (s *BudgetRuleService) ExplainBatch(ctx context.Context, reqs []domain.MatchTransactionRequest) ([]domain.RuleExplanation, error) {
+	if len(reqs) == 0 || len(reqs) > maxBatchMatch {
+		return nil, domain.ErrInvalidInput
+	}
+
+	txs := make([]domain.RuleTransaction, len(reqs))
+	for i, req := range reqs {
+		if req.Description == "" {
+			return nil, domain.ErrInvalidInput
+		}
+		txs[i] = domain.RuleTransaction{Description: req.Description, Amount: req.Amount, PocketID: req.PocketID}
+		if req.Date != "" {
+			date, err := time.Parse("2006-01-02", req.Date)
+			if err != nil {
+				return nil, domain.ErrInvalidInput
 			}
+			txs[i].Date = &date
+		}
+	}
+
+	matcher, err := s.matcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	explanations := make([]domain.RuleExplanation, len(txs))
+	for i, tx := range txs {
+		explanation, err := s.explain(ctx, matcher, tx)
+		if err != nil {
+			return nil, err
+		}
+		explanations[i] = *explanation
+	}
+	return explanations, nil
+}
+
+func (s *BudgetRuleService) explain(ctx context.Context, matcher *ruleMatcher, tx domain.RuleTransaction) (*domain.RuleExplanation, error) {
+	explanation := &domain.RuleExplanation{Description: tx.Description, Candidates: []domain.RuleCandidate{}}
+	for _, rule := range matcher.rules {
+		matched, ok := s.matchConditions(rule.Operator, rule.Conditions, tx)
+		if !ok {
+			continue
 		}
+		explanation.Candidates = append(explanation.Candidates, domain.RuleCandidate{
+			RuleID:     rule.ID,
+			BudgetID:   rule.BudgetID,
+			BudgetName: rule.BudgetName,
+			Priority:   rule.Priority,
+			Matched:    matched,
+		})
 	}
 
-	return nil, nil
+	if len(explanation.Candidates) > 0 {
+		winner := explanation.Candidates[0]
+		explanation.Rule, explanation.BudgetID, explanation.Matched = &winner, &winner.BudgetID, true
+		return explanation, nil
+	}
+
+	payee, budgetID, err := s.matchPayeeCategory(ctx, matcher.payees, tx.Description)
+	if err != nil {
+		return nil, err
+	}
+	if budgetID != nil {
+		explanation.Payee, explanation.BudgetID, explanation.Matched = payee, budgetID, true
+		return explanation, nil
+	}
+	if matcher.skipClassifier {
+		return explanation, nil
+	}
+
+	prediction, err := s.classifier.Predict(ctx, tx)
+	if err != nil || prediction == nil {
+		return explanation, err
+	}
+	budget, err := s.budgetRepo.GetLatestByName(ctx, prediction.Category, time.Now().Format("2006-01"))
+	if errors.Is(err, domain.ErrNotFound) {
+		return explanation, nil // The category's budgets were renamed or deleted
+	}
+	if err != nil {
+		return nil, err
+	}
+	prediction.Category = budget.Name
+	explanation.Prediction, explanation.BudgetID, explanation.Matched = prediction, &budget.ID, true
+	return explanation, nil
+}
+
+// matchPayeeCategory falls back to the default category of the description's payee,
+// mapped to the latest budget of that name up to the current period
+func (s *BudgetRuleService) matchPayeeCategory(ctx context.Context, payees *payeeMatcher, description string) (*domain.Payee, *int64, error) {
+	payee, _ := payees.match(normalizeDescription(description))
+	if payee == nil || payee.DefaultCategory == "" {
+		return nil, nil, nil
+	}
+
+	budget, err := s.budgetRepo.GetLatestByName(ctx, payee.DefaultCategory, time.Now().Format("2006-01"))
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return payee, &budget.ID, nil
+}
+
+// proposeRules returns the active rules as they would be after a simulation's
+// changes, in evaluation order. Added rules are numbered -1, -2... and follow
+// the existing rules of their priority, as newer rules do.
+func (s *BudgetRuleService) proposeRules(ctx context.Context, req domain.SimulateRulesRequest) ([]domain.BudgetRuleWithBudget, error) {
+	page, err := s.ruleRepo.List(ctx, domain.BudgetRuleFilter{})
+	if err != nil {
+		return nil, err
+	}
+	rules := page.Items
+	index := make(map[int64]int, len(rules))
+	for i, rule := range rules {
+		index[rule.ID] = i
+	}
+
+	deleted := make(map[int64]bool, len(req.Delete))
+	for _, id := range req.Delete {
+		if _, ok := index[id]; !ok {
+			return nil, domain.ErrNotFound
+		}
+		deleted[id] = true
+	}
+	for _, update := range req.Update {
+		i, ok := index[update.ID]
+		if !ok {
+			return nil, domain.ErrNotFound
+		}
+		if deleted[update.ID] {
+			return nil, domain.ErrInvalidInput
+		}
+		if err := s.applyUpdate(ctx, &rules[i].BudgetRule, update.UpdateBudgetRuleRequest); err != nil {
+			return nil, err
+		}
+	}
+	for i, add := range req.Add {
+		rule, err := s.newRule(ctx, add)
+		if err != nil {
+			return nil, err
+		}
+		budget, err := s.budgetRepo.GetByID(ctx, rule.BudgetID)
+		if err != nil {
+			return nil, err
+		}
+		rule.ID = -int64(i + 1)
+		rules = append(rules, domain.BudgetRuleWithBudget{BudgetRule: *rule, BudgetName: budget.Name})
+	}
+
+	active := rules[:0]
+	for _, rule := range rules {
+		if rule.IsActive && !deleted[rule.ID] {
+			active = append(active, rule)
+		}
+	}
+	// Existing rules oldest first, then the added ones in order
+	added := func(rule domain.BudgetRuleWithBudget) int {
+		if rule.ID < 0 {
+			return 1
+		}
+		return 0
+	}
+	slices.SortStableFunc(active, func(a, b domain.BudgetRuleWithBudget) int {
+		return cmp.Or(
+			cmp.Compare(b.Priority, a.Priority),
+			cmp.Compare(added(a), added(b)),
+			cmp.Compare(max(a.ID, -a.ID), max(b.ID, -b.ID)),
+		)
+	})
+	return active, nil
 }
@@ -8,14 +8,16 @@ import (
 )
 
 type BudgetService struct {
-	budgetRepo *repository.BudgetRepository
-	pocketRepo *repository.PocketRepository
+	budgetRepo   *repository.BudgetRepository
+	pocketRepo   *repository.PocketRepository
+	snapshotRepo *repository.SnapshotRepository
 }
 
-func NewBudgetService(budgetRepo *repository.BudgetRepository, pocketRepo *repository.PocketRepository) *BudgetService {
+func NewBudgetService(budgetRepo *repository.BudgetRepository, pocketRepo *repository.PocketRepository, snapshotRepo *repository.SnapshotRepository) *BudgetService {
 	return &BudgetService{
-		budgetRepo: budgetRepo,
-		pocketRepo: pocketRepo,
+		budgetRepo:   budgetRepo,
+		pocketRepo:   pocketRepo,
+		snapshotRepo: snapshotRepo,
 	}
 }
 
@@ -55,6 +57,9 @@ func (s *BudgetService) Create(ctx context.Context, req domain.CreateBudgetReque
 	if err := s.pocketRepo.UpdateBalance(ctx, req.PocketID, -req.AllocatedAmount); err != nil {
 		return nil, err
 	}
+	if err := s.snapshotRepo.Record(ctx, req.PocketID); err != nil {
+		return nil, err
+	}
 
 	return budget, nil
 }
@@ -63,8 +68,15 @@ func (s *BudgetService) GetByID(ctx context.Context, id int64) (*domain.Budget,
 	return s.budgetRepo.GetByID(ctx, id)
 }
 
-func (s *BudgetService) GetAll(ctx context.Context) ([]*domain.Budget, error) {
-	return s.budgetRepo.GetAll(ctx)
+// List returns the budgets matching the filter, one page at a time when a limit or cursor is set
+func (s *BudgetService) List(ctx context.Context, filter domain.BudgetFilter) (*domain.Page[*domain.Budget], error) {
+	if err := checkRange(filter.MinAllocated, filter.MaxAllocated); err != nil {
+		return nil, err
+	}
+	if err := checkListOptions(&filter.ListOptions); err != nil {
+		return nil, err
+	}
+	return s.budgetRepo.List(ctx, filter)
 }
 
 func (s *BudgetService) GetByPocketID(ctx context.Context, pocketID int64) ([]*domain.Budget, error) {
@@ -114,6 +126,11 @@ func (s *BudgetService) Update(ctx context.Context, id int64, req domain.UpdateB
 	if err := s.budgetRepo.Update(ctx, budget); err != nil {
 		return nil, err
 	}
+	if req.AllocatedAmount != nil {
+		if err := s.snapshotRepo.Record(ctx, budget.PocketID); err != nil {
+			return nil, err
+		}
+	}
 
 	return budget, nil
 }
@@ -132,7 +149,10 @@ func (s *BudgetService) Delete(ctx context.Context, id int64) error {
 		}
 	}
 
-	return s.budgetRepo.Delete(ctx, id)
+	if err := s.budgetRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.snapshotRepo.Record(ctx, budget.PocketID)
 }
 
 func (s *BudgetService) GetSummary(ctx context.Context, period string) (*domain.BudgetSummary, error) {
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+)
+
+// CategorizationService puts existing expenses where the budget rules say they
+// belong. It sits on top of the rule and expense services so that moves follow
+// the same funds checks and spent bookkeeping as an edit by hand.
+type CategorizationService struct {
+	rules       *BudgetRuleService
+	expenses    *ExpenseService
+	classifier  *Classifier
+	expenseRepo *repository.ExpenseRepository
+	budgetRepo  *repository.BudgetRepository
+}
+
+func NewCategorizationService(
+	rules *BudgetRuleService,
+	expenses *ExpenseService,
+	classifier *Classifier,
+	expenseRepo *repository.ExpenseRepository,
+	budgetRepo *repository.BudgetRepository,
+) *CategorizationService {
+	return &CategorizationService{
+		rules:       rules,
+		expenses:    expenses,
+		classifier:  classifier,
+		expenseRepo: expenseRepo,
+		budgetRepo:  budgetRepo,
+	}
+}
+
+// Apply matches the expenses in scope against the active rules, oldest first,
+// and moves each to the budget its rule picks for the expense's month. Unlike
+// an imported line, an expense may change pockets, and the classifier is not
+// consulted. Every move stands alone: one an envelope cannot afford is reported
+// as failed and the others still happen. A dry run plays the same moves
+// against the remaining funds without changing anything.
+func (s *CategorizationService) Apply(ctx context.Context, req domain.ApplyRulesRequest) (*domain.RuleApplication, error) {
+	page, err := s.scope(ctx, req.StartDate, req.EndDate, req.BudgetID, req.Uncategorized)
+	if err != nil {
+		return nil, err
+	}
+
+	matcher, err := s.rules.matcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matcher.skipClassifier = true
+
+	result := &domain.RuleApplication{DryRun: req.DryRun, Scanned: len(page.Items), Moves: []domain.ExpenseMove{}}
+	budgets := make(map[int64]*domain.Budget)
+	budget := func(id int64) (*domain.Budget, error) {
+		if b, ok := budgets[id]; ok {
+			return b, nil
+		}
+		b, err := s.budgetRepo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		budgets[id] = b
+		return b, nil
+	}
+
+	for _, expense := range page.Items {
+		movable, err := s.movable(ctx, expense)
+		if err != nil {
+			return nil, err
+		}
+		if !movable {
+			result.Skipped++
+			continue
+		}
+
+		from, err := budget(expense.BudgetID)
+		if err != nil {
+			return nil, err
+		}
+		match, err := s.rules.matchBudget(ctx, matcher, domain.RuleTransaction{
+			Description: expense.Description,
+			Amount:      &expense.Amount,
+			PocketID:    &from.PocketID,
+			Date:        &expense.Date,
+		}, expense.Date.Format("2006-01"), nil)
+		if err != nil {
+			return nil, err
+		}
+		if match == nil || match.BudgetID == expense.BudgetID {
+			result.Unchanged++
+			continue
+		}
+		to, err := budget(match.BudgetID)
+		if err != nil {
+			return nil, err
+		}
+
+		move := domain.ExpenseMove{
+			ExpenseID:    expense.ID,
+			Description:  expense.Description,
+			Amount:       expense.Amount,
+			Date:         expense.Date,
+			FromBudgetID: from.ID,
+			ToBudgetID:   to.ID,
+			RuleID:       match.RuleID,
+			Status:       domain.MoveDone,
+		}
+		switch {
+		case req.DryRun && to.RemainingAmount() < expense.Amount:
+			err = domain.ErrInsufficientFunds
+		case req.DryRun:
+			move.Status = domain.MovePlanned
+			// Later moves see the funds this one would shift
+			from.SpentAmount -= expense.Amount
+			to.SpentAmount += expense.Amount
+		default:
+			_, err = s.expenses.Update(ctx, expense.ID, domain.UpdateExpenseRequest{BudgetID: &to.ID})
+			if err == nil && match.RuleID != nil {
+				err = s.rules.RecordHit(ctx, *match.RuleID)
+			}
+			delete(budgets, from.ID)
+			delete(budgets, to.ID)
+		}
+		switch {
+		case errors.Is(err, domain.ErrInsufficientFunds):
+			move.Status, move.Error = domain.MoveFailed, err.Error()
+			result.Failed++
+		case err != nil:
+			return nil, err
+		default:
+			result.Moved++
+		}
+		result.Moves = append(result.Moves, move)
+	}
+	return result, nil
+}
+
+// scope lists the expenses rules are applied to, oldest first: those dated
+// between the optional bounds, of one budget, or imported and uncategorized
+func (s *CategorizationService) scope(ctx context.Context, startDate, endDate string, budgetID *int64, uncategorized bool) (*domain.Page[*domain.Expense], error) {
+	filter := domain.ExpenseFilter{
+		BudgetID:      budgetID,
+		Uncategorized: uncategorized,
+		ListOptions: domain.ListOptions{
+			Sort: []domain.SortField{{Field: "date"}, {Field: "id"}},
+		},
+	}
+	var err error
+	if filter.StartDate, err = optionalDate(startDate); err != nil {
+		return nil, err
+	}
+	if filter.EndDate, err = optionalDate(endDate); err != nil {
+		return nil, err
+	}
+	if filter.StartDate != nil && filter.EndDate != nil && filter.EndDate.Before(*filter.StartDate) {
+		return nil, domain.ErrInvalidInput
+	}
+	if budgetID != nil {
+		if _, err := s.budgetRepo.GetByID(ctx, *budgetID); err != nil {
+			return nil, err
+		}
+	}
+	return s.expenseRepo.List(ctx, filter)
+}
+
+func (s *CategorizationService) ClassifierStats(ctx context.Context) (*domain.ClassifierStats, error) {
+	return s.classifier.Stats(ctx)
+}
+
+// TrainClassifier relearns the classifier from every expense on record
+func (s *CategorizationService) TrainClassifier(ctx context.Context) (*domain.ClassifierStats, error) {
+	return s.classifier.Train(ctx)
+}
+
+// movable reports whether rules may move an expense. Refunds follow their
+// original, split expenses were spread by hand, and an expense with linked
+// refunds would leave them behind in the old budget.
+func (s *CategorizationService) movable(ctx context.Context, expense *domain.Expense) (bool, error) {
+	if expense.IsRefund() || expense.IsSplit() {
+		return false, nil
+	}
+	refunds, err := s.expenseRepo.GetRefunds(ctx, expense.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(refunds) == 0, nil
+}
+
+// optionalDate parses a "2006-01-02" date, nil when empty
+func optionalDate(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, domain.ErrInvalidInput
+	}
+	return &date, nil
+}
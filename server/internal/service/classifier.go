@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+)
+
+// minClassifierCategories is how many categories the classifier must know
+// before it guesses; with a single one every guess would be certain
+const minClassifierCategories = 2
+
+// Classifier guesses the category of a transaction with naive Bayes over the
+// words of its description and the order of magnitude of its amount, learned
+// from the user's own expenses. It runs entirely on the local database. Every
+// expense created, edited or deleted updates the counts in the same
+// transaction, so the model never needs a full retraining to stay current.
+type Classifier struct {
+	repo        *repository.ClassifierRepository
+	expenseRepo *repository.ExpenseRepository
+	budgetRepo  *repository.BudgetRepository
+	txManager   *repository.TxManager
+}
+
+func NewClassifier(
+	repo *repository.ClassifierRepository,
+	expenseRepo *repository.ExpenseRepository,
+	budgetRepo *repository.BudgetRepository,
+	txManager *repository.TxManager,
+) *Classifier {
+	return &Classifier{
+		repo:        repo,
+		expenseRepo: expenseRepo,
+		budgetRepo:  budgetRepo,
+		txManager:   txManager,
+	}
+}
+
+func (c *Classifier) Stats(ctx context.Context) (*domain.ClassifierStats, error) {
+	return c.repo.Stats(ctx)
+}
+
+// Train relearns everything from the expenses on record that were categorized
+// by the user or their rules, e.g. after budgets were renamed
+func (c *Classifier) Train(ctx context.Context) (*domain.ClassifierStats, error) {
+	err := c.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := c.repo.Reset(ctx); err != nil {
+			return err
+		}
+		page, err := c.expenseRepo.List(ctx, domain.ExpenseFilter{})
+		if err != nil {
+			return err
+		}
+		for _, expense := range page.Items {
+			if err := c.learn(ctx, expense, 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.repo.Stats(ctx)
+}
+
+// EnsureTrained trains the classifier when it has learned nothing yet, as on
+// the first start with existing expenses
+func (c *Classifier) EnsureTrained(ctx context.Context) error {
+	stats, err := c.repo.Stats(ctx)
+	if err != nil || stats.Documents > 0 {
+		return err
+	}
+	_, err = c.Train(ctx)
+	return err
+}
+
+// learn counts an expense under the name of its budget, or uncounts it with a
+// negative delta. Refunds and split expenses say nothing about one category,
+// nor do budgets the classifier guessed itself or an import fell back to.
+func (c *Classifier) learn(ctx context.Context, expense *domain.Expense, delta int) error {
+	if expense.IsRefund() || expense.IsSplit() || !expense.CategorizedBy.Learnable() {
+		return nil
+	}
+	features := classifierFeatures(expense.Description, &expense.Amount)
+	if len(features) == 0 {
+		return nil
+	}
+	budget, err := c.budgetRepo.GetByID(ctx, expense.BudgetID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.repo.Add(ctx, strings.ToLower(budget.Name), features, delta)
+}
+
+// Predict returns the most likely category of a transaction with its
+// probability, or nil when the classifier knows too little: fewer than two
+// categories, or none of the description's words
+func (c *Classifier) Predict(ctx context.Context, tx domain.RuleTransaction) (*domain.ClassifierPrediction, error) {
+	features := classifierFeatures(tx.Description, tx.Amount)
+	if len(features) == 0 {
+		return nil, nil
+	}
+	model, err := c.repo.Model(ctx, features)
+	if err != nil {
+		return nil, err
+	}
+	if len(model.Documents) < minClassifierCategories {
+		return nil, nil
+	}
+
+	known := false
+	for _, feature := range features {
+		if !strings.HasPrefix(feature, amountFeature) && len(model.Counts[feature]) > 0 {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, nil
+	}
+
+	documents := 0
+	for _, n := range model.Documents {
+		documents += n
+	}
+
+	// Log-probabilities with Laplace smoothing, then normalized over the categories
+	scores := make(map[string]float64, len(model.Documents))
+	best, bestScore := "", math.Inf(-1)
+	for category, n := range model.Documents {
+		score := math.Log(float64(n) / float64(documents))
+		denominator := float64(model.Totals[category] + model.Vocabulary)
+		for _, feature := range features {
+			score += math.Log(float64(model.Counts[feature][category]+1) / denominator)
+		}
+		scores[category] = score
+		if score > bestScore || score == bestScore && category < best {
+			best, bestScore = category, score
+		}
+	}
+	var sum float64
+	for _, score := range scores {
+		sum += math.Exp(score - bestScore)
+	}
+	return &domain.ClassifierPrediction{Category: best, Probability: round2(1 / sum)}, nil
+}
+
+// amountFeature prefixes the amount bucket, which no description word can start with
+const amountFeature = "#amount:"
+
+// classifierFeatures are the words of a description that could make a rule,
+// plus the amount's bucket: half an order of magnitude, so 10,000 to 31,622
+// and 31,623 to 99,999 fall in different buckets
+func classifierFeatures(description string, amount *float64) []string {
+	features := suggestionWords(description)
+	if len(features) > 0 && amount != nil && *amount > 0 {
+		features = append(features, fmt.Sprintf("%s%d", amountFeature, int(math.Floor(2*math.Log10(*amount)))))
+	}
+	return features
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/suprie/budget-manager/internal/repository"
+	"github.com/suprie/budget-manager/pkg/database"
+)
+
+// The classifier learns from budgets the user or their rules chose, not from
+// its own guesses or the default budget of an import, including expenses that
+// predate the record of what chose their budget
+func TestClassifierTrainsOnCategorizedExpenses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := database.NewSQLiteDB(database.Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO users (email, password_hash, name) VALUES ('a@b.c', 'x', 'A')`,
+		`INSERT INTO pockets (name) VALUES ('Main')`,
+		`INSERT INTO budgets (name, description, pocket_id, period) VALUES ('Food', '', 1, '2025-01'), ('Inbox', '', 1, '2025-01')`,
+		`INSERT INTO expenses (budget_id, amount, description, date, categorized_by) VALUES
+			(1, 100, 'warung sate', '2025-01-02', ''),
+			(1, 100, 'warung bakso', '2025-01-03', 'rule'),
+			(1, 100, 'warung soto', '2025-01-04', 'classifier'),
+			(2, 100, 'transfer masuk', '2025-01-05', 'default')`,
+		// Written before categorized_by existed: approved from the default
+		// budget, and categorized by hand on import
+		`INSERT INTO expenses (budget_id, amount, description, date, categorized_by) VALUES
+			(2, 100, 'biaya admin', '2025-01-06', NULL),
+			(1, 100, 'warung nasi', '2025-01-07', NULL)`,
+		`INSERT INTO imports (user_id, bank, file_name) VALUES (1, 'bca', 'a.csv')`,
+		`INSERT INTO import_items (import_id, line, date, description, amount, direction, fingerprint, status, budget_id, expense_id, manual) VALUES
+			(1, 1, '2025-01-06', 'biaya admin', 100, 'debit', 'f1', 'imported', 2, 5, 0),
+			(1, 2, '2025-01-07', 'warung nasi', 100, 'debit', 'f2', 'imported', 1, 6, 1)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	// Reopening migrates the expenses without a method
+	db, err = database.NewSQLiteDB(database.Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	classifier := NewClassifier(repository.NewClassifierRepository(db), repository.NewExpenseRepository(db),
+		repository.NewBudgetRepository(db), repository.NewTxManager(db))
+	stats, err := classifier.Train(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Documents != 3 || stats.Categories != 1 {
+		t.Errorf("learned %d expenses in %d categories, want 3 in 1", stats.Documents, stats.Categories)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+)
+
+type CustomFieldService struct {
+	repo *repository.CustomFieldRepository
+}
+
+func NewCustomFieldService(repo *repository.CustomFieldRepository) *CustomFieldService {
+	return &CustomFieldService{repo: repo}
+}
+
+func (s *CustomFieldService) Create(ctx context.Context, req domain.CreateCustomFieldRequest) (*domain.CustomField, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || !req.Type.IsValid() {
+		return nil, domain.ErrInvalidInput
+	}
+
+	field := &domain.CustomField{
+		Name: name,
+		Type: req.Type,
+	}
+
+	if err := s.repo.Create(ctx, field); err != nil {
+		return nil, err
+	}
+
+	return field, nil
+}
+
+func (s *CustomFieldService) GetByID(ctx context.Context, id int64) (*domain.CustomField, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *CustomFieldService) GetAll(ctx context.Context) ([]*domain.CustomField, error) {
+	return s.repo.GetAll(ctx)
+}
+
+// Update renames a field. The type is fixed once values may have been stored.
+func (s *CustomFieldService) Update(ctx context.Context, id int64, req domain.UpdateCustomFieldRequest) (*domain.CustomField, error) {
+	field, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, domain.ErrInvalidInput
+		}
+		field.Name = name
+	}
+
+	if err := s.repo.Update(ctx, field); err != nil {
+		return nil, err
+	}
+
+	return field, nil
+}
+
+func (s *CustomFieldService) Delete(ctx context.Context, id int64) error {
+	return s.repo.Delete(ctx, id)
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+)
+
+const (
+	// duplicateWindow is how many days apart two records of one transaction
+	// may be dated, e.g. a card payment entered by hand and booked by the bank
+	// on the next working day
+	duplicateWindow = 3
+
+	// minDuplicateScore is the score from which expenses are reported as
+	// probable duplicates
+	minDuplicateScore = 0.5
+)
+
+// duplicateNoise are words of bank descriptions that say how money moved
+// rather than where it went
+var duplicateNoise = map[string]bool{
+	"PAYMENT": true, "PEMBAYARAN": true, "PURCHASE": true, "PEMBELIAN": true, "TRANSFER": true,
+	"OUTGOING": true, "INCOMING": true, "DEBIT": true, "KREDIT": true, "CREDIT": true, "QRIS": true,
+}
+
+// scoreDuplicate rates how likely two expenses record the same transaction,
+// or returns false when they cannot: a different kind or amount, dates too far
+// apart, or one refunding the other. The score weighs description similarity
+// against the distance between the dates.
+func scoreDuplicate(a, b *domain.Expense) (domain.DuplicateMatch, bool) {
+	if a.Type != b.Type || math.Abs(a.Amount-b.Amount) > splitTolerance {
+		return domain.DuplicateMatch{}, false
+	}
+	if (a.RefundOfID != nil && *a.RefundOfID == b.ID) || (b.RefundOfID != nil && *b.RefundOfID == a.ID) {
+		return domain.DuplicateMatch{}, false
+	}
+	days := int(math.Abs(a.Date.Sub(b.Date).Hours()) / 24)
+	if days > duplicateWindow {
+		return domain.DuplicateMatch{}, false
+	}
+
+	similarity := descriptionSimilarity(a.Description, b.Description)
+	if a.PayeeID != nil && b.PayeeID != nil && *a.PayeeID == *b.PayeeID {
+		similarity = max(similarity, 0.9)
+	}
+	closeness := 1 - float64(days)/(duplicateWindow+1)
+	return domain.DuplicateMatch{
+		ExpenseID:  b.ID,
+		Score:      round2(0.6*similarity + 0.4*closeness),
+		Similarity: round2(similarity),
+		DaysApart:  days,
+	}, true
+}
+
+// descriptionSimilarity compares two descriptions once bank markers, reference
+// numbers and noise words are dropped. It averages the share of the shorter
+// description's words found in the other, so that "IKEA" matches "KARTU DEBIT
+// IKEA ALAM SUTERA", with the overlap of their letter trigrams, which
+// tolerates abbreviations and typos.
+func descriptionSimilarity(a, b string) float64 {
+	wordsA, wordsB := duplicateWords(a), duplicateWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		wordsA, wordsB = strings.Fields(strings.ToUpper(a)), strings.Fields(strings.ToUpper(b))
+	}
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+	joinedA, joinedB := strings.Join(wordsA, " "), strings.Join(wordsB, " ")
+	if joinedA == joinedB {
+		return 1
+	}
+
+	common := 0
+	for _, word := range wordsA {
+		if slices.Contains(wordsB, word) {
+			common++
+		}
+	}
+	overlap := float64(common) / float64(min(len(wordsA), len(wordsB)))
+	return (min(overlap, 1) + trigramSimilarity(joinedA, joinedB)) / 2
+}
+
+func duplicateWords(description string) []string {
+	var words []string
+	for _, word := range strings.Fields(normalizeDescription(description)) {
+		if !duplicateNoise[word] && !slices.Contains(words, word) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// trigramSimilarity is the Dice coefficient of the letter trigrams of two strings
+func trigramSimilarity(a, b string) float64 {
+	gramsA, gramsB := trigrams(a), trigrams(b)
+	if len(gramsA) == 0 || len(gramsB) == 0 {
+		return 0
+	}
+	common := 0
+	for gram, n := range gramsA {
+		common += min(n, gramsB[gram])
+	}
+	total := 0
+	for _, n := range gramsA {
+		total += n
+	}
+	for _, n := range gramsB {
+		total += n
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+func trigrams(s string) map[string]int {
+	runes := []rune(" " + s + " ")
+	grams := make(map[string]int)
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])]++
+	}
+	return grams
+}
+
+func round2(x float64) float64 {
+	return math.Round(x*100) / 100
+}
+
+// FindDuplicates returns the stored expenses that probably record the same
+// transaction as the given one, best match first. The expense need not be
+// stored yet. Pairs dismissed before are left out.
+func (s *ExpenseService) FindDuplicates(ctx context.Context, expense *domain.Expense) ([]domain.DuplicateMatch, error) {
+	start := expense.Date.AddDate(0, 0, -duplicateWindow)
+	end := expense.Date.AddDate(0, 0, duplicateWindow)
+	low, high := expense.Amount-splitTolerance, expense.Amount+splitTolerance
+	page, err := s.expenseRepo.List(ctx, domain.ExpenseFilter{
+		StartDate: &start, EndDate: &end, MinAmount: &low, MaxAmount: &high,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dismissed, err := s.duplicateRepo.Dismissed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []domain.DuplicateMatch
+	for _, other := range page.Items {
+		if other.ID == expense.ID || dismissed[repository.NewDuplicateKey(expense.ID, other.ID)] {
+			continue
+		}
+		if match, ok := scoreDuplicate(expense, other); ok && match.Score >= minDuplicateScore {
+			matches = append(matches, match)
+		}
+	}
+	slices.SortFunc(matches, func(a, b domain.DuplicateMatch) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ExpenseID, b.ExpenseID)
+	})
+	return matches, nil
+}
+
+// ScanDuplicates pairs up the expenses in the filter's date range that
+// probably record the same transaction, most likely first
+func (s *ExpenseService) ScanDuplicates(ctx context.Context, filter domain.DuplicateFilter) ([]domain.DuplicatePair, error) {
+	if filter.StartDate != nil && filter.EndDate != nil && filter.StartDate.After(*filter.EndDate) {
+		return nil, domain.ErrInvalidInput
+	}
+	minScore := minDuplicateScore
+	if filter.MinScore != nil {
+		if *filter.MinScore < 0 || *filter.MinScore > 1 {
+			return nil, domain.ErrInvalidInput
+		}
+		minScore = *filter.MinScore
+	}
+
+	page, err := s.expenseRepo.List(ctx, domain.ExpenseFilter{StartDate: filter.StartDate, EndDate: filter.EndDate})
+	if err != nil {
+		return nil, err
+	}
+	dismissed, err := s.duplicateRepo.Dismissed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only expenses of the same amount can pair up, so compare within those
+	// groups, ordered by date so each expense meets only the ones nearby
+	groups := make(map[int64][]*domain.Expense)
+	for _, expense := range page.Items {
+		cents := int64(math.Round(expense.Amount * 100))
+		groups[cents] = append(groups[cents], expense)
+	}
+
+	var pairs []domain.DuplicatePair
+	for _, group := range groups {
+		slices.SortFunc(group, func(a, b *domain.Expense) int {
+			if c := a.Date.Compare(b.Date); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.ID, b.ID)
+		})
+		for i, a := range group {
+			for _, b := range group[i+1:] {
+				if b.Date.Sub(a.Date) > duplicateWindow*24*time.Hour {
+					break
+				}
+				if dismissed[repository.NewDuplicateKey(a.ID, b.ID)] {
+					continue
+				}
+				match, ok := scoreDuplicate(a, b)
+				if !ok || match.Score < minScore {
+					continue
+				}
+				older, newer := a, b
+				if newer.ID < older.ID {
+					older, newer = newer, older
+				}
+				pairs = append(pairs, domain.DuplicatePair{
+					Expense:    older,
+					Duplicate:  newer,
+					Score:      match.Score,
+					Similarity: match.Similarity,
+					DaysApart:  match.DaysApart,
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(pairs, func(a, b domain.DuplicatePair) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Expense.ID, b.Expense.ID); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Duplicate.ID, b.Duplicate.ID)
+	})
+	return pairs, nil
+}
+
+// ResolveDuplicate merges a pair of duplicates into the first expense, or
+// dismisses the pair so that it is not reported again, and returns the first
+// expense
+func (s *ExpenseService) ResolveDuplicate(ctx context.Context, req domain.ResolveDuplicateRequest) (*domain.Expense, error) {
+	if req.ExpenseID == req.DuplicateID {
+		return nil, domain.ErrInvalidInput
+	}
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		expense, err := s.expenseRepo.GetByID(ctx, req.ExpenseID)
+		if err != nil {
+			return err
+		}
+		duplicate, err := s.expenseRepo.GetByID(ctx, req.DuplicateID)
+		if err != nil {
+			return err
+		}
+
+		switch req.Action {
+		case domain.DuplicateDismiss:
+			return s.duplicateRepo.Dismiss(ctx, repository.NewDuplicateKey(expense.ID, duplicate.ID))
+		case domain.DuplicateMerge:
+			return s.merge(ctx, expense, duplicate)
+		default:
+			return domain.ErrInvalidInput
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.expenseRepo.GetByID(ctx, req.ExpenseID)
+}
+
+// merge deletes the duplicate, restoring its budgets, after handing its tags
+// and attachments to the expense, along with its notes and payee where the
+// expense has none
+func (s *ExpenseService) merge(ctx context.Context, expense, duplicate *domain.Expense) error {
+	if expense.Type != duplicate.Type {
+		return domain.ErrInvalidInput
+	}
+
+	if expense.Notes == "" || expense.PayeeID == nil {
+		if expense.Notes == "" {
+			expense.Notes = duplicate.Notes
+		}
+		if expense.PayeeID == nil {
+			expense.PayeeID = duplicate.PayeeID
+		}
+		if err := s.expenseRepo.Update(ctx, expense); err != nil {
+			return err
+		}
+	}
+
+	if len(duplicate.Tags) > 0 {
+		if err := s.setAttributes(ctx, expense, append(expense.Tags, duplicate.Tags...), nil); err != nil {
+			return err
+		}
+	}
+	if err := s.attachments.MoveAll(ctx, duplicate.ID, expense.ID); err != nil {
+		return err
+	}
+	return s.Delete(ctx, duplicate.ID)
+}
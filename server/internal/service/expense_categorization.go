@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// minGuessProbability is how sure the classifier must be for its guess to
+// choose the budget of an expense on its own
+const minGuessProbability = 0.8
+
+// chooseBudget charges an expense created without a budget to the budget the
+// rules pick for its description, moved to the expense's month. A guess of the
+// classifier must be sure enough. When nothing fits, the error lists the
+// budgets of that month, the classifier's guess first.
+func (s *ExpenseService) chooseBudget(ctx context.Context, expense *domain.Expense) error {
+	period := expense.Date.Format("2006-01")
+	match, err := s.rules.MatchBudget(ctx, domain.RuleTransaction{
+		Description: expense.Description,
+		Amount:      &expense.Amount,
+		Date:        &expense.Date,
+	}, period, nil)
+	if err != nil {
+		return err
+	}
+
+	var budget *domain.Budget
+	if match != nil {
+		if budget, err = s.budgetRepo.GetByID(ctx, match.BudgetID); err != nil {
+			return err
+		}
+	}
+	if budget == nil || budget.Period != period || match.Probability != nil && *match.Probability < minGuessProbability {
+		return s.needsCategorization(ctx, period, match)
+	}
+
+	expense.BudgetID = budget.ID
+	expense.Categorization = &domain.ExpenseCategorization{Method: domain.CategorizedByPayee}
+	switch {
+	case match.RuleID != nil:
+		expense.Categorization.Method, expense.Categorization.RuleID = domain.CategorizedByRule, match.RuleID
+	case match.Probability != nil:
+		expense.Categorization.Method, expense.Categorization.Probability = domain.CategorizedByClassifier, match.Probability
+	}
+	expense.CategorizedBy = expense.Categorization.Method
+	return nil
+}
+
+// needsCategorization builds the error listing the budgets of a period, by
+// name with the classifier's guess first
+func (s *ExpenseService) needsCategorization(ctx context.Context, period string, match *domain.RuleMatch) error {
+	budgets, err := s.budgetRepo.GetByPeriod(ctx, period)
+	if err != nil {
+		return err
+	}
+
+	candidates := make([]domain.BudgetCandidate, 0, len(budgets))
+	for _, budget := range budgets {
+		candidate := domain.BudgetCandidate{
+			BudgetID:  budget.ID,
+			Name:      budget.Name,
+			PocketID:  budget.PocketID,
+			Remaining: budget.RemainingAmount(),
+		}
+		if match != nil && match.BudgetID == budget.ID {
+			candidate.Probability = match.Probability
+		}
+		candidates = append(candidates, candidate)
+	}
+	if i := slices.IndexFunc(candidates, func(c domain.BudgetCandidate) bool { return c.Probability != nil }); i > 0 {
+		guess := candidates[i]
+		copy(candidates[1:i+1], candidates[:i])
+		candidates[0] = guess
+	}
+	return &domain.CategorizationError{Candidates: candidates}
+}
@@ -2,6 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
+	"math"
+	"slices"
 	"time"
 
 	"github.com/suprie/budget-manager/internal/domain"
@@ -9,34 +12,90 @@ import (
 )
 
 type ExpenseService struct {
-	expenseRepo *repository.ExpenseRepository
-	budgetRepo  *repository.BudgetRepository
+	expenseRepo     *repository.ExpenseRepository
+	budgetRepo      *repository.BudgetRepository
+	tagRepo         *repository.TagRepository
+	customFieldRepo *repository.CustomFieldRepository
+	attachments     *AttachmentService
+	payees          *PayeeService
+	rules           *BudgetRuleService
+	snapshotRepo    *repository.SnapshotRepository
+	duplicateRepo   *repository.DuplicateRepository
+	classifier      *Classifier
+	txManager       *repository.TxManager
 }
 
-func NewExpenseService(expenseRepo *repository.ExpenseRepository, budgetRepo *repository.BudgetRepository) *ExpenseService {
+func NewExpenseService(
+	expenseRepo *repository.ExpenseRepository,
+	budgetRepo *repository.BudgetRepository,
+	tagRepo *repository.TagRepository,
+	customFieldRepo *repository.CustomFieldRepository,
+	attachments *AttachmentService,
+	payees *PayeeService,
+	rules *BudgetRuleService,
+	snapshotRepo *repository.SnapshotRepository,
+	duplicateRepo *repository.DuplicateRepository,
+	classifier *Classifier,
+	txManager *repository.TxManager,
+) *ExpenseService {
 	return &ExpenseService{
-		expenseRepo: expenseRepo,
-		budgetRepo:  budgetRepo,
+		expenseRepo:     expenseRepo,
+		budgetRepo:      budgetRepo,
+		tagRepo:         tagRepo,
+		customFieldRepo: customFieldRepo,
+		attachments:     attachments,
+		payees:          payees,
+		rules:           rules,
+		snapshotRepo:    snapshotRepo,
+		duplicateRepo:   duplicateRepo,
+		classifier:      classifier,
+		txManager:       txManager,
 	}
 }
 
+// splitTolerance is how far a split expense's stated total may drift from the sum of its lines
+const splitTolerance = 0.005
+
 func (s *ExpenseService) Create(ctx context.Context, req domain.CreateExpenseRequest) (*domain.Expense, error) {
-	if req.Amount <= 0 {
-		return nil, domain.ErrInvalidInput
-	}
 	if req.Description == "" {
 		return nil, domain.ErrInvalidInput
 	}
 
-	// Verify budget exists and has enough funds
-	budget, err := s.budgetRepo.GetByID(ctx, req.BudgetID)
-	if err != nil {
-		return nil, err
+	expense := &domain.Expense{
+		BudgetID:      req.BudgetID,
+		Type:          req.Type,
+		RefundOfID:    req.RefundOfID,
+		PayeeID:       req.PayeeID,
+		Amount:        req.Amount,
+		Description:   req.Description,
+		Notes:         req.Notes,
+		CategorizedBy: req.CategorizedBy,
+	}
+	if expense.Type == "" {
+		expense.Type = domain.ExpenseTypeExpense
 	}
 
-	remaining := budget.RemainingAmount()
-	if remaining < req.Amount {
-		return nil, domain.ErrInsufficientFunds
+	switch {
+	case expense.IsRefund():
+		// Refunds credit a single envelope, which stand-alone refunds must name
+		if len(req.Splits) > 0 || req.Amount <= 0 {
+			return nil, domain.ErrInvalidInput
+		}
+		if req.RefundOfID == nil && req.BudgetID <= 0 {
+			return nil, domain.ErrInvalidInput
+		}
+	case expense.Type != domain.ExpenseTypeExpense || req.RefundOfID != nil:
+		return nil, domain.ErrInvalidInput
+	case len(req.Splits) > 0:
+		if err := setSplits(expense, req.Splits); err != nil {
+			return nil, err
+		}
+		// The total is optional for split expenses, but must agree with the lines when given
+		if req.Amount != 0 && math.Abs(req.Amount-expense.Amount) > splitTolerance {
+			return nil, domain.ErrInvalidInput
+		}
+	case req.Amount <= 0:
+		return nil, domain.ErrInvalidInput
 	}
 
 	// Parse date
@@ -44,20 +103,61 @@ func (s *ExpenseService) Create(ctx context.Context, req domain.CreateExpenseReq
 	if err != nil {
 		return nil, domain.ErrInvalidInput
 	}
+	expense.Date = expenseDate
 
-	expense := &domain.Expense{
-		BudgetID:    req.BudgetID,
-		Amount:      req.Amount,
-		Description: req.Description,
-		Date:        expenseDate,
+	if !expense.IsRefund() && !expense.IsSplit() && expense.BudgetID <= 0 {
+		if err := s.chooseBudget(ctx, expense); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := s.expenseRepo.Create(ctx, expense); err != nil {
-		return nil, err
-	}
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if expense.IsRefund() {
+			if err := s.checkLinkedRefund(ctx, expense); err != nil {
+				return err
+			}
+		}
 
-	// Update budget spent amount
-	if err := s.budgetRepo.UpdateSpentAmount(ctx, req.BudgetID, req.Amount); err != nil {
+		// Verify every budget exists and has enough funds, then charge it
+		if err := s.rebalance(ctx, nil, expense.Allocations()); err != nil {
+			return err
+		}
+
+		if expense.IsRefund() {
+			if err := s.checkStandaloneRefund(ctx, expense); err != nil {
+				return err
+			}
+		}
+
+		if err := s.setPayee(ctx, expense); err != nil {
+			return err
+		}
+
+		if err := s.expenseRepo.Create(ctx, expense); err != nil {
+			return err
+		}
+
+		if expense.IsSplit() {
+			if err := s.expenseRepo.ReplaceSplits(ctx, expense.ID, expense.Splits); err != nil {
+				return err
+			}
+		}
+		if err := s.setAttributes(ctx, expense, req.Tags, req.CustomFields); err != nil {
+			return err
+		}
+		if err := s.classifier.learn(ctx, expense, 1); err != nil {
+			return err
+		}
+		if c := expense.Categorization; c != nil && c.RuleID != nil {
+			if err := s.rules.RecordHit(ctx, *c.RuleID); err != nil {
+				return err
+			}
+		}
+
+		expense.PossibleDuplicates, err = s.FindDuplicates(ctx, expense)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -68,8 +168,15 @@ func (s *ExpenseService) GetByID(ctx context.Context, id int64) (*domain.Expense
 	return s.expenseRepo.GetByID(ctx, id)
 }
 
-func (s *ExpenseService) GetAll(ctx context.Context) ([]*domain.Expense, error) {
-	return s.expenseRepo.GetAll(ctx)
+// List returns the expenses matching the filter, one page at a time when a limit or cursor is set
+func (s *ExpenseService) List(ctx context.Context, filter domain.ExpenseFilter) (*domain.Page[*domain.Expense], error) {
+	if err := s.checkFilter(&filter); err != nil {
+		return nil, err
+	}
+	if err := checkListOptions(&filter.ListOptions); err != nil {
+		return nil, err
+	}
+	return s.expenseRepo.List(ctx, filter)
 }
 
 func (s *ExpenseService) GetByBudgetID(ctx context.Context, budgetID int64) ([]*domain.Expense, error) {
@@ -89,18 +196,62 @@ func (s *ExpenseService) GetByDateRange(ctx context.Context, startDate, endDate
 	return s.expenseRepo.GetByDateRange(ctx, start, end)
 }
 
+// Search ranks expenses matching the filter's text. At most one page is returned.
+func (s *ExpenseService) Search(ctx context.Context, filter domain.ExpenseFilter) ([]domain.ExpenseSearchResult, error) {
+	if err := s.checkFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case filter.Limit < 0:
+		return nil, domain.ErrInvalidInput
+	case filter.Limit == 0:
+		filter.Limit = defaultPageSize
+	case filter.Limit > maxPageSize:
+		filter.Limit = maxPageSize
+	}
+
+	return s.expenseRepo.Search(ctx, filter)
+}
+
+// checkFilter validates the ranges of an expense filter and normalizes its tags
+func (s *ExpenseService) checkFilter(filter *domain.ExpenseFilter) error {
+	if err := checkRange(filter.MinAmount, filter.MaxAmount); err != nil {
+		return err
+	}
+	if filter.StartDate != nil && filter.EndDate != nil && filter.StartDate.After(*filter.EndDate) {
+		return domain.ErrInvalidInput
+	}
+	if len(filter.Tags) > 0 {
+		filter.Tags = normalizeTags(filter.Tags)
+		if len(filter.Tags) == 0 {
+			return domain.ErrInvalidInput
+		}
+	}
+	return nil
+}
+
 func (s *ExpenseService) Update(ctx context.Context, id int64, req domain.UpdateExpenseRequest) (*domain.Expense, error) {
 	expense, err := s.expenseRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	oldAmount := expense.Amount
-	oldBudgetID := expense.BudgetID
+	oldAllocations := expense.Allocations()
+	old := *expense
 
 	if req.Description != nil {
 		expense.Description = *req.Description
 	}
+	if req.Notes != nil {
+		expense.Notes = *req.Notes
+	}
+	if req.PayeeID != nil {
+		expense.PayeeID = req.PayeeID
+		if *req.PayeeID == 0 {
+			expense.PayeeID = nil
+		}
+	}
 	if req.Date != nil {
 		expenseDate, err := time.Parse("2006-01-02", *req.Date)
 		if err != nil {
@@ -108,64 +259,371 @@ func (s *ExpenseService) Update(ctx context.Context, id int64, req domain.Update
 		}
 		expense.Date = expenseDate
 	}
-	if req.Amount != nil {
-		expense.Amount = *req.Amount
+
+	switch {
+	case expense.IsRefund() && len(req.Splits) > 0:
+		return nil, domain.ErrInvalidInput
+	case len(req.Splits) > 0:
+		if err := setSplits(expense, req.Splits); err != nil {
+			return nil, err
+		}
+		if req.Amount != nil && math.Abs(*req.Amount-expense.Amount) > splitTolerance {
+			return nil, domain.ErrInvalidInput
+		}
+	case expense.IsSplit() && req.Splits == nil:
+		// Amount and budget of a split expense follow from its lines
+		if req.Amount != nil && *req.Amount != expense.Amount {
+			return nil, domain.ErrInvalidInput
+		}
+		if req.BudgetID != nil && *req.BudgetID != expense.BudgetID {
+			return nil, domain.ErrInvalidInput
+		}
+	default:
+		// Single-budget expense, or a split expense being merged back into one budget
+		expense.Splits = nil
+		if req.Amount != nil {
+			expense.Amount = *req.Amount
+		}
+		if req.BudgetID != nil {
+			expense.BudgetID = *req.BudgetID
+		}
+	}
+	if expense.BudgetID != old.BudgetID || req.Splits != nil {
+		expense.CategorizedBy = "" // Chosen now, whatever chose it before
 	}
-	if req.BudgetID != nil {
-		expense.BudgetID = *req.BudgetID
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if expense.IsRefund() {
+			if err := s.checkLinkedRefund(ctx, expense); err != nil {
+				return err
+			}
+		} else if err := s.checkRefundsCovered(ctx, expense); err != nil {
+			return err
+		}
+
+		// Restore the old envelopes and charge the new ones
+		if err := s.rebalance(ctx, oldAllocations, expense.Allocations()); err != nil {
+			return err
+		}
+
+		if expense.IsRefund() {
+			if err := s.checkStandaloneRefund(ctx, expense); err != nil {
+				return err
+			}
+		}
+
+		if req.PayeeID != nil && expense.PayeeID != nil {
+			if err := s.setPayee(ctx, expense); err != nil {
+				return err
+			}
+		}
+
+		if err := s.expenseRepo.Update(ctx, expense); err != nil {
+			return err
+		}
+
+		if req.Splits != nil {
+			if err := s.expenseRepo.ReplaceSplits(ctx, expense.ID, expense.Splits); err != nil {
+				return err
+			}
+		}
+		if err := s.classifier.learn(ctx, &old, -1); err != nil {
+			return err
+		}
+		if err := s.classifier.learn(ctx, expense, 1); err != nil {
+			return err
+		}
+		return s.setAttributes(ctx, expense, req.Tags, req.CustomFields)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Handle budget changes
-	if expense.BudgetID != oldBudgetID {
-		// Moving to different budget
-		newBudget, err := s.budgetRepo.GetByID(ctx, expense.BudgetID)
+	return expense, nil
+}
+
+func (s *ExpenseService) Delete(ctx context.Context, id int64) error {
+	expense, err := s.expenseRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !expense.IsRefund() {
+		refunds, err := s.expenseRepo.GetRefunds(ctx, id)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if newBudget.RemainingAmount() < expense.Amount {
-			return nil, domain.ErrInsufficientFunds
+		if len(refunds) > 0 {
+			return domain.ErrExpenseHasRefunds
 		}
+	}
 
-		// Restore old budget
-		if err := s.budgetRepo.UpdateSpentAmount(ctx, oldBudgetID, -oldAmount); err != nil {
-			return nil, err
+	var attachments []*domain.Attachment
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Restore budget spent amounts
+		if err := s.rebalance(ctx, expense.Allocations(), nil); err != nil {
+			return err
 		}
-		// Deduct from new budget
-		if err := s.budgetRepo.UpdateSpentAmount(ctx, expense.BudgetID, expense.Amount); err != nil {
-			return nil, err
+
+		attachments, err = s.attachments.DetachAll(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.classifier.learn(ctx, expense, -1); err != nil {
+			return err
+		}
+
+		return s.expenseRepo.Delete(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Receipt files can only go once the expense is gone for good
+	s.attachments.RemoveBlobs(ctx, attachments)
+	return nil
+}
+
+// setAttributes stores the tags and custom field values of an expense. A nil
+// argument leaves that attribute unchanged. Unknown tags are created on the fly.
+func (s *ExpenseService) setAttributes(ctx context.Context, expense *domain.Expense, tags []string, customFields map[string]any) error {
+	if tags != nil {
+		names := normalizeTags(tags)
+		tagIDs := make([]int64, 0, len(names))
+		for _, name := range names {
+			tag, err := s.tagRepo.GetByName(ctx, name)
+			if errors.Is(err, domain.ErrNotFound) {
+				tag = &domain.Tag{Name: name}
+				err = s.tagRepo.Create(ctx, tag)
+			}
+			if err != nil {
+				return err
+			}
+			tagIDs = append(tagIDs, tag.ID)
+		}
+
+		if err := s.expenseRepo.ReplaceTags(ctx, expense.ID, tagIDs); err != nil {
+			return err
 		}
-	} else if expense.Amount != oldAmount {
-		// Same budget, different amount
-		diff := expense.Amount - oldAmount
-		budget, err := s.budgetRepo.GetByID(ctx, expense.BudgetID)
+		expense.Tags = names
+	}
+
+	if customFields != nil {
+		fields, err := s.customFieldRepo.GetAll(ctx)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if diff > 0 && budget.RemainingAmount() < diff {
-			return nil, domain.ErrInsufficientFunds
+		byName := make(map[string]*domain.CustomField, len(fields))
+		for _, field := range fields {
+			byName[field.Name] = field
 		}
-		if err := s.budgetRepo.UpdateSpentAmount(ctx, expense.BudgetID, diff); err != nil {
-			return nil, err
+
+		values := make(map[int64]string, len(customFields))
+		decoded := make(map[string]any, len(customFields))
+		for name, value := range customFields {
+			field, ok := byName[name]
+			if !ok {
+				return domain.ErrInvalidInput
+			}
+			if value == nil {
+				continue
+			}
+			stored, err := field.Type.Encode(value)
+			if err != nil {
+				return err
+			}
+			values[field.ID] = stored
+			decoded[name] = field.Type.Decode(stored)
+		}
+
+		if err := s.expenseRepo.ReplaceCustomValues(ctx, expense.ID, values); err != nil {
+			return err
+		}
+		expense.CustomFields = decoded
+	}
+	return nil
+}
+
+// normalizeTags normalizes, de-duplicates and sorts tag names, dropping empty ones
+func normalizeTags(tags []string) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if name := domain.NormalizeTagName(tag); name != "" {
+			names = append(names, name)
 		}
 	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
 
-	if err := s.expenseRepo.Update(ctx, expense); err != nil {
+// setPayee verifies an explicit payee, or resolves one from the description when none is given
+func (s *ExpenseService) setPayee(ctx context.Context, expense *domain.Expense) error {
+	if expense.PayeeID != nil {
+		_, err := s.payees.GetByID(ctx, *expense.PayeeID)
+		return err
+	}
+
+	match, err := s.payees.Resolve(ctx, expense.Description)
+	if err != nil {
+		return err
+	}
+	if match.Payee != nil {
+		expense.PayeeID = &match.Payee.ID
+	}
+	return nil
+}
+
+// GetRefunds returns the refunds linked to an expense
+func (s *ExpenseService) GetRefunds(ctx context.Context, id int64) ([]*domain.Expense, error) {
+	if _, err := s.expenseRepo.GetByID(ctx, id); err != nil {
 		return nil, err
 	}
+	return s.expenseRepo.GetRefunds(ctx, id)
+}
 
-	return expense, nil
+// checkLinkedRefund validates a refund against its original expense. The refund
+// defaults to the original's budget and, together with the other refunds to that
+// budget, may not exceed what the original charged to it.
+func (s *ExpenseService) checkLinkedRefund(ctx context.Context, refund *domain.Expense) error {
+	if refund.RefundOfID == nil {
+		return nil
+	}
+
+	original, err := s.expenseRepo.GetByID(ctx, *refund.RefundOfID)
+	if err != nil {
+		return err
+	}
+	if original.IsRefund() {
+		return domain.ErrInvalidInput
+	}
+
+	if refund.BudgetID == 0 {
+		refund.BudgetID = original.BudgetID
+	}
+	charged, ok := original.Allocations()[refund.BudgetID]
+	if !ok {
+		return domain.ErrInvalidInput
+	}
+
+	refunds, err := s.expenseRepo.GetRefunds(ctx, original.ID)
+	if err != nil {
+		return err
+	}
+
+	refunded := refund.Amount
+	for _, other := range refunds {
+		if other.ID != refund.ID && other.BudgetID == refund.BudgetID {
+			refunded += other.Amount
+		}
+	}
+	if refunded > charged+splitTolerance {
+		return domain.ErrRefundExceedsSpent
+	}
+	return nil
 }
 
-func (s *ExpenseService) Delete(ctx context.Context, id int64) error {
-	expense, err := s.expenseRepo.GetByID(ctx, id)
+// checkStandaloneRefund runs after the refund has been credited and makes sure
+// it did not return more to the envelope than had been spent from it
+func (s *ExpenseService) checkStandaloneRefund(ctx context.Context, refund *domain.Expense) error {
+	if refund.RefundOfID != nil {
+		return nil
+	}
+
+	budget, err := s.budgetRepo.GetByID(ctx, refund.BudgetID)
 	if err != nil {
 		return err
 	}
+	if budget.SpentAmount < -splitTolerance {
+		return domain.ErrRefundExceedsSpent
+	}
+	return nil
+}
 
-	// Restore budget spent amount
-	if err := s.budgetRepo.UpdateSpentAmount(ctx, expense.BudgetID, -expense.Amount); err != nil {
+// checkRefundsCovered makes sure an edited expense still covers the refunds
+// already linked to it, budget by budget
+func (s *ExpenseService) checkRefundsCovered(ctx context.Context, expense *domain.Expense) error {
+	refunds, err := s.expenseRepo.GetRefunds(ctx, expense.ID)
+	if err != nil {
 		return err
 	}
 
-	return s.expenseRepo.Delete(ctx, id)
+	allocations := expense.Allocations()
+	for budgetID, refunded := range refundTotals(refunds) {
+		if refunded > allocations[budgetID]+splitTolerance {
+			return domain.ErrRefundExceedsSpent
+		}
+	}
+	return nil
+}
+
+// refundTotals sums refund amounts per budget
+func refundTotals(refunds []*domain.Expense) map[int64]float64 {
+	totals := make(map[int64]float64)
+	for _, refund := range refunds {
+		totals[refund.BudgetID] += refund.Amount
+	}
+	return totals
+}
+
+// rebalance moves spent amounts from the old per-budget allocations to the new
+// ones. Every envelope whose spending grows must have enough remaining funds.
+func (s *ExpenseService) rebalance(ctx context.Context, oldAllocations, newAllocations map[int64]float64) error {
+	diffs := make(map[int64]float64)
+	for budgetID, amount := range newAllocations {
+		diffs[budgetID] += amount
+	}
+	for budgetID, amount := range oldAllocations {
+		diffs[budgetID] -= amount
+	}
+
+	budgetIDs := make([]int64, 0, len(diffs))
+	for budgetID := range diffs {
+		budgetIDs = append(budgetIDs, budgetID)
+	}
+	slices.Sort(budgetIDs)
+
+	changed := make([]int64, 0, len(budgetIDs))
+	for _, budgetID := range budgetIDs {
+		diff := diffs[budgetID]
+		if diff == 0 {
+			continue
+		}
+		if diff > 0 {
+			budget, err := s.budgetRepo.GetByID(ctx, budgetID)
+			if err != nil {
+				return err
+			}
+			if budget.RemainingAmount() < diff {
+				return domain.ErrInsufficientFunds
+			}
+		}
+		if err := s.budgetRepo.UpdateSpentAmount(ctx, budgetID, diff); err != nil {
+			return err
+		}
+		changed = append(changed, budgetID)
+	}
+	return s.snapshotRepo.RecordForBudgets(ctx, changed...)
+}
+
+// setSplits replaces the lines of an expense and derives its amount and primary
+// budget from them
+func setSplits(expense *domain.Expense, lines []domain.ExpenseSplitRequest) error {
+	splits := make([]domain.ExpenseSplit, 0, len(lines))
+	var total float64
+	for _, line := range lines {
+		if line.BudgetID <= 0 || line.Amount <= 0 {
+			return domain.ErrInvalidInput
+		}
+		splits = append(splits, domain.ExpenseSplit{
+			BudgetID:    line.BudgetID,
+			Amount:      line.Amount,
+			Description: line.Description,
+		})
+		total += line.Amount
+	}
+
+	expense.Splits = splits
+	expense.Amount = total
+	expense.BudgetID = splits[0].BudgetID
+	return nil
 }
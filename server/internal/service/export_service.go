@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/pkg/export"
+)
+
+// exportPageSize is how many rows an export loads at a time
+const exportPageSize = maxPageSize
+
+// exportColumn is a column an export can include
+type exportColumn[T any] struct {
+	name  string
+	value func(T) any
+}
+
+// ExportService streams expenses, budgets, pockets and rules into CSV or XLSX
+// files. Rows are loaded a page at a time through the list queries, so an
+// export honours the same filters and sort as the matching listing.
+type ExportService struct {
+	expenses *ExpenseService
+	budgets  *BudgetService
+	pockets  *PocketService
+	rules    *BudgetRuleService
+	payees   *PayeeService
+}
+
+func NewExportService(
+	expenses *ExpenseService,
+	budgets *BudgetService,
+	pockets *PocketService,
+	rules *BudgetRuleService,
+	payees *PayeeService,
+) *ExportService {
+	return &ExportService{
+		expenses: expenses,
+		budgets:  budgets,
+		pockets:  pockets,
+		rules:    rules,
+		payees:   payees,
+	}
+}
+
+// Expenses exports the expenses matching filter. The file is written to the
+// writer returned by open, which is only called once the options are valid and
+// the first page has loaded, so earlier errors can still be reported normally.
+func (s *ExportService) Expenses(ctx context.Context, filter domain.ExpenseFilter, opts domain.ExportOptions, open func() io.Writer) error {
+	budgets := make(map[int64]*domain.Budget)
+	payees := make(map[int64]string)
+
+	budgetName := func(id int64) string {
+		if budget := budgets[id]; budget != nil {
+			return budget.Name
+		}
+		return ""
+	}
+
+	// Names are looked up once per page for the budgets and payees it references
+	load := func(expenses []*domain.Expense) error {
+		for _, expense := range expenses {
+			ids := []int64{expense.BudgetID}
+			for _, split := range expense.Splits {
+				ids = append(ids, split.BudgetID)
+			}
+			for _, id := range ids {
+				if _, ok := budgets[id]; ok {
+					continue
+				}
+				budget, err := s.budgets.GetByID(ctx, id)
+				if err != nil && !errors.Is(err, domain.ErrNotFound) {
+					return err
+				}
+				budgets[id] = budget
+			}
+
+			if expense.PayeeID == nil {
+				continue
+			}
+			if _, ok := payees[*expense.PayeeID]; ok {
+				continue
+			}
+			payee, err := s.payees.GetByID(ctx, *expense.PayeeID)
+			switch {
+			case err == nil:
+				payees[*expense.PayeeID] = payee.Name
+			case errors.Is(err, domain.ErrNotFound):
+				payees[*expense.PayeeID] = ""
+			default:
+				return err
+			}
+		}
+		return nil
+	}
+
+	columns := []exportColumn[*domain.Expense]{
+		{"id", func(e *domain.Expense) any { return e.ID }},
+		{"date", func(e *domain.Expense) any { return e.Date }},
+		{"type", func(e *domain.Expense) any { return string(e.Type) }},
+		{"description", func(e *domain.Expense) any { return e.Description }},
+		{"payee_id", func(e *domain.Expense) any { return optionalID(e.PayeeID) }},
+		{"payee", func(e *domain.Expense) any {
+			if e.PayeeID == nil {
+				return nil
+			}
+			return payees[*e.PayeeID]
+		}},
+		{"budget_id", func(e *domain.Expense) any { return e.BudgetID }},
+		{"budget", func(e *domain.Expense) any { return budgetName(e.BudgetID) }},
+		{"pocket_id", func(e *domain.Expense) any {
+			if budget := budgets[e.BudgetID]; budget != nil {
+				return budget.PocketID
+			}
+			return nil
+		}},
+		{"amount", func(e *domain.Expense) any { return e.Amount }},
+		{"net_amount", func(e *domain.Expense) any {
+			if e.IsRefund() {
+				return -e.Amount
+			}
+			return e.Amount
+		}},
+		{"notes", func(e *domain.Expense) any { return e.Notes }},
+		{"tags", func(e *domain.Expense) any { return strings.Join(e.Tags, ", ") }},
+		{"splits", func(e *domain.Expense) any {
+			lines := make([]string, len(e.Splits))
+			for i, split := range e.Splits {
+				lines[i] = budgetName(split.BudgetID) + " " + strconv.FormatFloat(split.Amount, 'f', -1, 64)
+			}
+			return strings.Join(lines, "; ")
+		}},
+		{"refund_of_id", func(e *domain.Expense) any { return optionalID(e.RefundOfID) }},
+		{"created_at", func(e *domain.Expense) any { return e.CreatedAt }},
+		{"updated_at", func(e *domain.Expense) any { return e.UpdatedAt }},
+	}
+
+	return exportTable(opts, "Expenses", columns, open, func(cursor string) (*domain.Page[*domain.Expense], error) {
+		filter.Limit, filter.Cursor = exportPageSize, cursor
+		page, err := s.expenses.List(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		return page, load(page.Items)
+	})
+}
+
+// Budgets exports the budgets matching filter. See Expenses for open.
+func (s *ExportService) Budgets(ctx context.Context, filter domain.BudgetFilter, opts domain.ExportOptions, open func() io.Writer) error {
+	pockets, err := s.pocketNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	columns := []exportColumn[*domain.Budget]{
+		{"id", func(b *domain.Budget) any { return b.ID }},
+		{"name", func(b *domain.Budget) any { return b.Name }},
+		{"description", func(b *domain.Budget) any { return b.Description }},
+		{"pocket_id", func(b *domain.Budget) any { return b.PocketID }},
+		{"pocket", func(b *domain.Budget) any { return pockets[b.PocketID] }},
+		{"period", func(b *domain.Budget) any { return b.Period }},
+		{"allocated_amount", func(b *domain.Budget) any { return b.AllocatedAmount }},
+		{"spent_amount", func(b *domain.Budget) any { return b.SpentAmount }},
+		{"remaining_amount", func(b *domain.Budget) any { return b.RemainingAmount() }},
+		{"created_at", func(b *domain.Budget) any { return b.CreatedAt }},
+		{"updated_at", func(b *domain.Budget) any { return b.UpdatedAt }},
+	}
+
+	return exportTable(opts, "Budgets", columns, open, func(cursor string) (*domain.Page[*domain.Budget], error) {
+		filter.Limit, filter.Cursor = exportPageSize, cursor
+		return s.budgets.List(ctx, filter)
+	})
+}
+
+// Pockets exports every pocket. See Expenses for open.
+func (s *ExportService) Pockets(ctx context.Context, opts domain.ExportOptions, open func() io.Writer) error {
+	columns := []exportColumn[*domain.Pocket]{
+		{"id", func(p *domain.Pocket) any { return p.ID }},
+		{"name", func(p *domain.Pocket) any { return p.Name }},
+		{"description", func(p *domain.Pocket) any { return p.Description }},
+		{"balance", func(p *domain.Pocket) any { return p.Balance }},
+		{"created_at", func(p *domain.Pocket) any { return p.CreatedAt }},
+		{"updated_at", func(p *domain.Pocket) any { return p.UpdatedAt }},
+	}
+
+	// Pockets are few and have no paginated listing
+	return exportTable(opts, "Pockets", columns, open, func(string) (*domain.Page[*domain.Pocket], error) {
+		pockets, err := s.pockets.GetAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.Page[*domain.Pocket]{Items: pockets}, nil
+	})
+}
+
+// BudgetRules exports the budget rules matching filter. See Expenses for open.
+func (s *ExportService) BudgetRules(ctx context.Context, filter domain.BudgetRuleFilter, opts domain.ExportOptions, open func() io.Writer) error {
+	columns := []exportColumn[domain.BudgetRuleWithBudget]{
+		{"id", func(r domain.BudgetRuleWithBudget) any { return r.ID }},
+		{"budget_id", func(r domain.BudgetRuleWithBudget) any { return r.BudgetID }},
+		{"budget", func(r domain.BudgetRuleWithBudget) any { return r.BudgetName }},
+		{"keywords", func(r domain.BudgetRuleWithBudget) any { return r.Keywords }},
+		{"operator", func(r domain.BudgetRuleWithBudget) any { return string(r.Operator) }},
+		{"conditions", func(r domain.BudgetRuleWithBudget) any { return ruleConditionsJSON(r.Conditions) }},
+		{"priority", func(r domain.BudgetRuleWithBudget) any { return int64(r.Priority) }},
+		{"is_active", func(r domain.BudgetRuleWithBudget) any { return r.IsActive }},
+		{"created_at", func(r domain.BudgetRuleWithBudget) any { return r.CreatedAt }},
+		{"updated_at", func(r domain.BudgetRuleWithBudget) any { return r.UpdatedAt }},
+	}
+
+	return exportTable(opts, "Budget Rules", columns, open, func(cursor string) (*domain.Page[domain.BudgetRuleWithBudget], error) {
+		filter.Limit, filter.Cursor = exportPageSize, cursor
+		return s.rules.List(ctx, filter)
+	})
+}
+
+func (s *ExportService) pocketNames(ctx context.Context) (map[int64]string, error) {
+	pockets, err := s.pockets.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(pockets))
+	for _, pocket := range pockets {
+		names[pocket.ID] = pocket.Name
+	}
+	return names, nil
+}
+
+// exportTable writes the pages returned by fetch, starting with an empty cursor
+// and following NextCursor until the last page
+func exportTable[T any](opts domain.ExportOptions, sheet string, columns []exportColumn[T], open func() io.Writer, fetch func(cursor string) (*domain.Page[T], error)) error {
+	selected, err := exportColumns(columns, opts.Columns)
+	if err != nil {
+		return err
+	}
+	if opts.Format == "" {
+		opts.Format = domain.ExportCSV
+	}
+	if opts.Format != domain.ExportCSV && opts.Format != domain.ExportXLSX {
+		return domain.ErrInvalidInput
+	}
+	csvOptions := export.CSVOptions{
+		Delimiter:        opts.Delimiter,
+		DecimalSeparator: opts.DecimalSeparator,
+		BOM:              opts.BOM,
+	}
+	// Check the separators before anything is written
+	if _, err := export.NewCSV(io.Discard, csvOptions); err != nil {
+		return domain.ErrInvalidInput
+	}
+
+	page, err := fetch("")
+	if err != nil {
+		return err
+	}
+
+	var out export.Writer
+	if opts.Format == domain.ExportXLSX {
+		out, err = export.NewXLSX(open(), sheet)
+	} else {
+		out, err = export.NewCSV(open(), csvOptions)
+	}
+	if err != nil {
+		return err
+	}
+
+	header := make([]string, len(selected))
+	for i, column := range selected {
+		header[i] = column.name
+	}
+	if err := out.WriteHeader(header); err != nil {
+		return err
+	}
+
+	cells := make([]any, len(selected))
+	for {
+		for _, item := range page.Items {
+			for i, column := range selected {
+				cells[i] = column.value(item)
+			}
+			if err := out.WriteRow(cells); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if page, err = fetch(page.NextCursor); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// exportColumns picks the named columns in the requested order, or all of them
+func exportColumns[T any](columns []exportColumn[T], names []string) ([]exportColumn[T], error) {
+	if len(names) == 0 {
+		return columns, nil
+	}
+
+	selected := make([]exportColumn[T], 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(columns, func(column exportColumn[T]) bool { return column.name == name })
+		if i < 0 {
+			return nil, domain.ErrInvalidInput
+		}
+		selected = append(selected, columns[i])
+	}
+	return selected, nil
+}
+
+// optionalID returns the ID, or nil for an empty cell
+// ruleConditionsJSON writes rule conditions as in the API
+func ruleConditionsJSON(conditions []domain.RuleCondition) any {
+	data, err := json.Marshal(conditions)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+func optionalID(id *int64) any {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
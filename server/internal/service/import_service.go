@@ -0,0 +1,634 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+	"github.com/suprie/budget-manager/pkg/statement"
+)
+
+// MaxStatementSize is the largest bank statement accepted for import
+const MaxStatementSize = 5 << 20
+
+// ImportService turns bank statements into expenses. Every line goes through
+// ExpenseService, so imports are validated and charged like manual entries.
+type ImportService struct {
+	importRepo *repository.ImportRepository
+	budgetRepo *repository.BudgetRepository
+	pocketRepo *repository.PocketRepository
+	expenses   *ExpenseService
+	rules      *BudgetRuleService
+	txManager  *repository.TxManager
+}
+
+func NewImportService(
+	importRepo *repository.ImportRepository,
+	budgetRepo *repository.BudgetRepository,
+	pocketRepo *repository.PocketRepository,
+	expenses *ExpenseService,
+	rules *BudgetRuleService,
+	txManager *repository.TxManager,
+) *ImportService {
+	return &ImportService{
+		importRepo: importRepo,
+		budgetRepo: budgetRepo,
+		pocketRepo: pocketRepo,
+		expenses:   expenses,
+		rules:      rules,
+		txManager:  txManager,
+	}
+}
+
+// Banks lists the bank keys statements can be imported from
+func (s *ImportService) Banks() []string {
+	return statement.Banks()
+}
+
+// Import parses a statement and stages its lines for review. Debits await
+// approval as pending items, with the budget suggested by the budget rules or
+// else the default budget; debits of an account mapped to a pocket are only
+// matched to that pocket's budgets. Credits are skipped, and lines staged
+// before from an overlapping statement are reported as duplicates. Nothing
+// touches the budgets until items are approved.
+func (s *ImportService) Import(ctx context.Context, userID int64, req domain.ImportRequest, data []byte) (*domain.Import, error) {
+	if len(data) == 0 {
+		return nil, domain.ErrInvalidInput
+	}
+	if len(data) > MaxStatementSize {
+		return nil, domain.ErrFileTooLarge
+	}
+
+	parser, err := s.parser(req.Bank, data)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := parser.Parse(data)
+	if errors.Is(err, statement.ErrUnrecognized) {
+		return nil, domain.ErrUnsupportedMedia
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DefaultBudgetID != nil {
+		if _, err := s.budgetRepo.GetByID(ctx, *req.DefaultBudgetID); err != nil {
+			return nil, err
+		}
+	}
+	if req.AutoApprove < 0 || req.AutoApprove > 1 {
+		return nil, domain.ErrInvalidInput
+	}
+
+	imp := &domain.Import{
+		UserID:   userID,
+		Bank:     parser.Bank(),
+		FileName: req.FileName,
+		Status:   domain.ImportStaged,
+		DryRun:   req.DryRun,
+	}
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if !req.DryRun {
+			if err := s.importRepo.Create(ctx, imp); err != nil {
+				return err
+			}
+		}
+		matcher, err := s.rules.matcher(ctx)
+		if err != nil {
+			return err
+		}
+
+		occurrences := make(map[string]int)
+		pockets := make(map[string]*int64)
+		for i, tx := range transactions {
+			item := domain.ImportItem{
+				ImportID:    imp.ID,
+				Line:        i + 1,
+				Date:        tx.Date.Format("2006-01-02"),
+				Description: tx.Description,
+				Amount:      tx.Amount,
+				Direction:   string(tx.Direction),
+				Reference:   tx.Reference,
+				Account:     tx.Account,
+			}
+			key := transactionKey(imp.Bank, tx)
+			item.Fingerprint = fingerprint(key, occurrences[key])
+			occurrences[key]++
+
+			pocketID, ok := pockets[tx.Account]
+			if !ok && tx.Account != "" {
+				if pocketID, err = s.importRepo.GetAccountPocket(ctx, imp.Bank, tx.Account); err != nil {
+					return err
+				}
+				pockets[tx.Account] = pocketID
+			}
+
+			if err := s.stageItem(ctx, matcher, &item, pocketID, req.DefaultBudgetID); err != nil {
+				return err
+			}
+			if !req.DryRun {
+				if err := s.importRepo.CreateItem(ctx, &item); err != nil {
+					return err
+				}
+				if item.RuleID != nil {
+					if err := s.rules.RecordHit(ctx, *item.RuleID); err != nil {
+						return err
+					}
+				}
+			}
+			imp.Count(&item)
+			imp.Items = append(imp.Items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if req.DryRun || req.AutoApprove == 0 {
+		return imp, nil
+	}
+
+	if err := s.autoApprove(ctx, imp, req.AutoApprove); err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, imp.ID)
+}
+
+// autoApprove approves the staged lines whose single-budget suggestion is at
+// least as sure as the threshold and that do not look like duplicates. Each is
+// approved on its own, so a line its budget cannot afford stays pending with
+// the reason and the others are still recorded.
+func (s *ImportService) autoApprove(ctx context.Context, imp *domain.Import, threshold float64) error {
+	for i := range imp.Items {
+		item := &imp.Items[i]
+		if item.Status != domain.ImportItemPending || item.BudgetID == nil || item.DuplicateOfID != nil ||
+			item.Confidence == nil || *item.Confidence < threshold {
+			continue
+		}
+
+		_, err := s.approve(ctx, imp.ID, []int64{item.ID})
+		if errors.Is(err, domain.ErrInsufficientFunds) {
+			item.Message = "not approved automatically: " + domain.ErrInsufficientFunds.Error()
+			err = s.importRepo.UpdateItem(ctx, item)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageItem settles the initial status of a line and suggests its budget
+func (s *ImportService) stageItem(ctx context.Context, matcher *ruleMatcher, item *domain.ImportItem, pocketID, defaultID *int64) error {
+	if item.Direction == string(statement.Credit) {
+		item.Status, item.Message = domain.ImportItemSkipped, "incoming money is not an expense"
+		return nil
+	}
+
+	staged, err := s.importRepo.IsStaged(ctx, item.Fingerprint)
+	if err != nil {
+		return err
+	}
+	if staged {
+		item.Status = domain.ImportItemDuplicate
+		return nil
+	}
+
+	date, err := time.Parse("2006-01-02", item.Date)
+	if err != nil {
+		return err
+	}
+	item.Status = domain.ImportItemPending
+	if err := s.suggest(ctx, matcher, item, domain.RuleTransaction{
+		Description: item.Description,
+		Amount:      &item.Amount,
+		PocketID:    pocketID,
+		Date:        &date,
+	}, defaultID); err != nil {
+		return err
+	}
+	if item.BudgetID == nil {
+		item.Message = "no budget rule matches"
+		if pocketID != nil {
+			item.Message = fmt.Sprintf("no budget rule matches a budget of pocket %d", *pocketID)
+		}
+	}
+
+	// Catch expenses recorded by other means, which the fingerprint cannot
+	matches, err := s.expenses.FindDuplicates(ctx, &domain.Expense{
+		Type:        domain.ExpenseTypeExpense,
+		Amount:      item.Amount,
+		Description: item.Description,
+		Date:        date,
+	})
+	if err != nil {
+		return err
+	}
+	if len(matches) > 0 {
+		item.DuplicateOfID = &matches[0].ExpenseID
+		item.Message = fmt.Sprintf("probably repeats expense %d", matches[0].ExpenseID)
+	}
+	return nil
+}
+
+// GetByID returns an import with its lines
+func (s *ImportService) GetByID(ctx context.Context, id int64) (*domain.Import, error) {
+	imp, err := s.importRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if imp.Items, err = s.importRepo.GetItems(ctx, id, domain.ImportItemFilter{}); err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// List returns every import without its lines, newest first
+func (s *ImportService) List(ctx context.Context) ([]*domain.Import, error) {
+	return s.importRepo.List(ctx)
+}
+
+// Items returns the lines of an import
+func (s *ImportService) Items(ctx context.Context, importID int64, filter domain.ImportItemFilter) ([]domain.ImportItem, error) {
+	if _, err := s.importRepo.GetByID(ctx, importID); err != nil {
+		return nil, err
+	}
+	return s.importRepo.GetItems(ctx, importID, filter)
+}
+
+// UpdateItem reviews a pending item: recategorizing it clears the rule
+// suggestion, splits spread it over several budgets, and Ignored dismisses it
+// or brings it back
+func (s *ImportService) UpdateItem(ctx context.Context, importID, itemID int64, req domain.UpdateImportItemRequest) (*domain.ImportItem, error) {
+	var item *domain.ImportItem
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if item, err = s.reviewableItem(ctx, importID, itemID); err != nil {
+			return err
+		}
+
+		if req.Ignored != nil {
+			switch {
+			case *req.Ignored && item.Status == domain.ImportItemPending:
+				item.Status = domain.ImportItemIgnored
+			case !*req.Ignored && item.Status == domain.ImportItemIgnored:
+				item.Status = domain.ImportItemPending
+			case item.Status != domain.ImportItemPending && item.Status != domain.ImportItemIgnored:
+				return domain.ErrInvalidInput
+			}
+		}
+		if req.BudgetID == nil && req.Description == nil && req.Splits == nil {
+			return s.importRepo.UpdateItem(ctx, item)
+		}
+		if item.Status != domain.ImportItemPending {
+			return domain.ErrInvalidInput
+		}
+
+		if req.Description != nil {
+			if *req.Description == "" {
+				return domain.ErrInvalidInput
+			}
+			item.Description = *req.Description
+		}
+		if req.BudgetID != nil {
+			if err := s.categorize(ctx, item, *req.BudgetID); err != nil {
+				return err
+			}
+		}
+		if req.Splits != nil {
+			if err := s.checkSplits(ctx, item, req.Splits); err != nil {
+				return err
+			}
+			item.Splits = req.Splits
+			if len(item.Splits) > 0 {
+				item.Confidence, item.CategorizedBy, item.Message = nil, "", ""
+				item.Manual = true
+			}
+			if err := s.importRepo.ReplaceItemSplits(ctx, item.ID, item.Splits); err != nil {
+				return err
+			}
+		}
+		return s.importRepo.UpdateItem(ctx, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ApproveItem records one pending item as an expense
+func (s *ImportService) ApproveItem(ctx context.Context, importID, itemID int64) (*domain.ImportItem, error) {
+	if _, err := s.approve(ctx, importID, []int64{itemID}); err != nil {
+		return nil, err
+	}
+	return s.importRepo.GetItem(ctx, importID, itemID)
+}
+
+// Bulk applies an action to several items of an import at once. Either every
+// item is changed or, on the first failure, none is.
+func (s *ImportService) Bulk(ctx context.Context, importID int64, req domain.BulkImportItemsRequest) (*domain.Import, error) {
+	switch req.Action {
+	case domain.ImportApprove:
+		return s.approve(ctx, importID, req.ItemIDs)
+	case domain.ImportIgnore, domain.ImportRestore, domain.ImportCategorize:
+	default:
+		return nil, domain.ErrInvalidInput
+	}
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		from := domain.ImportItemPending
+		if req.Action == domain.ImportRestore {
+			from = domain.ImportItemIgnored
+		}
+		items, err := s.selectItems(ctx, importID, req.ItemIDs, from)
+		if err != nil {
+			return err
+		}
+
+		for i := range items {
+			item := &items[i]
+			switch req.Action {
+			case domain.ImportIgnore:
+				item.Status = domain.ImportItemIgnored
+			case domain.ImportRestore:
+				item.Status = domain.ImportItemPending
+			case domain.ImportCategorize:
+				if err := s.categorize(ctx, item, req.BudgetID); err != nil {
+					return err
+				}
+			}
+			if err := s.importRepo.UpdateItem(ctx, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, importID)
+}
+
+// approve records pending items as expenses in one transaction, so that a
+// failure such as insufficient funds leaves every item pending. Without IDs
+// every categorized pending item is approved, except probable duplicates.
+func (s *ImportService) approve(ctx context.Context, importID int64, itemIDs []int64) (*domain.Import, error) {
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		items, err := s.selectItems(ctx, importID, itemIDs, domain.ImportItemPending)
+		if err != nil {
+			return err
+		}
+
+		for i := range items {
+			item := &items[i]
+			if len(itemIDs) == 0 && (!item.Categorized() || item.DuplicateOfID != nil) {
+				continue
+			}
+			if !item.Categorized() {
+				return domain.ErrInvalidInput
+			}
+
+			req := domain.CreateExpenseRequest{
+				Amount:        item.Amount,
+				Description:   item.Description,
+				Date:          item.Date,
+				Splits:        item.Splits,
+				CategorizedBy: item.CategorizedBy,
+			}
+			if item.BudgetID != nil {
+				req.BudgetID = *item.BudgetID
+			}
+			expense, err := s.expenses.Create(ctx, req)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", item.Line, err)
+			}
+
+			item.Status, item.ExpenseID, item.Message = domain.ImportItemImported, &expense.ID, ""
+			if err := s.importRepo.UpdateItem(ctx, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, importID)
+}
+
+// Rollback discards a whole import: the expenses of its approved items are
+// deleted, restoring their budgets, and no item can be approved any more. The
+// lines can then be imported again.
+func (s *ImportService) Rollback(ctx context.Context, importID int64) (*domain.Import, error) {
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		imp, err := s.importRepo.GetByID(ctx, importID)
+		if err != nil {
+			return err
+		}
+		if imp.Status != domain.ImportStaged {
+			return domain.ErrInvalidInput
+		}
+
+		items, err := s.importRepo.GetItems(ctx, importID, domain.ImportItemFilter{})
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			item := &items[i]
+			if item.ExpenseID != nil {
+				// An expense deleted by hand needs no undoing
+				if err := s.expenses.Delete(ctx, *item.ExpenseID); err != nil && !errors.Is(err, domain.ErrNotFound) {
+					return fmt.Errorf("line %d: %w", item.Line, err)
+				}
+				item.ExpenseID = nil
+			}
+			if item.Status == domain.ImportItemSkipped || item.Status == domain.ImportItemDuplicate {
+				continue
+			}
+			item.Status = domain.ImportItemRolledBack
+			if err := s.importRepo.UpdateItem(ctx, item); err != nil {
+				return err
+			}
+		}
+		return s.importRepo.SetStatus(ctx, importID, domain.ImportRolledBack)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, importID)
+}
+
+// reviewableItem loads an item of an import that was not rolled back
+func (s *ImportService) reviewableItem(ctx context.Context, importID, itemID int64) (*domain.ImportItem, error) {
+	imp, err := s.importRepo.GetByID(ctx, importID)
+	if err != nil {
+		return nil, err
+	}
+	if imp.Status != domain.ImportStaged {
+		return nil, domain.ErrInvalidInput
+	}
+	return s.importRepo.GetItem(ctx, importID, itemID)
+}
+
+// selectItems returns the listed items, which must all have the given status,
+// or every item with that status when none are listed
+func (s *ImportService) selectItems(ctx context.Context, importID int64, itemIDs []int64, status domain.ImportItemStatus) ([]domain.ImportItem, error) {
+	imp, err := s.importRepo.GetByID(ctx, importID)
+	if err != nil {
+		return nil, err
+	}
+	if imp.Status != domain.ImportStaged {
+		return nil, domain.ErrInvalidInput
+	}
+
+	if len(itemIDs) == 0 {
+		return s.importRepo.GetItems(ctx, importID, domain.ImportItemFilter{Status: status})
+	}
+	items := make([]domain.ImportItem, 0, len(itemIDs))
+	for _, id := range itemIDs {
+		item, err := s.importRepo.GetItem(ctx, importID, id)
+		if err != nil {
+			return nil, err
+		}
+		if item.Status != status {
+			return nil, domain.ErrInvalidInput
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// categorize charges an item to a single budget, dropping its rule suggestion and splits
+func (s *ImportService) categorize(ctx context.Context, item *domain.ImportItem, budgetID int64) error {
+	if _, err := s.budgetRepo.GetByID(ctx, budgetID); err != nil {
+		return err
+	}
+	item.BudgetID, item.RuleID, item.Confidence, item.CategorizedBy, item.Message = &budgetID, nil, nil, "", ""
+	item.Manual = true
+	if len(item.Splits) > 0 {
+		item.Splits = nil
+		return s.importRepo.ReplaceItemSplits(ctx, item.ID, nil)
+	}
+	return nil
+}
+
+// checkSplits verifies that split lines name existing budgets and add up to the item's amount
+func (s *ImportService) checkSplits(ctx context.Context, item *domain.ImportItem, splits []domain.ExpenseSplitRequest) error {
+	var total float64
+	for _, split := range splits {
+		if split.BudgetID <= 0 || split.Amount <= 0 {
+			return domain.ErrInvalidInput
+		}
+		if _, err := s.budgetRepo.GetByID(ctx, split.BudgetID); err != nil {
+			return err
+		}
+		total += split.Amount
+	}
+	if len(splits) > 0 && math.Abs(total-item.Amount) > splitTolerance {
+		return domain.ErrInvalidInput
+	}
+	return nil
+}
+
+// SetAccount maps a statement account to a pocket
+func (s *ImportService) SetAccount(ctx context.Context, req domain.SetImportAccountRequest) (*domain.ImportAccount, error) {
+	parser, ok := statement.Lookup(req.Bank)
+	if !ok || strings.TrimSpace(req.Account) == "" {
+		return nil, domain.ErrInvalidInput
+	}
+	if _, err := s.pocketRepo.GetByID(ctx, req.PocketID); err != nil {
+		return nil, err
+	}
+
+	account := &domain.ImportAccount{Bank: parser.Bank(), Account: strings.TrimSpace(req.Account), PocketID: req.PocketID}
+	if err := s.importRepo.SetAccount(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *ImportService) ListAccounts(ctx context.Context) ([]domain.ImportAccount, error) {
+	return s.importRepo.ListAccounts(ctx)
+}
+
+func (s *ImportService) DeleteAccount(ctx context.Context, id int64) error {
+	return s.importRepo.DeleteAccount(ctx, id)
+}
+
+// parser selects the parser for a bank key, or detects it from the statement
+func (s *ImportService) parser(bank string, data []byte) (statement.StatementParser, error) {
+	if bank != "" {
+		parser, ok := statement.Lookup(bank)
+		if !ok {
+			return nil, domain.ErrInvalidInput
+		}
+		return parser, nil
+	}
+	parser, ok := statement.Detect(data)
+	if !ok {
+		return nil, domain.ErrUnsupportedMedia
+	}
+	return parser, nil
+}
+
+// suggest charges an item to the budget the budget rules pick for its
+// transaction, see BudgetRuleService.MatchBudget, noting the rule that picked
+// it, what did and how sure the pick is. Without a match the default budget is
+// suggested.
+func (s *ImportService) suggest(ctx context.Context, matcher *ruleMatcher, item *domain.ImportItem, tx domain.RuleTransaction, defaultID *int64) error {
+	match, err := s.rules.matchBudget(ctx, matcher, tx, tx.Date.Format("2006-01"), tx.PocketID)
+	if err != nil {
+		return err
+	}
+	if match == nil {
+		item.BudgetID, item.RuleID, item.Confidence, item.CategorizedBy = defaultID, nil, nil, ""
+		if defaultID != nil {
+			item.CategorizedBy = domain.CategorizedByDefault
+		}
+		return nil
+	}
+
+	item.BudgetID, item.RuleID, item.Confidence = &match.BudgetID, match.RuleID, match.Probability
+	switch {
+	case match.RuleID != nil:
+		item.CategorizedBy = domain.CategorizedByRule
+	case match.Probability != nil:
+		item.CategorizedBy = domain.CategorizedByClassifier
+	default:
+		item.CategorizedBy = domain.CategorizedByPayee
+	}
+	if item.Confidence == nil {
+		certain := 1.0
+		item.Confidence = &certain
+	}
+	return nil
+}
+
+// transactionKey identifies a transaction by its bank reference, such as an OFX
+// FITID, or failing that by its contents. References are only unique within an
+// account, so the account is part of the key.
+func transactionKey(bank string, tx statement.Transaction) string {
+	source := bank
+	if tx.Account != "" {
+		source += "|" + tx.Account
+	}
+	if tx.Reference != "" {
+		return source + "|ref|" + tx.Reference
+	}
+	description := strings.ToLower(strings.Join(strings.Fields(tx.Description), " "))
+	return fmt.Sprintf("%s|%s|%.2f|%s|%s", source, tx.Date.Format("2006-01-02"), tx.Amount, tx.Direction, description)
+}
+
+// fingerprint hashes a transaction key with its occurrence in the statement, so
+// identical purchases on one day stay apart while overlapping statements agree
+func fingerprint(key string, occurrence int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", key, occurrence)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/suprie/budget-manager/pkg/statement"
+)
+
+// fingerprints reads a statement fixture and fingerprints its lines as Upload does
+func fingerprints(t *testing.T, file string) []string {
+	t.Helper()
+	data, err := os.ReadFile("../../pkg/statement/testdata/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser, ok := statement.Detect(data)
+	if !ok {
+		t.Fatalf("%s: no parser detects it", file)
+	}
+	transactions, err := parser.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	occurrences := make(map[string]int)
+	var prints []string
+	for _, tx := range transactions {
+		key := transactionKey(parser.Bank(), tx)
+		prints = append(prints, fingerprint(key, occurrences[key]))
+		occurrences[key]++
+	}
+	return prints
+}
+
+func TestFingerprintsDedupeByFITID(t *testing.T) {
+	// quicken.qfx holds two identical purchases with different FITIDs
+	first := fingerprints(t, "quicken.qfx")
+	seen := make(map[string]bool)
+	for i, print := range first {
+		if seen[print] {
+			t.Errorf("line %d shares a fingerprint with an earlier line", i+1)
+		}
+		seen[print] = true
+	}
+
+	// The same statement exported again is recognised line by line
+	for i, print := range fingerprints(t, "quicken.qfx") {
+		if print != first[i] {
+			t.Errorf("line %d: fingerprint changed between imports", i+1)
+		}
+	}
+
+	// A FITID identifies a line whatever its description says
+	tx := statement.Transaction{Description: "STARBUCKS #123", Amount: 12.34, Direction: statement.Debit, Reference: "QFX-1", Account: "a"}
+	renamed := tx
+	renamed.Description = "Starbucks Coffee"
+	if transactionKey("ofx", tx) != transactionKey("ofx", renamed) {
+		t.Error("lines with one FITID got different keys")
+	}
+	// but only within its account
+	other := tx
+	other.Account = "b"
+	if transactionKey("ofx", tx) == transactionKey("ofx", other) {
+		t.Error("lines of two accounts with one FITID got the same key")
+	}
+}
+
+func TestFingerprintsWithoutReferences(t *testing.T) {
+	// Without references, identical lines on one day stay apart by occurrence
+	tx := statement.Transaction{Description: "Parkir", Amount: 5000, Direction: statement.Debit}
+	key := transactionKey("qif", tx)
+	if fingerprint(key, 0) == fingerprint(key, 1) {
+		t.Error("repeated identical lines got the same fingerprint")
+	}
+	spaced := tx
+	spaced.Description = "  PARKIR "
+	if transactionKey("qif", spaced) != key {
+		t.Error("case and spacing changed the key")
+	}
+}
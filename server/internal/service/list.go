@@ -0,0 +1,32 @@
+package service
+
+import (
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// Default and maximum number of items in one page of a list
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// checkListOptions validates paging and applies the page size limits
+func checkListOptions(opts *domain.ListOptions) error {
+	switch {
+	case opts.Limit < 0:
+		return domain.ErrInvalidInput
+	case opts.Limit == 0 && opts.Cursor != "":
+		opts.Limit = defaultPageSize
+	case opts.Limit > maxPageSize:
+		opts.Limit = maxPageSize
+	}
+	return nil
+}
+
+// checkRange rejects a range whose minimum exceeds its maximum
+func checkRange(min, max *float64) error {
+	if min != nil && max != nil && *min > *max {
+		return domain.ErrInvalidInput
+	}
+	return nil
+}
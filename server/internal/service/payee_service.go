@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+)
+
+// bankPrefixes are transfer and card markers that banks prepend to statement descriptions
+var bankPrefixes = []string{
+	"TRSF E-BANKING DB",
+	"TRSF E-BANKING CR",
+	"SWITCHING DB",
+	"SWITCHING CR",
+	"BI-FAST DB",
+	"BI-FAST CR",
+	"KARTU DEBIT",
+	"KARTU KREDIT",
+	"TARIKAN ATM",
+	"QRIS",
+}
+
+// normalizeDescription reduces a raw statement description to the words that identify the payee,
+// e.g. "TRSF E-BANKING DB 0301/FTSCY/WS95031 GOFOOD" becomes "GOFOOD"
+func normalizeDescription(description string) string {
+	desc := strings.ToUpper(strings.TrimSpace(description))
+	for _, prefix := range bankPrefixes {
+		if strings.HasPrefix(desc, prefix) {
+			desc = strings.TrimSpace(desc[len(prefix):])
+			break
+		}
+	}
+
+	var words []string
+	for _, token := range strings.Fields(desc) {
+		if strings.ContainsAny(token, "0123456789/") {
+			continue
+		}
+		token = strings.Trim(token, "-*.,:;#")
+		if token != "" {
+			words = append(words, token)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+type PayeeService struct {
+	repo      *repository.PayeeRepository
+	txManager *repository.TxManager
+}
+
+func NewPayeeService(repo *repository.PayeeRepository, txManager *repository.TxManager) *PayeeService {
+	return &PayeeService{repo: repo, txManager: txManager}
+}
+
+func (s *PayeeService) Create(ctx context.Context, req domain.CreatePayeeRequest) (*domain.Payee, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, domain.ErrInvalidInput
+	}
+
+	payee := &domain.Payee{
+		Name:            name,
+		DefaultCategory: strings.TrimSpace(req.DefaultCategory),
+	}
+	if err := s.repo.Create(ctx, payee); err != nil {
+		return nil, err
+	}
+
+	return payee, nil
+}
+
+func (s *PayeeService) GetByID(ctx context.Context, id int64) (*domain.Payee, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *PayeeService) GetAll(ctx context.Context) ([]*domain.Payee, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *PayeeService) Update(ctx context.Context, id int64, req domain.UpdatePayeeRequest) (*domain.Payee, error) {
+	payee, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, domain.ErrInvalidInput
+		}
+		payee.Name = name
+	}
+	if req.DefaultCategory != nil {
+		payee.DefaultCategory = strings.TrimSpace(*req.DefaultCategory)
+	}
+
+	if err := s.repo.Update(ctx, payee); err != nil {
+		return nil, err
+	}
+
+	return payee, nil
+}
+
+func (s *PayeeService) Delete(ctx context.Context, id int64) error {
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		return s.repo.Delete(ctx, id)
+	})
+}
+
+// Merge folds the source payees into the target, keeping their expenses and rules
+func (s *PayeeService) Merge(ctx context.Context, targetID int64, req domain.MergePayeesRequest) (*domain.Payee, error) {
+	if len(req.SourceIDs) == 0 {
+		return nil, domain.ErrInvalidInput
+	}
+
+	target, err := s.repo.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		for _, sourceID := range req.SourceIDs {
+			if sourceID == targetID {
+				return domain.ErrInvalidInput
+			}
+			if _, err := s.repo.GetByID(ctx, sourceID); err != nil {
+				return err
+			}
+		}
+		return s.repo.Merge(ctx, targetID, req.SourceIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+func (s *PayeeService) CreateRule(ctx context.Context, payeeID int64, req domain.CreatePayeeRuleRequest) (*domain.PayeeRule, error) {
+	if _, err := s.repo.GetByID(ctx, payeeID); err != nil {
+		return nil, err
+	}
+
+	matchType := req.MatchType
+	if matchType == "" {
+		matchType = domain.PayeeMatchContains
+	}
+
+	pattern := strings.TrimSpace(req.Pattern)
+	if pattern == "" {
+		return nil, domain.ErrInvalidInput
+	}
+
+	switch matchType {
+	case domain.PayeeMatchContains, domain.PayeeMatchPrefix, domain.PayeeMatchExact:
+		pattern = normalizeDescription(pattern)
+		if pattern == "" {
+			return nil, domain.ErrInvalidInput
+		}
+	case domain.PayeeMatchRegex:
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, domain.ErrInvalidInput
+		}
+	default:
+		return nil, domain.ErrInvalidInput
+	}
+
+	rule := &domain.PayeeRule{
+		PayeeID:   payeeID,
+		MatchType: matchType,
+		Pattern:   pattern,
+		Priority:  req.Priority,
+	}
+	if err := s.repo.CreateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (s *PayeeService) GetRules(ctx context.Context, payeeID int64) ([]domain.PayeeRule, error) {
+	if _, err := s.repo.GetByID(ctx, payeeID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRulesByPayeeID(ctx, payeeID)
+}
+
+func (s *PayeeService) DeleteRule(ctx context.Context, id int64) error {
+	return s.repo.DeleteRule(ctx, id)
+}
+
+func (s *PayeeService) GetStats(ctx context.Context, id int64) (*domain.PayeeStats, error) {
+	payee, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetStats(ctx, payee)
+}
+
+// Normalize returns the cleaned form of a description without resolving a payee
+func (s *PayeeService) Normalize(description string) string {
+	return normalizeDescription(description)
+}
+
+// Resolve maps a raw description to a payee, first through rules in priority order
+// and then by whole-word payee name. The returned match has a nil Payee when nothing matched.
+func (s *PayeeService) Resolve(ctx context.Context, description string) (*domain.PayeeMatch, error) {
+	match := &domain.PayeeMatch{
+		Description: description,
+		Normalized:  normalizeDescription(description),
+	}
+	if match.Normalized == "" {
+		return match, nil
+	}
+
+	matcher, err := s.matcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	match.Payee, match.RuleID = matcher.match(match.Normalized)
+	return match, nil
+}
+
+// payeeMatcher resolves normalized descriptions as Resolve does, against payee
+// rules and payees loaded once, with regex patterns compiled and payee names
+// normalized up front
+type payeeMatcher struct {
+	rules    []domain.PayeeRule
+	patterns map[int64]*regexp.Regexp // Regex rules by ID; invalid patterns match nothing
+	payees   []*domain.Payee
+	names    []string // Normalized name of each payee
+	byID     map[int64]*domain.Payee
+}
+
+// matcher loads the payee rules and payees for resolving many descriptions in a row
+func (s *PayeeService) matcher(ctx context.Context) (*payeeMatcher, error) {
+	rules, err := s.repo.GetAllRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payees, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &payeeMatcher{
+		rules:    rules,
+		patterns: make(map[int64]*regexp.Regexp),
+		payees:   payees,
+		names:    make([]string, len(payees)),
+		byID:     make(map[int64]*domain.Payee, len(payees)),
+	}
+	for _, rule := range rules {
+		if rule.MatchType == domain.PayeeMatchRegex {
+			if re, err := regexp.Compile("(?i)" + rule.Pattern); err == nil {
+				m.patterns[rule.ID] = re
+			}
+		}
+	}
+	for i, payee := range payees {
+		m.names[i] = normalizeDescription(payee.Name)
+		m.byID[payee.ID] = payee
+	}
+	return m, nil
+}
+
+// match returns the payee of a normalized description, with the rule that
+// picked it if one did, or nil when nothing matched
+func (m *payeeMatcher) match(normalized string) (*domain.Payee, *int64) {
+	if normalized == "" {
+		return nil, nil
+	}
+	for _, rule := range m.rules {
+		if payee := m.byID[rule.PayeeID]; payee != nil && m.ruleMatches(rule, normalized) {
+			ruleID := rule.ID
+			return payee, &ruleID
+		}
+	}
+
+	padded := " " + normalized + " "
+	for i, payee := range m.payees {
+		if name := m.names[i]; name != "" && strings.Contains(padded, " "+name+" ") {
+			return payee, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *payeeMatcher) ruleMatches(rule domain.PayeeRule, normalized string) bool {
+	switch rule.MatchType {
+	case domain.PayeeMatchPrefix:
+		return strings.HasPrefix(normalized, rule.Pattern)
+	case domain.PayeeMatchExact:
+		return normalized == rule.Pattern
+	case domain.PayeeMatchRegex:
+		re := m.patterns[rule.ID]
+		return re != nil && re.MatchString(normalized)
+	default:
+		return strings.Contains(normalized, rule.Pattern)
+	}
+}
+
+// ResolveExpenses links every expense without a payee to the payee its description resolves to
+// and returns the number of expenses linked
+func (s *PayeeService) ResolveExpenses(ctx context.Context) (int, error) {
+	linked := 0
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		expenses, err := s.repo.GetUnlinkedExpenses(ctx)
+		if err != nil {
+			return err
+		}
+		matcher, err := s.matcher(ctx)
+		if err != nil {
+			return err
+		}
+
+		for id, description := range expenses {
+			payee, _ := matcher.match(normalizeDescription(description))
+			if payee == nil {
+				continue
+			}
+			if err := s.repo.LinkExpense(ctx, id, payee.ID); err != nil {
+				return err
+			}
+			linked++
+		}
+		return nil
+	})
+	return linked, err
+}
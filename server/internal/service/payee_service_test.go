@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/suprie/budget-manager/internal/repository"
+	"github.com/suprie/budget-manager/pkg/database"
+)
+
+func TestResolveExpenses(t *testing.T) {
+	db, err := database.NewSQLiteDB(database.Config{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range []string{
+		`INSERT INTO pockets (name) VALUES ('Main')`,
+		`INSERT INTO budgets (name, description, pocket_id, period) VALUES ('Food', '', 1, '2025-01')`,
+		`INSERT INTO payees (name) VALUES ('Gojek'), ('Grab'), ('Indomaret'), ('Broken')`,
+		`INSERT INTO payee_rules (payee_id, match_type, pattern, priority) VALUES
+			(1, 'regex', '^go(food|ride)\b', 10),
+			(2, 'prefix', 'GRAB', 5),
+			(4, 'regex', '(unclosed', 20)`,
+		`INSERT INTO expenses (budget_id, amount, description, date) VALUES
+			(1, 1, 'TRSF E-BANKING DB 0301/FTSCY/WS95031 GOFOOD JAKARTA', '2025-01-02'),
+			(1, 1, 'GrabFood 123', '2025-01-03'),
+			(1, 1, 'KARTU DEBIT INDOMARET CIPETE', '2025-01-04'),
+			(1, 1, 'Parkir', '2025-01-05'),
+			(1, 1, '(unclosed', '2025-01-06')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	payees := NewPayeeService(repository.NewPayeeRepository(db), repository.NewTxManager(db))
+	linked, err := payees.ResolveExpenses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked != 3 {
+		t.Errorf("linked %d expenses, want 3", linked)
+	}
+
+	// A regex rule, a prefix rule and a whole-word payee name; nothing for
+	// parking, and an invalid pattern matches nothing
+	rows, err := db.Query(`SELECT id, COALESCE(payee_id, 0) FROM expenses ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	want := map[int64]int64{1: 1, 2: 2, 3: 3, 4: 0, 5: 0}
+	for rows.Next() {
+		var id, payeeID int64
+		if err := rows.Scan(&id, &payeeID); err != nil {
+			t.Fatal(err)
+		}
+		if payeeID != want[id] {
+			t.Errorf("expense %d linked to payee %d, want %d", id, payeeID, want[id])
+		}
+	}
+}
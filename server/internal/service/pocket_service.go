@@ -8,11 +8,12 @@ import (
 )
 
 type PocketService struct {
-	repo *repository.PocketRepository
+	repo         *repository.PocketRepository
+	snapshotRepo *repository.SnapshotRepository
 }
 
-func NewPocketService(repo *repository.PocketRepository) *PocketService {
-	return &PocketService{repo: repo}
+func NewPocketService(repo *repository.PocketRepository, snapshotRepo *repository.SnapshotRepository) *PocketService {
+	return &PocketService{repo: repo, snapshotRepo: snapshotRepo}
 }
 
 func (s *PocketService) Create(ctx context.Context, req domain.CreatePocketRequest) (*domain.Pocket, error) {
@@ -29,6 +30,9 @@ func (s *PocketService) Create(ctx context.Context, req domain.CreatePocketReque
 	if err := s.repo.Create(ctx, pocket); err != nil {
 		return nil, err
 	}
+	if err := s.snapshotRepo.Record(ctx, pocket.ID); err != nil {
+		return nil, err
+	}
 
 	return pocket, nil
 }
@@ -60,6 +64,11 @@ func (s *PocketService) Update(ctx context.Context, id int64, req domain.UpdateP
 	if err := s.repo.Update(ctx, pocket); err != nil {
 		return nil, err
 	}
+	if req.Balance != nil {
+		if err := s.snapshotRepo.Record(ctx, pocket.ID); err != nil {
+			return nil, err
+		}
+	}
 
 	return pocket, nil
 }
@@ -76,6 +85,9 @@ func (s *PocketService) AddFunds(ctx context.Context, id int64, amount float64)
 	if err := s.repo.UpdateBalance(ctx, id, amount); err != nil {
 		return nil, err
 	}
+	if err := s.snapshotRepo.Record(ctx, id); err != nil {
+		return nil, err
+	}
 
 	return s.repo.GetByID(ctx, id)
 }
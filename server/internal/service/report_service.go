@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+)
+
+// Limits of the report parameters
+const (
+	defaultTrendMonths = 6
+	maxTrendMonths     = 36
+	defaultTopPayees   = 10
+	maxTopPayees       = 100
+	maxSeriesPoints    = 1000
+)
+
+type ReportService struct {
+	repo *repository.ReportRepository
+}
+
+func NewReportService(repo *repository.ReportRepository) *ReportService {
+	return &ReportService{repo: repo}
+}
+
+// reportFilter parses a "2006-01-02" date range, defaulting to the current month
+func reportFilter(startDate, endDate string, pocketID *int64) (domain.ReportFilter, error) {
+	now := time.Now().UTC()
+	filter := domain.ReportFilter{
+		StartDate: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+		PocketID:  pocketID,
+	}
+	filter.EndDate = filter.StartDate.AddDate(0, 1, -1)
+
+	if startDate != "" {
+		t, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return filter, domain.ErrInvalidInput
+		}
+		filter.StartDate = t
+	}
+	if endDate != "" {
+		t, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return filter, domain.ErrInvalidInput
+		}
+		filter.EndDate = t
+	}
+
+	if filter.StartDate.After(filter.EndDate) {
+		return filter, domain.ErrInvalidInput
+	}
+	return filter, nil
+}
+
+// SpendingByCategory splits the spending in a date range by budget name
+func (s *ReportService) SpendingByCategory(ctx context.Context, startDate, endDate string, pocketID *int64) (*domain.CategoryReport, error) {
+	filter, err := reportFilter(startDate, endDate, pocketID)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.repo.SpendingByCategory(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &domain.CategoryReport{
+		StartDate:  filter.StartDate.Format("2006-01-02"),
+		EndDate:    filter.EndDate.Format("2006-01-02"),
+		Categories: []domain.CategoryTotal{},
+	}
+	for _, category := range categories {
+		report.Total += category.Total
+		report.GrossSpent += category.GrossSpent
+		report.TotalRefunds += category.TotalRefunds
+	}
+	for _, category := range categories {
+		if report.Total > 0 {
+			category.Share = category.Total / report.Total
+		}
+		report.Categories = append(report.Categories, category)
+	}
+	return report, nil
+}
+
+// Trends returns monthly spending per category for the months up to endPeriod,
+// which defaults to the current month
+func (s *ReportService) Trends(ctx context.Context, endPeriod string, months int, pocketID *int64) (*domain.TrendReport, error) {
+	switch {
+	case months == 0:
+		months = defaultTrendMonths
+	case months < 0 || months > maxTrendMonths:
+		return nil, domain.ErrInvalidInput
+	}
+
+	end := time.Now().UTC()
+	if endPeriod != "" {
+		t, err := time.Parse("2006-01", endPeriod)
+		if err != nil {
+			return nil, domain.ErrInvalidInput
+		}
+		end = t
+	}
+	first := time.Date(end.Year(), end.Month()-time.Month(months-1), 1, 0, 0, 0, 0, time.UTC)
+
+	filter := domain.ReportFilter{
+		StartDate: first,
+		EndDate:   first.AddDate(0, months, -1),
+		PocketID:  pocketID,
+	}
+	totals, err := s.repo.MonthlyByCategory(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &domain.TrendReport{
+		Periods:      make([]string, months),
+		Totals:       make([]float64, months),
+		GrossTotals:  make([]float64, months),
+		RefundTotals: make([]float64, months),
+		Series:       []domain.TrendSeries{},
+	}
+	index := make(map[string]int, months)
+	for i := range months {
+		report.Periods[i] = first.AddDate(0, i, 0).Format("2006-01")
+		index[report.Periods[i]] = i
+	}
+
+	// Rows are ordered by category, so each series is completed before the next starts
+	for _, total := range totals {
+		if n := len(report.Series); n == 0 || report.Series[n-1].Category != total.Category {
+			report.Series = append(report.Series, domain.TrendSeries{
+				Category: total.Category,
+				Values:   make([]float64, months),
+				Gross:    make([]float64, months),
+				Refunds:  make([]float64, months),
+			})
+		}
+		i := index[total.Month]
+		series := &report.Series[len(report.Series)-1]
+		series.Values[i] = total.Total
+		series.Gross[i] = total.GrossSpent
+		series.Refunds[i] = total.TotalRefunds
+		report.Totals[i] += total.Total
+		report.GrossTotals[i] += total.GrossSpent
+		report.RefundTotals[i] += total.TotalRefunds
+	}
+
+	for i := range report.Series {
+		series := &report.Series[i]
+		series.Changes = make([]*float64, months)
+		for j := 1; j < months; j++ {
+			if previous := series.Values[j-1]; previous != 0 {
+				change := (series.Values[j] - previous) / previous * 100
+				series.Changes[j] = &change
+			}
+		}
+	}
+	return report, nil
+}
+
+// Variance compares allocations with spending for each budget of a period,
+// most overspent first. The period defaults to the current month.
+func (s *ReportService) Variance(ctx context.Context, period string, pocketID *int64) (*domain.VarianceReport, error) {
+	if period == "" {
+		period = time.Now().Format("2006-01")
+	}
+	if _, err := time.Parse("2006-01", period); err != nil {
+		return nil, domain.ErrInvalidInput
+	}
+
+	budgets, err := s.repo.Variance(ctx, period, pocketID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &domain.VarianceReport{Period: period, Budgets: []domain.BudgetVariance{}}
+	for _, budget := range budgets {
+		report.TotalAllocated += budget.AllocatedAmount
+		report.TotalSpent += budget.SpentAmount
+		report.Budgets = append(report.Budgets, budget)
+	}
+	report.TotalVariance = report.TotalAllocated - report.TotalSpent
+	return report, nil
+}
+
+// TopPayees returns the payees with the highest spending in a date range
+func (s *ReportService) TopPayees(ctx context.Context, startDate, endDate string, limit int, pocketID *int64) ([]domain.PayeeTotal, error) {
+	filter, err := reportFilter(startDate, endDate, pocketID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case limit == 0:
+		limit = defaultTopPayees
+	case limit < 0:
+		return nil, domain.ErrInvalidInput
+	case limit > maxTopPayees:
+		limit = maxTopPayees
+	}
+
+	payees, err := s.repo.TopPayees(ctx, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	if payees == nil {
+		payees = []domain.PayeeTotal{}
+	}
+	return payees, nil
+}
+
+// Series returns spending per day, week or month with empty buckets filled in
+func (s *ReportService) Series(ctx context.Context, startDate, endDate string, granularity domain.SeriesGranularity, pocketID *int64) (*domain.SeriesReport, error) {
+	filter, err := reportFilter(startDate, endDate, pocketID)
+	if err != nil {
+		return nil, err
+	}
+	if granularity == "" {
+		granularity = domain.GranularityDay
+	}
+
+	buckets, err := seriesBuckets(filter.StartDate, filter.EndDate, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := s.repo.Series(ctx, filter, granularity)
+	if err != nil {
+		return nil, err
+	}
+	byDate := make(map[string]domain.SeriesPoint, len(points))
+	for _, point := range points {
+		byDate[point.Date] = point
+	}
+
+	report := &domain.SeriesReport{Granularity: granularity, Points: []domain.SeriesPoint{}}
+	for _, bucket := range buckets {
+		date := bucket.Format("2006-01-02")
+		point, ok := byDate[date]
+		if !ok {
+			point = domain.SeriesPoint{Date: date}
+		}
+		report.Total += point.Total
+		report.GrossSpent += point.GrossSpent
+		report.TotalRefunds += point.TotalRefunds
+		report.Points = append(report.Points, point)
+	}
+	return report, nil
+}
+
+// seriesBuckets returns the first day of every bucket overlapping start..end.
+// Weeks start on Monday, so the first bucket may begin before start.
+func seriesBuckets(start, end time.Time, granularity domain.SeriesGranularity) ([]time.Time, error) {
+	bucket := start
+	var next func(time.Time) time.Time
+	switch granularity {
+	case domain.GranularityDay:
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case domain.GranularityWeek:
+		bucket = bucket.AddDate(0, 0, -(int(bucket.Weekday())+6)%7)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case domain.GranularityMonth:
+		bucket = time.Date(bucket.Year(), bucket.Month(), 1, 0, 0, 0, 0, time.UTC)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return nil, domain.ErrInvalidInput
+	}
+
+	var buckets []time.Time
+	for ; !bucket.After(end); bucket = next(bucket) {
+		if len(buckets) == maxSeriesPoints {
+			return nil, domain.ErrInvalidInput
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
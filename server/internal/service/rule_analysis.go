@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// maxAlternatives caps how many alternatives a rule expands to when looking
+// for shadowed rules; rules with more are not checked
+const maxAlternatives = 64
+
+// Analysis checks the rules for ones that cannot work as intended: rules
+// shadowed by earlier ones in evaluation order, description tests shared by
+// rules of different categories, rules charging budgets of past periods and
+// rules that never categorized anything.
+//
+// A rule is shadowed when each way it can match is implied by a way an earlier
+// rule matches, e.g. "contains GRAB" before "contains GRABFOOD", "amount from
+// 0" before "amount from 100,000", or any rule before its exact copy. The
+// check compares conditions, not transactions, so shadowing through regular
+// expressions is only found between identical ones.
+func (s *BudgetRuleService) Analysis(ctx context.Context) (*domain.RuleAnalysis, error) {
+	page, err := s.ruleRepo.List(ctx, domain.BudgetRuleFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	period := time.Now().Format("2006-01")
+	analysis := &domain.RuleAnalysis{
+		Period:       period,
+		Shadowed:     []domain.ShadowedRule{},
+		Overlaps:     []domain.KeywordOverlap{},
+		PastPeriod:   []domain.PastPeriodRule{},
+		NeverMatched: []domain.RuleUsage{},
+		Rules:        []domain.RuleUsage{},
+	}
+
+	budgets := make(map[int64]*domain.Budget)
+	var earlier []domain.RuleRef
+	var earlierAlternatives [][][]domain.RuleCondition
+	overlaps := make(map[string]*domain.KeywordOverlap)
+	var overlapKeys []string
+
+	for _, rule := range page.Items {
+		budget, ok := budgets[rule.BudgetID]
+		if !ok {
+			if budget, err = s.budgetRepo.GetByID(ctx, rule.BudgetID); err != nil {
+				return nil, err
+			}
+			budgets[rule.BudgetID] = budget
+		}
+		ref := domain.RuleRef{RuleID: rule.ID, BudgetID: rule.BudgetID, BudgetName: rule.BudgetName, Priority: rule.Priority}
+		usage := domain.RuleUsage{
+			RuleRef:       ref,
+			Period:        budget.Period,
+			Keywords:      rule.Keywords,
+			IsActive:      rule.IsActive,
+			HitCount:      rule.HitCount,
+			LastMatchedAt: rule.LastMatchedAt,
+			CreatedAt:     rule.CreatedAt,
+		}
+		analysis.Rules = append(analysis.Rules, usage)
+		if !rule.IsActive {
+			continue
+		}
+
+		if rule.HitCount == 0 {
+			analysis.NeverMatched = append(analysis.NeverMatched, usage)
+		}
+
+		if budget.Period < period {
+			stale := domain.PastPeriodRule{RuleUsage: usage}
+			current, err := s.budgetRepo.GetLatestByName(ctx, budget.Name, period)
+			switch {
+			case errors.Is(err, domain.ErrNotFound):
+			case err != nil:
+				return nil, err
+			case current.Period == period:
+				stale.CurrentBudgetID = &current.ID
+			}
+			analysis.PastPeriod = append(analysis.PastPeriod, stale)
+		}
+
+		alternatives, ok := ruleAlternatives(rule.Operator, rule.Conditions)
+		if ok {
+			if shadowed, found := shadowingRules(alternatives, earlier, earlierAlternatives); found {
+				redundant := true
+				for _, by := range shadowed {
+					redundant = redundant && strings.EqualFold(by.BudgetName, rule.BudgetName)
+				}
+				analysis.Shadowed = append(analysis.Shadowed, domain.ShadowedRule{
+					RuleUsage:  usage,
+					ShadowedBy: shadowed,
+					Redundant:  redundant,
+				})
+			}
+		}
+		earlier = append(earlier, ref)
+		earlierAlternatives = append(earlierAlternatives, alternatives)
+
+		for _, c := range textConditions(rule.Conditions) {
+			key := string(c.Type) + ":" + strings.ToLower(c.Value)
+			overlap := overlaps[key]
+			if overlap == nil {
+				overlap = &domain.KeywordOverlap{Type: c.Type, Value: c.Value}
+				overlaps[key] = overlap
+				overlapKeys = append(overlapKeys, key)
+			}
+			if n := len(overlap.Rules); n == 0 || overlap.Rules[n-1].RuleID != rule.ID {
+				overlap.Rules = append(overlap.Rules, ref)
+			}
+		}
+	}
+
+	for _, key := range overlapKeys {
+		overlap := overlaps[key]
+		for _, ref := range overlap.Rules[1:] {
+			if !strings.EqualFold(ref.BudgetName, overlap.Rules[0].BudgetName) {
+				analysis.Overlaps = append(analysis.Overlaps, *overlap)
+				break
+			}
+		}
+	}
+	return analysis, nil
+}
+
+// shadowingRules returns the earlier rules that together match whatever the
+// alternatives do, reporting false when some alternative is left uncovered
+func shadowingRules(alternatives [][]domain.RuleCondition, earlier []domain.RuleRef, earlierAlternatives [][][]domain.RuleCondition) ([]domain.RuleRef, bool) {
+	var by []domain.RuleRef
+	for _, alternative := range alternatives {
+		found := false
+		for i, others := range earlierAlternatives {
+			if slices.ContainsFunc(others, func(other []domain.RuleCondition) bool { return covers(other, alternative) }) {
+				if !slices.Contains(by, earlier[i]) {
+					by = append(by, earlier[i])
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return by, len(by) > 0
+}
+
+// ruleAlternatives expands conditions combined by operator into alternatives,
+// each a conjunction of leaf conditions, so that the conditions hold exactly
+// when one of the alternatives does. It reports false past maxAlternatives.
+func ruleAlternatives(operator domain.RuleOperator, conditions []domain.RuleCondition) ([][]domain.RuleCondition, bool) {
+	if operator == domain.RuleOr {
+		var alternatives [][]domain.RuleCondition
+		for _, c := range conditions {
+			nested, ok := conditionAlternatives(c)
+			if !ok || len(alternatives)+len(nested) > maxAlternatives {
+				return nil, false
+			}
+			alternatives = append(alternatives, nested...)
+		}
+		return alternatives, true
+	}
+
+	alternatives := [][]domain.RuleCondition{{}}
+	for _, c := range conditions {
+		nested, ok := conditionAlternatives(c)
+		if !ok || len(alternatives)*len(nested) > maxAlternatives {
+			return nil, false
+		}
+		var product [][]domain.RuleCondition
+		for _, alternative := range alternatives {
+			for _, n := range nested {
+				product = append(product, append(slices.Clip(alternative), n...))
+			}
+		}
+		alternatives = product
+	}
+	return alternatives, true
+}
+
+func conditionAlternatives(c domain.RuleCondition) ([][]domain.RuleCondition, bool) {
+	switch c.Type {
+	case domain.ConditionAnd:
+		return ruleAlternatives(domain.RuleAnd, c.Conditions)
+	case domain.ConditionOr:
+		return ruleAlternatives(domain.RuleOr, c.Conditions)
+	}
+	return [][]domain.RuleCondition{{c}}, true
+}
+
+// covers reports whether a transaction meeting every condition of alternative
+// necessarily meets every condition of other
+func covers(other, alternative []domain.RuleCondition) bool {
+	for _, a := range other {
+		if !slices.ContainsFunc(alternative, func(b domain.RuleCondition) bool { return implies(b, a) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// implies reports whether condition a holds whenever condition b does
+func implies(b, a domain.RuleCondition) bool {
+	bValue, aValue := strings.ToLower(b.Value), strings.ToLower(a.Value)
+	switch a.Type {
+	case domain.ConditionContains:
+		switch b.Type {
+		case domain.ConditionContains, domain.ConditionEquals, domain.ConditionStartsWith:
+			return strings.Contains(bValue, aValue)
+		}
+	case domain.ConditionStartsWith:
+		switch b.Type {
+		case domain.ConditionEquals, domain.ConditionStartsWith:
+			return strings.HasPrefix(bValue, aValue)
+		}
+	case domain.ConditionEquals:
+		return b.Type == domain.ConditionEquals && bValue == aValue
+	case domain.ConditionRegex:
+		return b.Type == domain.ConditionRegex && b.Value == a.Value
+	case domain.ConditionAmount:
+		return b.Type == domain.ConditionAmount &&
+			(a.Min == nil || b.Min != nil && *b.Min >= *a.Min) &&
+			(a.Max == nil || b.Max != nil && *b.Max <= *a.Max)
+	case domain.ConditionPocket:
+		return b.Type == domain.ConditionPocket && b.PocketID != nil && a.PocketID != nil && *b.PocketID == *a.PocketID
+	case domain.ConditionWeekday, domain.ConditionDayOfMonth:
+		if b.Type != a.Type {
+			return false
+		}
+		for _, day := range b.Days {
+			if !containsDay(a.Days, day) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// textConditions lists the description tests of conditions, nested ones
+// included, in order
+func textConditions(conditions []domain.RuleCondition) []domain.RuleCondition {
+	var texts []domain.RuleCondition
+	for _, c := range conditions {
+		switch c.Type {
+		case domain.ConditionContains, domain.ConditionEquals, domain.ConditionStartsWith:
+			texts = append(texts, c)
+		case domain.ConditionAnd, domain.ConditionOr:
+			texts = append(texts, textConditions(c.Conditions)...)
+		}
+	}
+	return texts
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// conditionKeywords lists the text values of conditions, comma-separated, as
+// a summary for listings and search
+func conditionKeywords(conditions []domain.RuleCondition) string {
+	var values []string
+	for _, c := range conditions {
+		switch c.Type {
+		case domain.ConditionContains, domain.ConditionEquals, domain.ConditionStartsWith, domain.ConditionRegex:
+			values = append(values, c.Value)
+		case domain.ConditionAnd, domain.ConditionOr:
+			if nested := conditionKeywords(c.Conditions); nested != "" {
+				values = append(values, nested)
+			}
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func checkOperator(operator domain.RuleOperator) error {
+	if operator != domain.RuleAnd && operator != domain.RuleOr {
+		return domain.ErrInvalidInput
+	}
+	return nil
+}
+
+// checkConditions validates conditions and trims their text values
+func (s *BudgetRuleService) checkConditions(ctx context.Context, conditions []domain.RuleCondition) error {
+	if len(conditions) == 0 {
+		return domain.ErrInvalidInput
+	}
+
+	for i := range conditions {
+		c := &conditions[i]
+		switch c.Type {
+		case domain.ConditionContains, domain.ConditionEquals, domain.ConditionStartsWith:
+			if c.Value = strings.TrimSpace(c.Value); c.Value == "" {
+				return domain.ErrInvalidInput
+			}
+		case domain.ConditionRegex:
+			if c.Value == "" {
+				return domain.ErrInvalidInput
+			}
+			if _, err := s.pattern(c.Value); err != nil {
+				return domain.ErrInvalidInput
+			}
+		case domain.ConditionAmount:
+			switch {
+			case c.Min == nil && c.Max == nil,
+				c.Min != nil && *c.Min < 0,
+				c.Max != nil && *c.Max <= 0,
+				c.Min != nil && c.Max != nil && *c.Min >= *c.Max:
+				return domain.ErrInvalidInput
+			}
+		case domain.ConditionPocket:
+			if c.PocketID == nil {
+				return domain.ErrInvalidInput
+			}
+			if _, err := s.pocketRepo.GetByID(ctx, *c.PocketID); err != nil {
+				return err
+			}
+		case domain.ConditionWeekday, domain.ConditionDayOfMonth:
+			low, high := 0, 6
+			if c.Type == domain.ConditionDayOfMonth {
+				low, high = 1, 31
+			}
+			if len(c.Days) == 0 {
+				return domain.ErrInvalidInput
+			}
+			for _, day := range c.Days {
+				if day < low || day > high {
+					return domain.ErrInvalidInput
+				}
+			}
+		case domain.ConditionAnd, domain.ConditionOr:
+			if err := s.checkConditions(ctx, c.Conditions); err != nil {
+				return err
+			}
+		default:
+			return domain.ErrInvalidInput
+		}
+	}
+	return nil
+}
+
+// pattern compiles a regex condition, case-insensitively, caching the result
+func (s *BudgetRuleService) pattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := s.patterns.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, err
+	}
+	s.patterns.Store(expr, re)
+	return re, nil
+}
+
+// matchConditions tests conditions combined by operator against a
+// transaction. When they hold it also returns the leaf conditions that did.
+func (s *BudgetRuleService) matchConditions(operator domain.RuleOperator, conditions []domain.RuleCondition, tx domain.RuleTransaction) ([]domain.RuleCondition, bool) {
+	var matched []domain.RuleCondition
+	held := 0
+	for _, c := range conditions {
+		leaves, ok := s.matchCondition(c, tx)
+		if !ok {
+			if operator == domain.RuleAnd {
+				return nil, false
+			}
+			continue
+		}
+		held++
+		matched = append(matched, leaves...)
+	}
+	return matched, held > 0
+}
+
+func (s *BudgetRuleService) matchCondition(c domain.RuleCondition, tx domain.RuleTransaction) ([]domain.RuleCondition, bool) {
+	description := strings.ToLower(strings.TrimSpace(tx.Description))
+	value := strings.ToLower(c.Value)
+
+	var ok bool
+	switch c.Type {
+	case domain.ConditionContains:
+		ok = strings.Contains(description, value)
+	case domain.ConditionEquals:
+		ok = description == value
+	case domain.ConditionStartsWith:
+		ok = strings.HasPrefix(description, value)
+	case domain.ConditionRegex:
+		re, err := s.pattern(c.Value)
+		ok = err == nil && re.MatchString(tx.Description)
+	case domain.ConditionAmount:
+		ok = tx.Amount != nil && (c.Min == nil || *tx.Amount >= *c.Min) && (c.Max == nil || *tx.Amount < *c.Max)
+	case domain.ConditionPocket:
+		ok = tx.PocketID != nil && c.PocketID != nil && *tx.PocketID == *c.PocketID
+	case domain.ConditionWeekday:
+		ok = tx.Date != nil && containsDay(c.Days, int(tx.Date.Weekday()))
+	case domain.ConditionDayOfMonth:
+		ok = tx.Date != nil && containsDay(c.Days, tx.Date.Day())
+	case domain.ConditionAnd:
+		return s.matchConditions(domain.RuleAnd, c.Conditions, tx)
+	case domain.ConditionOr:
+		return s.matchConditions(domain.RuleOr, c.Conditions, tx)
+	}
+	if !ok {
+		return nil, false
+	}
+	return []domain.RuleCondition{c}, true
+}
+
+func containsDay(days []int, day int) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
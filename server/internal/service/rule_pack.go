@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/pkg/yaml"
+)
+
+// rulePackFiles are the presets shipped with the server, one YAML pack per
+// file, named after the file
+//
+//go:embed rulepacks/*.yaml
+var rulePackFiles embed.FS
+
+// rulePresets reads the shipped presets once, in file name order
+var rulePresets = sync.OnceValues(func() ([]domain.RulePack, error) {
+	entries, err := rulePackFiles.ReadDir("rulepacks")
+	if err != nil {
+		return nil, err
+	}
+	var packs []domain.RulePack
+	for _, entry := range entries {
+		data, err := rulePackFiles.ReadFile(path.Join("rulepacks", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var pack domain.RulePack
+		if err := yaml.Unmarshal(data, &pack); err != nil {
+			return nil, fmt.Errorf("rule pack %s: %w", entry.Name(), err)
+		}
+		pack.Name = strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		packs = append(packs, pack)
+	}
+	return packs, nil
+})
+
+// Export returns the rules matching the filter as a pack, in evaluation order
+// unless the filter sorts otherwise. Rules of budgets sharing a name, as the
+// same category in several periods, become one rule of the pack.
+func (s *BudgetRuleService) Export(ctx context.Context, filter domain.BudgetRuleFilter) (*domain.RulePack, error) {
+	filter.Limit, filter.Cursor = 0, ""
+	page, err := s.ruleRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	pockets, err := s.pocketRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pocketNames := make(map[int64]string, len(pockets))
+	for _, pocket := range pockets {
+		pocketNames[pocket.ID] = pocket.Name
+	}
+
+	pack := &domain.RulePack{Version: domain.RulePackVersion, Rules: []domain.PackRule{}}
+	seen := make(map[string]bool)
+	for _, rule := range page.Items {
+		packRule := domain.PackRule{
+			Category:   rule.BudgetName,
+			Operator:   rule.Operator,
+			Conditions: exportConditions(rule.Conditions, pocketNames),
+			Priority:   rule.Priority,
+		}
+		if !rule.IsActive {
+			packRule.IsActive = &rule.IsActive
+		}
+		key, err := json.Marshal(packRule)
+		if err != nil {
+			return nil, err
+		}
+		if k := strings.ToLower(string(key)); !seen[k] {
+			seen[k] = true
+			pack.Rules = append(pack.Rules, packRule)
+		}
+	}
+	return pack, nil
+}
+
+// exportConditions copies conditions with the pocket conditions naming their
+// pocket. A pocket that no longer exists keeps its ID.
+func exportConditions(conditions []domain.RuleCondition, pocketNames map[int64]string) []domain.RuleCondition {
+	exported := slices.Clone(conditions)
+	for i := range exported {
+		c := &exported[i]
+		if c.Type == domain.ConditionPocket && c.PocketID != nil {
+			if name, ok := pocketNames[*c.PocketID]; ok {
+				c.Pocket, c.PocketID = name, nil
+			}
+		}
+		if len(c.Conditions) > 0 {
+			c.Conditions = exportConditions(c.Conditions, pocketNames)
+		}
+	}
+	return exported
+}
+
+// Import creates the rules of a pack, each charged to the latest budget
+// named after its category. Merging keeps the existing rules and skips the
+// pack's rules that duplicate one; replacing deletes every existing rule
+// first. Rules that cannot be imported are skipped and reported as
+// conflicts, as are keywords that already route to another category. It all
+// happens in one transaction; a dry run reports the same without writing.
+func (s *BudgetRuleService) Import(ctx context.Context, pack domain.RulePack, req domain.ImportRulePackRequest) (*domain.RulePackImport, error) {
+	switch req.Mode {
+	case "":
+		req.Mode = domain.PackMerge
+	case domain.PackMerge, domain.PackReplace:
+	default:
+		return nil, domain.ErrInvalidInput
+	}
+	if pack.Version < 0 || pack.Version > domain.RulePackVersion {
+		return nil, domain.ErrInvalidInput
+	}
+	categories := make(map[string]string, len(req.Categories))
+	for category, name := range req.Categories {
+		categories[strings.ToLower(category)] = name
+	}
+
+	result := &domain.RulePackImport{
+		Mode:      req.Mode,
+		DryRun:    req.DryRun,
+		Rules:     []domain.BudgetRule{},
+		Conflicts: []domain.PackConflict{},
+	}
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		page, err := s.ruleRepo.List(ctx, domain.BudgetRuleFilter{})
+		if err != nil {
+			return err
+		}
+		existing := page.Items
+		if req.Mode == domain.PackReplace {
+			result.Deleted = len(existing)
+			existing = nil
+			if !req.DryRun {
+				if err := s.ruleRepo.DeleteAll(ctx); err != nil {
+					return err
+				}
+			}
+		}
+
+		pockets, err := s.pocketRepo.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+		pocketIDs := make(map[string]int64, len(pockets))
+		for _, pocket := range pockets {
+			pocketIDs[strings.ToLower(pocket.Name)] = pocket.ID
+		}
+
+		for i, packRule := range pack.Rules {
+			conflict := func(kind domain.PackConflictKind, ruleID *int64, format string, args ...any) {
+				result.Conflicts = append(result.Conflicts, domain.PackConflict{
+					Index:    i,
+					Category: packRule.Category,
+					Kind:     kind,
+					Message:  fmt.Sprintf(format, args...),
+					RuleID:   ruleID,
+				})
+			}
+
+			name := strings.TrimSpace(packRule.Category)
+			if mapped, ok := categories[strings.ToLower(name)]; ok {
+				name = mapped
+			}
+			budget, err := s.latestBudget(ctx, name)
+			if errors.Is(err, domain.ErrNotFound) {
+				conflict(domain.ConflictMissingCategory, nil, "no budget is named %q", name)
+				result.Skipped++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			rule, err := s.packRule(ctx, packRule, budget.ID, pocketIDs)
+			var missing missingPocketError
+			switch {
+			case errors.As(err, &missing):
+				conflict(domain.ConflictMissingPocket, nil, "%v", missing)
+			case errors.Is(err, domain.ErrInvalidInput), errors.Is(err, domain.ErrNotFound):
+				conflict(domain.ConflictInvalid, nil, "the rule's operator or conditions are not valid")
+			case err != nil:
+				return err
+			}
+			if err != nil {
+				result.Skipped++
+				continue
+			}
+
+			if same := duplicateRule(existing, rule, budget.Name); same != nil {
+				id, label := ruleRef(same)
+				conflict(domain.ConflictDuplicate, id, "%s already routes the same conditions to %s", label, same.BudgetName)
+				result.Skipped++
+				continue
+			}
+			if other, keywords := overlappingRule(existing, rule, budget.Name); other != nil {
+				id, label := ruleRef(other)
+				conflict(domain.ConflictKeywordOverlap, id, "%s already routes %s to %s",
+					label, strings.Join(keywords, ", "), other.BudgetName)
+			}
+
+			if !req.DryRun {
+				if err := s.ruleRepo.Create(ctx, rule); err != nil {
+					return err
+				}
+			}
+			result.Created++
+			result.Rules = append(result.Rules, *rule)
+			existing = append(existing, domain.BudgetRuleWithBudget{BudgetRule: *rule, BudgetName: budget.Name})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// latestBudget returns the budget a category name stands for: the latest of
+// that name up to this month, or failing that the latest one planned ahead
+func (s *BudgetRuleService) latestBudget(ctx context.Context, name string) (*domain.Budget, error) {
+	budget, err := s.budgetRepo.GetLatestByName(ctx, name, time.Now().Format("2006-01"))
+	if errors.Is(err, domain.ErrNotFound) {
+		return s.budgetRepo.GetLatestByName(ctx, name, "9999-12")
+	}
+	return budget, err
+}
+
+// missingPocketError names a pocket a pack rule refers to that does not exist
+type missingPocketError string
+
+func (e missingPocketError) Error() string {
+	return fmt.Sprintf("no pocket is named %q", string(e))
+}
+
+// packRule builds the budget rule of a pack rule, validated like a new rule
+func (s *BudgetRuleService) packRule(ctx context.Context, packRule domain.PackRule, budgetID int64, pocketIDs map[string]int64) (*domain.BudgetRule, error) {
+	rule := &domain.BudgetRule{
+		BudgetID: budgetID,
+		Operator: packRule.Operator,
+		Priority: packRule.Priority,
+		IsActive: packRule.IsActive == nil || *packRule.IsActive,
+	}
+	switch {
+	case packRule.Keywords != "" && len(packRule.Conditions) > 0:
+		return nil, domain.ErrInvalidInput
+	case packRule.Keywords != "":
+		rule.Operator, rule.Conditions = domain.RuleOr, domain.KeywordConditions(packRule.Keywords)
+	default:
+		rule.Conditions = slices.Clone(packRule.Conditions)
+		if rule.Operator == "" {
+			rule.Operator = domain.RuleAnd
+		}
+	}
+	if err := importConditions(rule.Conditions, pocketIDs); err != nil {
+		return nil, err
+	}
+	if err := s.setConditions(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// importConditions points the pocket conditions that name their pocket at
+// the pocket of that name here
+func importConditions(conditions []domain.RuleCondition, pocketIDs map[string]int64) error {
+	for i := range conditions {
+		c := &conditions[i]
+		if c.Pocket != "" {
+			id, ok := pocketIDs[strings.ToLower(strings.TrimSpace(c.Pocket))]
+			if !ok {
+				return missingPocketError(c.Pocket)
+			}
+			c.Pocket, c.PocketID = "", &id
+		}
+		if len(c.Conditions) > 0 {
+			c.Conditions = slices.Clone(c.Conditions)
+			if err := importConditions(c.Conditions, pocketIDs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ruleRef names a rule in conflict messages. Rules of the pack itself have
+// no ID on a dry run.
+func ruleRef(rule *domain.BudgetRuleWithBudget) (*int64, string) {
+	if rule.ID == 0 {
+		return nil, "an earlier rule of the pack"
+	}
+	return &rule.ID, fmt.Sprintf("rule %d", rule.ID)
+}
+
+// duplicateRule returns the rule that routes the same conditions to a budget
+// of the same name, whatever its priority
+func duplicateRule(rules []domain.BudgetRuleWithBudget, rule *domain.BudgetRule, budgetName string) *domain.BudgetRuleWithBudget {
+	key := conditionsKey(rule.Operator, rule.Conditions)
+	for i := range rules {
+		r := &rules[i]
+		if strings.EqualFold(r.BudgetName, budgetName) && conditionsKey(r.Operator, r.Conditions) == key {
+			return r
+		}
+	}
+	return nil
+}
+
+// conditionsKey compares conditions the way they match, ignoring case
+func conditionsKey(operator domain.RuleOperator, conditions []domain.RuleCondition) string {
+	data, _ := json.Marshal(conditions)
+	return string(operator) + strings.ToLower(string(data))
+}
+
+// overlappingRule returns the first active rule routing one of the rule's
+// text values to a budget of another name, with the values they share
+func overlappingRule(rules []domain.BudgetRuleWithBudget, rule *domain.BudgetRule, budgetName string) (*domain.BudgetRuleWithBudget, []string) {
+	values := textValues(rule.Conditions)
+	for i := range rules {
+		r := &rules[i]
+		if !r.IsActive || strings.EqualFold(r.BudgetName, budgetName) {
+			continue
+		}
+		var shared []string
+		for key, value := range textValues(r.Conditions) {
+			if _, ok := values[key]; ok {
+				shared = append(shared, value)
+			}
+		}
+		if len(shared) > 0 {
+			slices.Sort(shared)
+			return r, shared
+		}
+	}
+	return nil, nil
+}
+
+// textValues collects the description tests of conditions by type and
+// lowercased value
+func textValues(conditions []domain.RuleCondition) map[string]string {
+	values := make(map[string]string)
+	for _, c := range textConditions(conditions) {
+		values[string(c.Type)+":"+strings.ToLower(c.Value)] = c.Value
+	}
+	return values
+}
+
+// Presets lists the rule packs shipped with the server
+func (s *BudgetRuleService) Presets() ([]domain.RulePackPreset, error) {
+	packs, err := rulePresets()
+	if err != nil {
+		return nil, err
+	}
+	presets := make([]domain.RulePackPreset, 0, len(packs))
+	for _, pack := range packs {
+		preset := domain.RulePackPreset{
+			Name:        pack.Name,
+			Description: pack.Description,
+			Categories:  []string{},
+			Rules:       len(pack.Rules),
+		}
+		for _, rule := range pack.Rules {
+			if !slices.Contains(preset.Categories, rule.Category) {
+				preset.Categories = append(preset.Categories, rule.Category)
+			}
+		}
+		presets = append(presets, preset)
+	}
+	return presets, nil
+}
+
+// Preset returns a shipped rule pack by name
+func (s *BudgetRuleService) Preset(name string) (*domain.RulePack, error) {
+	packs, err := rulePresets()
+	if err != nil {
+		return nil, err
+	}
+	for _, pack := range packs {
+		if pack.Name == name {
+			return &pack, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+// InstallPreset imports a shipped rule pack, see Import
+func (s *BudgetRuleService) InstallPreset(ctx context.Context, name string, req domain.ImportRulePackRequest) (*domain.RulePackImport, error) {
+	pack, err := s.Preset(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.Import(ctx, *pack, req)
+}
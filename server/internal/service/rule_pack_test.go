@@ -0,0 +1,103 @@
+package service
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/pkg/yaml"
+)
+
+// Every shipped preset reads without losing a key and survives export as YAML
+func TestRulePresetsRoundTrip(t *testing.T) {
+	packs, err := rulePresets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := rulePackFiles.ReadDir("rulepacks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packs) == 0 || len(packs) != len(entries) {
+		t.Fatalf("read %d presets from %d files", len(packs), len(entries))
+	}
+
+	for i, pack := range packs {
+		file := entries[i].Name()
+		t.Run(file, func(t *testing.T) {
+			if pack.Name != strings.TrimSuffix(file, path.Ext(file)) || pack.Version != domain.RulePackVersion || len(pack.Rules) == 0 {
+				t.Errorf("got name %q, version %d, %d rules", pack.Name, pack.Version, len(pack.Rules))
+			}
+			for j, rule := range pack.Rules {
+				if rule.Category == "" || rule.Keywords == "" && len(rule.Conditions) == 0 {
+					t.Errorf("rule %d has no category or nothing to match: %+v", j+1, rule)
+				}
+			}
+
+			// A misspelled key would be dropped by the struct; compare the
+			// file with the pack written back as JSON
+			data, err := rulePackFiles.ReadFile(path.Join("rulepacks", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var raw, decoded any
+			if err := yaml.Unmarshal(data, &raw); err != nil {
+				t.Fatal(err)
+			}
+			unnamed := pack
+			unnamed.Name = ""
+			doc, err := json.Marshal(unnamed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(doc, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(raw, decoded) {
+				t.Errorf("the pack does not hold everything the file says:\nfile %v\npack %v", raw, decoded)
+			}
+
+			assertYAMLRoundTrip(t, pack)
+		})
+	}
+}
+
+// Conditions of every kind survive export as YAML and import back
+func TestRulePackConditionsRoundTrip(t *testing.T) {
+	low, high := 0.0, 50000.5
+	assertYAMLRoundTrip(t, domain.RulePack{
+		Version:     domain.RulePackVersion,
+		Name:        "mixed",
+		Description: "Quoting: 'single', \"double\", #hash, a: b",
+		Rules: []domain.PackRule{
+			{Category: "Food", Keywords: "gofood, grabfood", Priority: 10},
+			{Category: "Transport", Operator: domain.RuleOr, Priority: 5, Conditions: []domain.RuleCondition{
+				{Type: domain.ConditionRegex, Value: `^(GRAB|GOJEK)\s+\d+$`},
+				{Type: domain.ConditionAnd, Conditions: []domain.RuleCondition{
+					{Type: domain.ConditionAmount, Min: &low, Max: &high},
+					{Type: domain.ConditionPocket, Pocket: "BCA Tahapan"},
+					{Type: domain.ConditionWeekday, Days: []int{1, 5}},
+				}},
+			}},
+			{Category: "true", Keywords: "123"},
+		},
+	})
+}
+
+func assertYAMLRoundTrip(t *testing.T, pack domain.RulePack) {
+	t.Helper()
+	data, err := yaml.Marshal(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got domain.RulePack
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("reading back:\n%s\n%v", data, err)
+	}
+	if !reflect.DeepEqual(got, pack) {
+		t.Errorf("round trip changed the pack:\n got %+v\nwant %+v\n%s", got, pack, data)
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+// Simulate plays changed rules against the expenses in scope and reports the
+// expenses they would move out of the budget they are in, with the net shift
+// of every envelope involved: the moves Apply would make under the changed
+// rules. Each move also says where the current rules put the expense, telling
+// the moves the change causes from those Apply would make anyway. Nothing is
+// written.
+func (s *CategorizationService) Simulate(ctx context.Context, req domain.SimulateRulesRequest) (*domain.RuleSimulation, error) {
+	rules, err := s.rules.proposeRules(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.rules.matcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current.skipClassifier = true
+	proposed := &ruleMatcher{rules: rules, payees: current.payees, skipClassifier: true}
+	page, err := s.scope(ctx, req.StartDate, req.EndDate, req.BudgetID, req.Uncategorized)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.RuleSimulation{
+		Scanned: len(page.Items),
+		Changes: []domain.SimulatedChange{},
+		Shifts:  []domain.BudgetShift{},
+	}
+	budgets := make(map[int64]*domain.Budget)
+	budget := func(id int64) (*domain.Budget, error) {
+		if b, ok := budgets[id]; ok {
+			return b, nil
+		}
+		b, err := s.budgetRepo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		budgets[id] = b
+		return b, nil
+	}
+	shifts := make(map[int64]*domain.BudgetShift)
+	var order []int64
+	shift := func(budgetID int64) (*domain.BudgetShift, error) {
+		if shift, ok := shifts[budgetID]; ok {
+			return shift, nil
+		}
+		b, err := budget(budgetID)
+		if err != nil {
+			return nil, err
+		}
+		shift := &domain.BudgetShift{
+			BudgetID:   b.ID,
+			BudgetName: b.Name,
+			Period:     b.Period,
+		}
+		shifts[budgetID] = shift
+		order = append(order, budgetID)
+		return shift, nil
+	}
+
+	for _, expense := range page.Items {
+		movable, err := s.movable(ctx, expense)
+		if err != nil {
+			return nil, err
+		}
+		if !movable {
+			result.Skipped++
+			continue
+		}
+
+		from, err := budget(expense.BudgetID)
+		if err != nil {
+			return nil, err
+		}
+		tx := domain.RuleTransaction{
+			Description: expense.Description,
+			Amount:      &expense.Amount,
+			PocketID:    &from.PocketID,
+			Date:        &expense.Date,
+		}
+		to, toRule, err := s.ruleBudget(ctx, proposed, tx, expense)
+		if err != nil {
+			return nil, err
+		}
+		if to == from.ID {
+			continue
+		}
+		currentBudget, currentRule, err := s.ruleBudget(ctx, current, tx, expense)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Changes = append(result.Changes, domain.SimulatedChange{
+			ExpenseID:       expense.ID,
+			Description:     expense.Description,
+			Amount:          expense.Amount,
+			Date:            expense.Date,
+			FromBudgetID:    from.ID,
+			ToBudgetID:      to,
+			ToRuleID:        toRule,
+			CurrentBudgetID: currentBudget,
+			CurrentRuleID:   currentRule,
+		})
+		out, err := shift(from.ID)
+		if err != nil {
+			return nil, err
+		}
+		in, err := shift(to)
+		if err != nil {
+			return nil, err
+		}
+		out.Out += expense.Amount
+		out.Net -= expense.Amount
+		in.In += expense.Amount
+		in.Net += expense.Amount
+	}
+
+	result.Changed = len(result.Changes)
+	for _, id := range order {
+		result.Shifts = append(result.Shifts, *shifts[id])
+	}
+	return result, nil
+}
+
+// ruleBudget returns the budget the rules put an expense in, with the rule
+// that picked it: the match for the expense's month, or else the expense's own
+// budget
+func (s *CategorizationService) ruleBudget(ctx context.Context, matcher *ruleMatcher, tx domain.RuleTransaction, expense *domain.Expense) (int64, *int64, error) {
+	match, err := s.rules.matchBudget(ctx, matcher, tx, expense.Date.Format("2006-01"), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if match == nil {
+		return expense.BudgetID, nil, nil
+	}
+	return match.BudgetID, match.RuleID, nil
+}
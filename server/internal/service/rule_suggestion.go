@@ -0,0 +1,232 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/suprie/budget-manager/internal/domain"
+)
+
+const (
+	defaultSuggestionSupport    = 3
+	defaultSuggestionConfidence = 0.8
+	suggestionExamples          = 3
+)
+
+// keywordCategory tallies the expenses with a keyword charged to budgets of one name
+type keywordCategory struct {
+	name     string
+	budgetID int64 // Budget of the latest expense
+	ids      []int64
+	covered  int // Already routed to this category by a rule or payee
+	examples []string
+}
+
+// keywordStats tallies the expenses with a keyword by category
+type keywordStats struct {
+	total      int
+	categories map[string]*keywordCategory
+}
+
+// top returns the category most expenses with the keyword sit in
+func (ks *keywordStats) top() *keywordCategory {
+	var top *keywordCategory
+	for _, category := range ks.categories {
+		if top == nil || len(category.ids) > len(top.ids) ||
+			len(category.ids) == len(top.ids) && category.name < top.name {
+			top = category
+		}
+	}
+	return top
+}
+
+// Suggestions mines the expense history for description keywords whose
+// expenses consistently sit in budgets of one name, and proposes a rule for
+// each. Expenses the rules or payee defaults already put there do not call for
+// a rule, so a keyword is only suggested while some of its expenses were
+// categorized by hand. Keywords found on exactly the same expenses, such as the
+// words of one merchant's name, are suggested once, by the first of them.
+func (s *CategorizationService) Suggestions(ctx context.Context, filter domain.RuleSuggestionFilter) ([]domain.RuleSuggestion, error) {
+	if filter.MinSupport <= 0 {
+		filter.MinSupport = defaultSuggestionSupport
+	}
+	if filter.MinConfidence <= 0 {
+		filter.MinConfidence = defaultSuggestionConfidence
+	}
+	if filter.MinConfidence > 1 {
+		return nil, domain.ErrInvalidInput
+	}
+	switch {
+	case filter.Limit <= 0:
+		filter.Limit = defaultPageSize
+	case filter.Limit > maxPageSize:
+		filter.Limit = maxPageSize
+	}
+
+	stats, keywords, err := s.keywordStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	suggestions := []domain.RuleSuggestion{}
+	for _, keyword := range keywords {
+		ks := stats[keyword]
+		top := ks.top()
+		support := len(top.ids)
+		confidence := float64(support) / float64(ks.total)
+		if support < filter.MinSupport || confidence < filter.MinConfidence || top.covered == support {
+			continue
+		}
+		key := fmt.Sprint(strings.ToLower(top.name), top.ids)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		suggestions = append(suggestions, domain.RuleSuggestion{
+			Keyword:     keyword,
+			BudgetID:    top.budgetID,
+			BudgetName:  top.name,
+			Support:     support,
+			Occurrences: ks.total,
+			Confidence:  round2(confidence),
+			Examples:    top.examples,
+		})
+	}
+
+	slices.SortStableFunc(suggestions, func(a, b domain.RuleSuggestion) int {
+		return cmp.Or(
+			cmp.Compare(b.Support, a.Support),
+			cmp.Compare(b.Confidence, a.Confidence),
+			cmp.Compare(a.Keyword, b.Keyword),
+		)
+	})
+	if len(suggestions) > filter.Limit {
+		suggestions = suggestions[:filter.Limit]
+	}
+	return suggestions, nil
+}
+
+// AcceptSuggestion creates the rule for a suggested keyword, charging it to the
+// suggested budget unless the request names another
+func (s *CategorizationService) AcceptSuggestion(ctx context.Context, req domain.AcceptRuleSuggestionRequest) (*domain.BudgetRule, error) {
+	keyword := strings.TrimSpace(req.Keyword)
+	if keyword == "" {
+		return nil, domain.ErrInvalidInput
+	}
+
+	if req.BudgetID == nil {
+		stats, _, err := s.keywordStats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ks := stats[strings.ToUpper(keyword)]
+		if ks == nil {
+			return nil, domain.ErrNotFound
+		}
+		req.BudgetID = &ks.top().budgetID
+	}
+
+	return s.rules.Create(ctx, domain.CreateBudgetRuleRequest{
+		BudgetID:   *req.BudgetID,
+		Conditions: []domain.RuleCondition{{Type: domain.ConditionContains, Value: keyword}},
+		Priority:   req.Priority,
+	})
+}
+
+// keywordStats tallies every keyword of the single-budget expenses by the name
+// of their budget, newest expense first, and returns the keywords in the order
+// they were first seen
+func (s *CategorizationService) keywordStats(ctx context.Context) (map[string]*keywordStats, []string, error) {
+	matcher, err := s.rules.matcher(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, err := s.expenseRepo.List(ctx, domain.ExpenseFilter{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	budgets := make(map[int64]*domain.Budget)
+	stats := make(map[string]*keywordStats)
+	var keywords []string
+	for _, expense := range page.Items {
+		if expense.IsRefund() || expense.IsSplit() {
+			continue
+		}
+		words := suggestionWords(expense.Description)
+		if len(words) == 0 {
+			continue
+		}
+
+		budget, ok := budgets[expense.BudgetID]
+		if !ok {
+			if budget, err = s.budgetRepo.GetByID(ctx, expense.BudgetID); err != nil {
+				return nil, nil, err
+			}
+			budgets[expense.BudgetID] = budget
+		}
+		routed := s.rules.routedCategory(matcher, domain.RuleTransaction{
+			Description: expense.Description,
+			Amount:      &expense.Amount,
+			PocketID:    &budget.PocketID,
+			Date:        &expense.Date,
+		})
+
+		name := strings.ToLower(budget.Name)
+		for _, word := range words {
+			ks := stats[word]
+			if ks == nil {
+				ks = &keywordStats{categories: make(map[string]*keywordCategory)}
+				stats[word] = ks
+				keywords = append(keywords, word)
+			}
+			ks.total++
+			category := ks.categories[name]
+			if category == nil {
+				category = &keywordCategory{name: budget.Name, budgetID: budget.ID}
+				ks.categories[name] = category
+			}
+			category.ids = append(category.ids, expense.ID)
+			if strings.EqualFold(routed, budget.Name) {
+				category.covered++
+			}
+			if len(category.examples) < suggestionExamples && !slices.Contains(category.examples, expense.Description) {
+				category.examples = append(category.examples, expense.Description)
+			}
+		}
+	}
+	return stats, keywords, nil
+}
+
+// routedCategory names the category the first matching rule, or else the
+// payee's default, puts a transaction in. Unlike explain it skips the classifier
+// and runs no queries, so it can be called for every expense in the history.
+func (s *BudgetRuleService) routedCategory(matcher *ruleMatcher, tx domain.RuleTransaction) string {
+	for _, rule := range matcher.rules {
+		if _, ok := s.matchConditions(rule.Operator, rule.Conditions, tx); ok {
+			return rule.BudgetName
+		}
+	}
+	if payee, _ := matcher.payees.match(normalizeDescription(tx.Description)); payee != nil {
+		return payee.DefaultCategory
+	}
+	return ""
+}
+
+// suggestionWords are the words of a description that could make a rule:
+// those compared for duplicates, from three letters on
+func suggestionWords(description string) []string {
+	var words []string
+	for _, word := range duplicateWords(description) {
+		if utf8.RuneCountInString(word) >= 3 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/suprie/budget-manager/internal/domain"
+	"github.com/suprie/budget-manager/internal/repository"
+)
+
+type TagService struct {
+	repo *repository.TagRepository
+}
+
+func NewTagService(repo *repository.TagRepository) *TagService {
+	return &TagService{repo: repo}
+}
+
+func (s *TagService) Create(ctx context.Context, req domain.CreateTagRequest) (*domain.Tag, error) {
+	name := domain.NormalizeTagName(req.Name)
+	if name == "" {
+		return nil, domain.ErrInvalidInput
+	}
+
+	tag := &domain.Tag{Name: name}
+	if err := s.repo.Create(ctx, tag); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+func (s *TagService) GetByID(ctx context.Context, id int64) (*domain.Tag, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *TagService) GetAll(ctx context.Context) ([]*domain.Tag, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *TagService) Update(ctx context.Context, id int64, req domain.UpdateTagRequest) (*domain.Tag, error) {
+	tag, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := domain.NormalizeTagName(*req.Name)
+		if name == "" {
+			return nil, domain.ErrInvalidInput
+		}
+		tag.Name = name
+	}
+
+	if err := s.repo.Update(ctx, tag); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+func (s *TagService) Delete(ctx context.Context, id int64) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// GetReport totals spending for a tag across envelopes and periods.
+// startDate and endDate are optional and use the "2006-01-02" format.
+func (s *TagService) GetReport(ctx context.Context, name, startDate, endDate string) (*domain.TagReport, error) {
+	tag, err := s.repo.GetByName(ctx, domain.NormalizeTagName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	var start, end *time.Time
+	if startDate != "" {
+		t, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return nil, domain.ErrInvalidInput
+		}
+		start = &t
+	}
+	if endDate != "" {
+		t, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return nil, domain.ErrInvalidInput
+		}
+		end = &t
+	}
+
+	return s.repo.GetReport(ctx, tag, start, end)
+}
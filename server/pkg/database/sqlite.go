@@ -2,7 +2,10 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -27,6 +30,18 @@ func NewSQLiteDB(cfg Config) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if err := migrateKeywordRules(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate budget rules: %w", err)
+	}
+
+	if err := migrateCategorizedBy(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate categorization methods: %w", err)
+	}
+
+	if err := setupSearchIndex(db); err != nil {
+		return nil, fmt.Errorf("failed to set up search index: %w", err)
+	}
+
 	return db, nil
 }
 
@@ -88,6 +103,175 @@ func runMigrations(db *sql.DB) error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_budget_rules_budget_id ON budget_rules(budget_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_budget_rules_priority ON budget_rules(priority DESC)`,
+		`CREATE TABLE IF NOT EXISTS expense_splits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			expense_id INTEGER NOT NULL,
+			budget_id INTEGER NOT NULL,
+			amount REAL NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (expense_id) REFERENCES expenses(id) ON DELETE CASCADE,
+			FOREIGN KEY (budget_id) REFERENCES budgets(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_expense_splits_expense_id ON expense_splits(expense_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_expense_splits_budget_id ON expense_splits(budget_id)`,
+		`CREATE TABLE IF NOT EXISTS tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS expense_tags (
+			expense_id INTEGER NOT NULL,
+			tag_id INTEGER NOT NULL,
+			PRIMARY KEY (expense_id, tag_id),
+			FOREIGN KEY (expense_id) REFERENCES expenses(id) ON DELETE CASCADE,
+			FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_expense_tags_tag_id ON expense_tags(tag_id)`,
+		`CREATE TABLE IF NOT EXISTS custom_fields (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			type TEXT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS expense_custom_values (
+			expense_id INTEGER NOT NULL,
+			field_id INTEGER NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (expense_id, field_id),
+			FOREIGN KEY (expense_id) REFERENCES expenses(id) ON DELETE CASCADE,
+			FOREIGN KEY (field_id) REFERENCES custom_fields(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			expense_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			file_name TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			storage_key TEXT NOT NULL,
+			thumbnail_key TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (expense_id) REFERENCES expenses(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_expense_id ON attachments(expense_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_user_id ON attachments(user_id)`,
+		`CREATE TABLE IF NOT EXISTS payees (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			default_category TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS payee_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			payee_id INTEGER NOT NULL,
+			match_type TEXT NOT NULL,
+			pattern TEXT NOT NULL,
+			priority INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (payee_id) REFERENCES payees(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_payee_rules_payee_id ON payee_rules(payee_id)`,
+		`CREATE TABLE IF NOT EXISTS pocket_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			pocket_id INTEGER NOT NULL,
+			date TEXT NOT NULL,
+			balance REAL NOT NULL,
+			allocated REAL NOT NULL,
+			reason TEXT NOT NULL,
+			recorded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (pocket_id) REFERENCES pockets(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_pocket_snapshots_pocket_date ON pocket_snapshots(pocket_id, date)`,
+		`CREATE TABLE IF NOT EXISTS imports (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			bank TEXT NOT NULL,
+			file_name TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS import_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			import_id INTEGER NOT NULL,
+			line INTEGER NOT NULL,
+			date TEXT NOT NULL,
+			description TEXT NOT NULL,
+			amount REAL NOT NULL,
+			direction TEXT NOT NULL,
+			reference TEXT NOT NULL DEFAULT '',
+			fingerprint TEXT NOT NULL,
+			status TEXT NOT NULL,
+			budget_id INTEGER,
+			expense_id INTEGER,
+			message TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (import_id) REFERENCES imports(id),
+			FOREIGN KEY (budget_id) REFERENCES budgets(id),
+			FOREIGN KEY (expense_id) REFERENCES expenses(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_import_items_import_id ON import_items(import_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_import_items_fingerprint ON import_items(fingerprint)`,
+		`CREATE INDEX IF NOT EXISTS idx_import_items_expense_id ON import_items(expense_id)`,
+		`CREATE TABLE IF NOT EXISTS import_accounts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			bank TEXT NOT NULL,
+			account TEXT NOT NULL,
+			pocket_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (pocket_id) REFERENCES pockets(id),
+			UNIQUE(bank, account)
+		)`,
+		`CREATE TABLE IF NOT EXISTS import_item_splits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			item_id INTEGER NOT NULL,
+			budget_id INTEGER NOT NULL,
+			amount REAL NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (item_id) REFERENCES import_items(id),
+			FOREIGN KEY (budget_id) REFERENCES budgets(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_import_item_splits_item_id ON import_item_splits(item_id)`,
+		`CREATE TABLE IF NOT EXISTS duplicate_dismissals (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			expense_id INTEGER NOT NULL,
+			other_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (expense_id) REFERENCES expenses(id),
+			FOREIGN KEY (other_id) REFERENCES expenses(id),
+			UNIQUE(expense_id, other_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS classifier_categories (
+			category TEXT PRIMARY KEY,
+			documents INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS classifier_features (
+			category TEXT NOT NULL,
+			feature TEXT NOT NULL,
+			count INTEGER NOT NULL,
+			PRIMARY KEY (feature, category)
+		)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			revoked_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)`,
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (session_id) REFERENCES sessions(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id)`,
 	}
 
 	for _, migration := range migrations {
@@ -96,5 +280,262 @@ func runMigrations(db *sql.DB) error {
 		}
 	}
 
+	// Columns added to tables that may already exist
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"expenses", "type", "TEXT NOT NULL DEFAULT 'expense'"},
+		{"expenses", "refund_of_id", "INTEGER REFERENCES expenses(id)"},
+		{"expenses", "notes", "TEXT NOT NULL DEFAULT ''"},
+		{"expenses", "payee_id", "INTEGER REFERENCES payees(id)"},
+		{"import_items", "account", "TEXT NOT NULL DEFAULT ''"},
+		{"import_items", "rule_id", "INTEGER REFERENCES budget_rules(id)"},
+		{"imports", "status", "TEXT NOT NULL DEFAULT 'staged'"},
+		{"import_items", "duplicate_of_id", "INTEGER REFERENCES expenses(id)"},
+		{"budget_rules", "operator", "TEXT NOT NULL DEFAULT 'or'"},
+		{"budget_rules", "conditions", "TEXT NOT NULL DEFAULT ''"},
+		{"import_items", "confidence", "REAL"},
+		{"budget_rules", "hit_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"budget_rules", "last_matched_at", "DATETIME"},
+		{"import_items", "manual", "INTEGER NOT NULL DEFAULT 0"},
+		{"sessions", "device_name", "TEXT NOT NULL DEFAULT ''"},
+		{"sessions", "platform", "TEXT NOT NULL DEFAULT ''"},
+		{"sessions", "ip_address", "TEXT NOT NULL DEFAULT ''"},
+		{"sessions", "user_agent", "TEXT NOT NULL DEFAULT ''"},
+		{"sessions", "last_seen_at", "DATETIME"},
+		{"import_items", "categorized_by", "TEXT"},
+		{"expenses", "categorized_by", "TEXT"},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
+	// Statements that depend on the added columns
+	postColumnMigrations := []string{
+		`CREATE INDEX IF NOT EXISTS idx_expenses_refund_of_id ON expenses(refund_of_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_expenses_payee_id ON expenses(payee_id)`,
+	}
+
+	for _, migration := range postColumnMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// migrateKeywordRules turns the comma-separated keywords of budget rules that
+// predate rule conditions into "contains" conditions, any of which matches
+func migrateKeywordRules(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, keywords FROM budget_rules WHERE conditions = ''`)
+	if err != nil {
+		return err
+	}
+	type condition struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	converted := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var keywords string
+		if err := rows.Scan(&id, &keywords); err != nil {
+			rows.Close()
+			return err
+		}
+		conditions := []condition{}
+		for _, keyword := range strings.Split(keywords, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				conditions = append(conditions, condition{Type: "contains", Value: keyword})
+			}
+		}
+		data, err := json.Marshal(conditions)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		converted[id] = string(data)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, conditions := range converted {
+		if _, err := db.Exec(`UPDATE budget_rules SET operator = 'or', conditions = ? WHERE id = ?`, conditions, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchTriggers keep expenses_fts in sync with expenses and payee names
+var searchTriggers = map[string]string{
+	"expenses_fts_insert": `CREATE TRIGGER IF NOT EXISTS expenses_fts_insert AFTER INSERT ON expenses BEGIN
+		INSERT INTO expenses_fts (rowid, description, notes, payee)
+		VALUES (new.id, new.description, new.notes, COALESCE((SELECT name FROM payees WHERE id = new.payee_id), ''));
+	END`,
+	"expenses_fts_update": `CREATE TRIGGER IF NOT EXISTS expenses_fts_update AFTER UPDATE OF description, notes, payee_id ON expenses BEGIN
+		DELETE FROM expenses_fts WHERE rowid = old.id;
+		INSERT INTO expenses_fts (rowid, description, notes, payee)
+		VALUES (new.id, new.description, new.notes, COALESCE((SELECT name FROM payees WHERE id = new.payee_id), ''));
+	END`,
+	"expenses_fts_delete": `CREATE TRIGGER IF NOT EXISTS expenses_fts_delete AFTER DELETE ON expenses BEGIN
+		DELETE FROM expenses_fts WHERE rowid = old.id;
+	END`,
+	"payees_fts_update": `CREATE TRIGGER IF NOT EXISTS payees_fts_update AFTER UPDATE OF name ON payees BEGIN
+		UPDATE expenses_fts SET payee = new.name
+		WHERE rowid IN (SELECT id FROM expenses WHERE payee_id = new.id);
+	END`,
+}
+
+// setupSearchIndex creates the FTS5 index over expenses. SQLite builds without FTS5
+// (go-sqlite3 needs the sqlite_fts5 build tag) keep running with the sync triggers
+// removed, and search falls back to plain LIKE matching.
+// migrateCategorizedBy records what chose the budget of import lines and
+// expenses that predate the column or were written by other tools, as far as
+// the import lines tell. Expenses found to be guesses or default budgets were
+// counted by the classifier, so its counts are dropped to retrain it on start.
+func migrateCategorizedBy(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE import_items SET categorized_by = CASE
+			WHEN manual = 1 OR budget_id IS NULL THEN ''
+			WHEN rule_id IS NOT NULL THEN 'rule'
+			WHEN confidence IS NULL THEN 'default'
+			WHEN confidence < 1 THEN 'classifier'
+			ELSE 'payee'
+		END
+		WHERE categorized_by IS NULL`); err != nil {
+		return err
+	}
+
+	var unlearned int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM expenses e
+		WHERE e.categorized_by IS NULL AND EXISTS (
+			SELECT 1 FROM import_items it
+			WHERE it.expense_id = e.id AND it.budget_id = e.budget_id AND it.categorized_by IN ('classifier', 'default')
+		)`).Scan(&unlearned); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE expenses SET categorized_by = COALESCE((
+			SELECT it.categorized_by FROM import_items it
+			WHERE it.expense_id = expenses.id AND it.budget_id = expenses.budget_id
+			LIMIT 1
+		), '')
+		WHERE categorized_by IS NULL`); err != nil {
+		return err
+	}
+	if unlearned > 0 {
+		for _, table := range []string{"classifier_features", "classifier_categories"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func setupSearchIndex(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		log.Printf("Warning: SQLite was built without FTS5, so expense search is unranked and has no snippets. Build with -tags sqlite_fts5 (make build) to enable it.")
+		for name := range searchTriggers {
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS expenses_fts USING fts5(
+		description, notes, payee,
+		tokenize = 'unicode61 remove_diacritics 2',
+		prefix = '2 3'
+	)`); err != nil {
+		return err
+	}
+
+	// Triggers missing means the index is new or was left stale by a build
+	// without FTS5, so rebuild it from scratch
+	names := make([]any, 0, len(searchTriggers))
+	for name := range searchTriggers {
+		names = append(names, name)
+	}
+	var existing int
+	if err := db.QueryRow(
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (?`+
+			strings.Repeat(", ?", len(names)-1)+`)`, names...,
+	).Scan(&existing); err != nil {
+		return err
+	}
+	if existing == len(searchTriggers) {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rebuild := []string{
+		`DELETE FROM expenses_fts`,
+		`INSERT INTO expenses_fts (rowid, description, notes, payee)
+		 SELECT e.id, e.description, e.notes, COALESCE(p.name, '')
+		 FROM expenses e LEFT JOIN payees p ON p.id = e.payee_id`,
+	}
+	for _, trigger := range searchTriggers {
+		rebuild = append(rebuild, trigger)
+	}
+	for _, statement := range rebuild {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
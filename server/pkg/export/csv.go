@@ -0,0 +1,101 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidSeparator is returned for a delimiter or decimal separator CSV cannot use
+var ErrInvalidSeparator = errors.New("invalid CSV separator")
+
+// CSVOptions controls the locale-dependent parts of a CSV file
+type CSVOptions struct {
+	Delimiter        rune // Defaults to ','
+	DecimalSeparator rune // '.' or ',', defaults to '.'
+	BOM              bool // Prefix a UTF-8 byte order mark so Excel detects the encoding
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	decimal string
+}
+
+// NewCSV returns a Writer producing CSV in the given layout
+func NewCSV(w io.Writer, opts CSVOptions) (Writer, error) {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.DecimalSeparator == 0 {
+		opts.DecimalSeparator = '.'
+	}
+	if opts.Delimiter == '"' || opts.Delimiter == '\r' || opts.Delimiter == '\n' ||
+		opts.Delimiter == utf8.RuneError || !utf8.ValidRune(opts.Delimiter) {
+		return nil, ErrInvalidSeparator
+	}
+	if opts.DecimalSeparator != '.' && opts.DecimalSeparator != ',' {
+		return nil, ErrInvalidSeparator
+	}
+
+	if opts.BOM {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return nil, err
+		}
+	}
+
+	out := csv.NewWriter(w)
+	out.Comma = opts.Delimiter
+	return &csvWriter{w: out, decimal: string(opts.DecimalSeparator)}, nil
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(cells []any) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = c.format(cell)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) format(cell any) string {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return escapeFormula(v)
+	case float64:
+		return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", c.decimal, 1)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		if isDate(v) {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05")
+	default:
+		return ""
+	}
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// escapeFormula quotes text that a spreadsheet would otherwise evaluate as a
+// formula, such as a description starting with "=" copied from a bank statement
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,22 @@
+// Package export writes tables as CSV or XLSX one row at a time, so that large
+// exports stream to the client instead of being built in memory
+package export
+
+import (
+	"time"
+)
+
+// Writer writes a table row by row. Cells may be string, float64, int64, bool,
+// time.Time or nil. Times without a time of day are written as dates.
+type Writer interface {
+	WriteHeader(columns []string) error
+	WriteRow(cells []any) error
+	// Close flushes buffered rows and finishes the file, leaving the
+	// underlying io.Writer open
+	Close() error
+}
+
+// isDate reports whether t carries no time of day
+func isDate(t time.Time) bool {
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
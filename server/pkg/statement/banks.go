@@ -0,0 +1,44 @@
+package statement
+
+import (
+	"regexp"
+)
+
+// englishAmount matches "1,234,567.89"; BCA always prints the cents
+var englishAmount = regexp.MustCompile(`^\d{1,3}(,\d{3})*\.\d{2}$`)
+
+// indonesianAmount matches "1.234.567,89", "-Rp50.000" or "+12,50". Plain
+// integers only count with a sign or currency, since descriptions hold numbers too.
+var indonesianAmount = regexp.MustCompile(`(?i)^[-+]?(Rp\.?|IDR)?(\d{1,3}(\.\d{3})+(,\d{1,2})?|\d+,\d{1,2})$|^([-+](Rp\.?|IDR)?|Rp\.?|IDR)\d+$`)
+
+// BCA reads KlikBCA and myBCA account statements: the CSV export, whose
+// "Tanggal Transaksi, Keterangan, Cabang, Jumlah, Saldo" rows mark amounts with
+// DB or CR, and text copied from the e-statement. Dates are "DD/MM", so the
+// year is taken from the statement period.
+var BCA StatementParser = &format{
+	bank:     "bca",
+	markers:  []string{"bank central asia", "klikbca", "mybca", "bca", "tahapan", "kode mata uang", "no. rekening"},
+	decimal:  '.',
+	amount:   englishAmount,
+	unmarked: Credit,
+}
+
+// Jago reads Bank Jago transaction histories: the CSV export with signed
+// Indonesian amounts, and text copied from the e-statement.
+var Jago StatementParser = &format{
+	bank:     "jago",
+	markers:  []string{"jago"},
+	decimal:  ',',
+	amount:   indonesianAmount,
+	unmarked: Debit,
+}
+
+// LineBank reads LINE Bank (KEB Hana) transaction histories as CSV or as
+// text copied from the e-statement.
+var LineBank StatementParser = &format{
+	bank:     "linebank",
+	markers:  []string{"line bank", "linebank", "keb hana", "hana bank"},
+	decimal:  ',',
+	amount:   indonesianAmount,
+	unmarked: Debit,
+}
@@ -0,0 +1,305 @@
+package statement
+
+import (
+	"encoding/csv"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// format is a bank export layout. Banks export either CSV with a header row, or
+// text copied from the e-statement with one transaction per line.
+type format struct {
+	bank    string
+	markers []string       // Lowercase text found near the top of the bank's exports
+	decimal byte           // Decimal separator assumed when an amount is ambiguous
+	amount  *regexp.Regexp // A whole token holding an amount in text exports
+	// unmarked is the direction of a text amount without sign or marker; BCA
+	// e-statements only mark debits
+	unmarked Direction
+}
+
+func (f *format) Bank() string {
+	return f.bank
+}
+
+func (f *format) Detect(data []byte) bool {
+	top := head(data)
+	for _, marker := range f.markers {
+		if strings.Contains(top, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *format) Parse(data []byte) ([]Transaction, error) {
+	text := strings.ReplaceAll(decode(data), "\r\n", "\n")
+	end := statementEnd(text)
+
+	if rows := readTable(text); rows != nil {
+		if transactions, ok := f.parseTable(rows, end); ok {
+			return transactions, nil
+		}
+	}
+
+	transactions := f.parseText(text, end)
+	if len(transactions) == 0 {
+		return nil, ErrUnrecognized
+	}
+	return transactions, nil
+}
+
+// Header names of the columns a CSV export may have, in English and Indonesian
+var headerAliases = map[string][]string{
+	"date": {"tanggal", "tanggal transaksi", "tgl", "tgl transaksi", "tgl. transaksi", "date",
+		"transaction date", "date & time", "date and time", "tanggal & waktu", "tanggal dan waktu",
+		"waktu transaksi", "posting date"},
+	"description": {"keterangan", "deskripsi", "description", "transaction details", "detail transaksi",
+		"rincian transaksi", "source/destination", "sumber/tujuan", "details", "uraian", "remark", "remarks"},
+	"amount":    {"jumlah", "amount", "nominal", "mutasi", "transaction amount", "jumlah transaksi"},
+	"debit":     {"debit", "debet", "uang keluar", "money out", "outgoing", "pengeluaran", "withdrawal"},
+	"credit":    {"kredit", "credit", "uang masuk", "money in", "incoming", "pemasukan", "deposit"},
+	"direction": {"db/cr", "d/k", "dc", "tipe", "type", "jenis", "jenis transaksi", "transaction type"},
+	"reference": {"no. referensi", "no referensi", "referensi", "reference", "reference no",
+		"reference number", "ref", "id transaksi", "transaction id"},
+}
+
+// columns are the positions of the known columns of a CSV export, -1 when absent
+type columns struct {
+	date, amount, debit, credit, direction, reference int
+	description                                       []int
+	named                                             map[int]bool
+}
+
+// readTable splits text into CSV rows using the most frequent of the common
+// delimiters, or returns nil when the text is not CSV
+func readTable(text string) [][]string {
+	lines := strings.SplitN(text, "\n", 30)
+	best, bestCount := ',', 0
+	for _, delimiter := range []rune{',', ';', '\t', '|'} {
+		count := 0
+		for _, line := range lines {
+			count += strings.Count(line, string(delimiter))
+		}
+		if count > bestCount {
+			best, bestCount = delimiter, count
+		}
+	}
+	if bestCount == 0 {
+		return nil
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = best
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil
+	}
+	return rows
+}
+
+// findHeader locates the header row, which needs a date, a description and an amount column
+func findHeader(rows [][]string) (int, columns, bool) {
+	for i, row := range rows {
+		cols := columns{date: -1, amount: -1, debit: -1, credit: -1, direction: -1, reference: -1, named: map[int]bool{}}
+		for j, cell := range row {
+			name := strings.Join(strings.Fields(strings.ToLower(cleanCell(cell))), " ")
+			name = strings.TrimSuffix(name, ":")
+			for field, aliases := range headerAliases {
+				for _, alias := range aliases {
+					if name != alias {
+						continue
+					}
+					cols.named[j] = true
+					switch field {
+					case "date":
+						if cols.date < 0 {
+							cols.date = j
+						}
+					case "description":
+						cols.description = append(cols.description, j)
+					case "amount":
+						cols.amount = j
+					case "debit":
+						cols.debit = j
+					case "credit":
+						cols.credit = j
+					case "direction":
+						cols.direction = j
+					case "reference":
+						cols.reference = j
+					}
+				}
+			}
+		}
+		if cols.date >= 0 && len(cols.description) > 0 && (cols.amount >= 0 || cols.debit >= 0 || cols.credit >= 0) {
+			return i, cols, true
+		}
+	}
+	return 0, columns{}, false
+}
+
+// parseTable reads the rows below the header. Rows without a valid date, such as
+// opening and closing balances, are skipped.
+func (f *format) parseTable(rows [][]string, end time.Time) ([]Transaction, bool) {
+	start, cols, ok := findHeader(rows)
+	if !ok {
+		return nil, false
+	}
+
+	cell := func(row []string, i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return cleanCell(row[i])
+	}
+
+	transactions := []Transaction{}
+	for _, row := range rows[start+1:] {
+		date, err := parseDate(cell(row, cols.date), end)
+		if err != nil {
+			continue
+		}
+
+		var parts []string
+		for _, i := range cols.description {
+			if part := cell(row, i); part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		tx := Transaction{
+			Date:        date,
+			Description: strings.Join(strings.Fields(strings.Join(parts, " ")), " "),
+			Reference:   cell(row, cols.reference),
+		}
+
+		if cols.amount >= 0 {
+			if tx.Amount, tx.Direction, err = parseAmount(cell(row, cols.amount), f.decimal); err != nil {
+				continue
+			}
+			if tx.Direction == "" {
+				tx.Direction = parseDirection(cell(row, cols.direction))
+			}
+			// BCA puts the DB/CR marker in an unnamed column after the amount
+			if tx.Direction == "" && !cols.named[cols.amount+1] {
+				tx.Direction = parseDirection(cell(row, cols.amount+1))
+			}
+		} else {
+			if amount, _, err := parseAmount(cell(row, cols.debit), f.decimal); err == nil && amount > 0 {
+				tx.Amount, tx.Direction = amount, Debit
+			} else if amount, _, err := parseAmount(cell(row, cols.credit), f.decimal); err == nil && amount > 0 {
+				tx.Amount, tx.Direction = amount, Credit
+			}
+		}
+
+		if tx.Amount <= 0 || tx.Description == "" {
+			continue
+		}
+		if tx.Direction == "" {
+			tx.Direction = Debit
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions, true
+}
+
+// lineDate matches the date, and optional time, opening a transaction line
+var lineDate = regexp.MustCompile(`^(\d{1,2}[/-]\d{1,2}(?:[/-]\d{2,4})?|\d{4}-\d{2}-\d{2}|\d{1,2}[\s-][A-Za-z]{3,9}\.?[\s-]\d{4})(?:,?\s+\d{1,2}[:.]\d{2}(?:[:.]\d{2})?)?\s+`)
+
+// amountPrefixes are tokens that belong to the amount following them
+var amountPrefixes = map[string]bool{
+	"rp": true, "rp.": true, "idr": true, "-": true, "+": true,
+	"-rp": true, "+rp": true, "-rp.": true, "+rp.": true, "-idr": true, "+idr": true,
+}
+
+// maxContinuation is how many lines without a date may extend a description
+const maxContinuation = 3
+
+// parseText reads one transaction per line starting with a date. The description
+// runs up to the first amount, which may carry a sign or a DB/CR marker; a later
+// amount is the running balance and is ignored.
+func (f *format) parseText(text string, end time.Time) []Transaction {
+	var transactions []Transaction
+	continuation := 0
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		match := lineDate.FindStringSubmatchIndex(line)
+		if match == nil {
+			// Wrapped descriptions continue on the following lines
+			n := len(transactions)
+			if n > 0 && continuation < maxContinuation && line != "" && !f.hasAmount(strings.Fields(line)) {
+				transactions[n-1].Description += " " + strings.Join(strings.Fields(line), " ")
+				continuation++
+			}
+			continue
+		}
+		continuation = maxContinuation
+
+		date, err := parseDate(line[match[2]:match[3]], end)
+		if err != nil {
+			continue
+		}
+
+		fields := strings.Fields(line[match[1]:])
+		for i := 0; i < len(fields); i++ {
+			token := fields[i]
+			j := i
+			for amountPrefixes[strings.ToLower(token)] && j+1 < len(fields) {
+				j++
+				token += fields[j]
+			}
+			if !f.amount.MatchString(token) {
+				continue
+			}
+
+			amount, direction, err := parseAmount(token, f.decimal)
+			if err != nil || amount <= 0 || i == 0 {
+				break
+			}
+			if direction == "" && j+1 < len(fields) {
+				direction = parseDirection(fields[j+1])
+			}
+			if direction == "" {
+				direction = f.unmarked
+			}
+
+			description := strings.Join(fields[:i], " ")
+			if strings.HasPrefix(strings.ToUpper(description), "SALDO") {
+				break // Opening or closing balance
+			}
+			transactions = append(transactions, Transaction{
+				Date:        date,
+				Description: description,
+				Amount:      amount,
+				Direction:   direction,
+			})
+			continuation = 0
+			break
+		}
+	}
+	return transactions
+}
+
+func (f *format) hasAmount(fields []string) bool {
+	for _, field := range fields {
+		if f.amount.MatchString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanCell trims a CSV cell and the apostrophes spreadsheets use to keep text as
+// text, which BCA wraps around its cells
+func cleanCell(cell string) string {
+	cell = strings.TrimSpace(cell)
+	if rest, ok := strings.CutPrefix(cell, "'"); ok {
+		cell = strings.TrimSuffix(rest, "'")
+	}
+	return strings.TrimSpace(cell)
+}
@@ -0,0 +1,235 @@
+package statement
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OFX reads Open Financial Exchange statements: OFX 1.x, whose SGML leaves
+// have no closing tags, OFX 2.x XML, and Quicken's QFX, which is OFX with an
+// Intuit header. Every bank and credit card statement in the file is read,
+// with FITID as the reference and the account number as Account.
+var OFX StatementParser = ofxParser{}
+
+type ofxParser struct{}
+
+func (ofxParser) Bank() string {
+	return "ofx"
+}
+
+func (ofxParser) Detect(data []byte) bool {
+	top := head(data)
+	return strings.Contains(top, "ofxheader") || strings.Contains(top, "<ofx>")
+}
+
+func (ofxParser) Parse(data []byte) ([]Transaction, error) {
+	root := parseOFX(decode(data))
+	if root == nil {
+		return nil, ErrUnrecognized
+	}
+
+	var transactions []Transaction
+	statements := append(root.findAll("STMTRS"), root.findAll("CCSTMTRS")...)
+	for _, stmt := range statements {
+		account := ofxAccount(stmt)
+		list := stmt.find("BANKTRANLIST")
+		if list == nil {
+			continue
+		}
+		for _, trn := range list.findAll("STMTTRN") {
+			if tx, ok := ofxTransaction(trn); ok {
+				tx.Account = account
+				transactions = append(transactions, tx)
+			}
+		}
+	}
+
+	if len(transactions) == 0 {
+		return nil, ErrUnrecognized
+	}
+	return transactions, nil
+}
+
+// ofxDebitTypes are the TRNTYPE values of money leaving the account, for
+// banks that export them with unsigned amounts
+var ofxDebitTypes = map[string]bool{
+	"DEBIT": true, "PAYMENT": true, "CHECK": true, "ATM": true, "POS": true, "FEE": true,
+	"SRVCHG": true, "CASH": true, "DIRECTDEBIT": true, "REPEATPMT": true,
+}
+
+func ofxTransaction(trn *ofxNode) (Transaction, bool) {
+	date, err := parseOFXDate(trn.value("DTPOSTED"))
+	if err != nil {
+		if date, err = parseOFXDate(trn.value("DTUSER")); err != nil {
+			return Transaction{}, false
+		}
+	}
+
+	raw := strings.TrimPrefix(strings.TrimSpace(trn.value("TRNAMT")), "+")
+	if !strings.Contains(raw, ".") {
+		raw = strings.Replace(raw, ",", ".", 1) // Decimal comma of some locales
+	}
+	amount, err := strconv.ParseFloat(raw, 64)
+	if err != nil || amount == 0 {
+		return Transaction{}, false
+	}
+
+	kind := strings.ToUpper(trn.value("TRNTYPE"))
+	tx := Transaction{Date: date, Amount: amount, Direction: Credit, Reference: trn.value("FITID")}
+	if amount < 0 || ofxDebitTypes[kind] {
+		tx.Amount, tx.Direction = math.Abs(amount), Debit
+	}
+
+	name, memo := trn.value("NAME"), trn.value("MEMO")
+	switch {
+	case name == "":
+		tx.Description = memo
+	case memo == "" || strings.Contains(strings.ToLower(name), strings.ToLower(memo)):
+		tx.Description = name
+	default:
+		tx.Description = name + " " + memo
+	}
+	if tx.Description == "" {
+		tx.Description = kind
+	}
+	tx.Description = strings.Join(strings.Fields(tx.Description), " ")
+	return tx, tx.Description != ""
+}
+
+// ofxAccount names the account of a statement, prefixed by the bank's routing
+// number when it has one
+func ofxAccount(stmt *ofxNode) string {
+	from := stmt.find("BANKACCTFROM")
+	if from == nil {
+		from = stmt.find("CCACCTFROM")
+	}
+	if from == nil {
+		return ""
+	}
+	account := from.value("ACCTID")
+	if bank := from.value("BANKID"); bank != "" && account != "" {
+		account = bank + "/" + account
+	}
+	return account
+}
+
+// parseOFXDate reads "YYYYMMDD" optionally followed by a time and a zone, as in
+// "20251231120000.000[-7:MST]". The date is taken as printed, in the bank's zone.
+func parseOFXDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 8 {
+		return time.Time{}, errInvalidDate
+	}
+	return time.Parse("20060102", s[:8])
+}
+
+// ofxNode is an element of an OFX document: an aggregate with children, or a
+// leaf with a value
+type ofxNode struct {
+	name     string
+	text     string
+	children []*ofxNode
+}
+
+// find returns the first descendant with the given name
+func (n *ofxNode) find(name string) *ofxNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+		if found := child.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns the outermost descendants with the given name
+func (n *ofxNode) findAll(name string) []*ofxNode {
+	var found []*ofxNode
+	for _, child := range n.children {
+		if child.name == name {
+			found = append(found, child)
+		} else {
+			found = append(found, child.findAll(name)...)
+		}
+	}
+	return found
+}
+
+// value returns the text of the first descendant leaf with the given name
+func (n *ofxNode) value(name string) string {
+	if leaf := n.find(name); leaf != nil {
+		return leaf.text
+	}
+	return ""
+}
+
+var ofxEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&nbsp;", " ", "&amp;", "&")
+
+// parseOFX builds the element tree below the <OFX> tag, or returns nil when
+// there is none. A tag directly followed by text is a leaf whether or not it is
+// closed, which covers both SGML and XML. A closing tag ends the innermost open
+// aggregate of that name, so an empty SGML leaf mistaken for an aggregate is
+// closed together with its parent.
+func parseOFX(text string) *ofxNode {
+	start := strings.Index(strings.ToUpper(text), "<OFX>")
+	if start < 0 {
+		return nil
+	}
+
+	root := &ofxNode{}
+	stack := []*ofxNode{root}
+	rest := text[start:]
+	for {
+		open := strings.IndexByte(rest, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[open:], '>')
+		if end < 0 {
+			break
+		}
+		tag := strings.TrimSpace(rest[open+1 : open+end])
+		rest = rest[open+end+1:]
+		if tag == "" || tag[0] == '?' || tag[0] == '!' {
+			continue // Processing instruction or comment
+		}
+
+		if name, ok := strings.CutPrefix(tag, "/"); ok {
+			name = strings.ToUpper(strings.TrimSpace(name))
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+
+		selfClosing := strings.HasSuffix(tag, "/")
+		fields := strings.Fields(strings.TrimSuffix(tag, "/"))
+		if len(fields) == 0 {
+			continue
+		}
+		node := &ofxNode{name: strings.ToUpper(fields[0])}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, node)
+		if selfClosing {
+			continue
+		}
+
+		next := strings.IndexByte(rest, '<')
+		if next < 0 {
+			next = len(rest)
+		}
+		if value := strings.TrimSpace(rest[:next]); value != "" {
+			node.text = ofxEntities.Replace(value)
+			continue
+		}
+		stack = append(stack, node)
+	}
+	return root
+}
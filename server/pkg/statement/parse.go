@@ -0,0 +1,204 @@
+package statement
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidAmount = errors.New("invalid amount")
+	errInvalidDate   = errors.New("invalid date")
+)
+
+// directions maps the debit and credit markers banks print next to amounts
+var directions = map[string]Direction{
+	"DB": Debit, "DR": Debit, "D": Debit, "DEBIT": Debit, "DEBET": Debit, "-": Debit,
+	"CR": Credit, "C": Credit, "K": Credit, "KR": Credit, "CREDIT": Credit, "KREDIT": Credit, "+": Credit,
+}
+
+// parseDirection reads a debit or credit marker, returning "" for anything else
+func parseDirection(s string) Direction {
+	return directions[strings.ToUpper(strings.TrimSpace(s))]
+}
+
+// parseAmount reads amounts such as "1.234.567,89", "1,234,567.89", "-Rp50.000",
+// "50,000.00 DB" or "(12.000)". A sign, parentheses or a DB/CR marker set the
+// direction. When a single separator could be either kind, as in "50.000",
+// decimal decides whether it is the decimal separator.
+func parseAmount(s string, decimal byte) (float64, Direction, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	var direction Direction
+
+	for _, marker := range []string{"DB", "DR", "CR", "D", "K", "C"} {
+		if rest, ok := strings.CutSuffix(s, marker); ok && rest != "" {
+			direction = directions[marker]
+			s = strings.TrimSpace(rest)
+			break
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")"):
+		s, direction = s[1:len(s)-1], Debit
+	case strings.HasPrefix(s, "-"):
+		s, direction = s[1:], Debit
+	case strings.HasSuffix(s, "-"):
+		s, direction = s[:len(s)-1], Debit
+	case strings.HasPrefix(s, "+"):
+		s, direction = s[1:], Credit
+	}
+
+	s = strings.TrimSpace(s)
+	for _, currency := range []string{"RP.", "RP", "IDR"} {
+		if rest, ok := strings.CutPrefix(s, currency); ok {
+			s = rest
+			break
+		}
+	}
+	s = strings.NewReplacer(" ", "", "\u00a0", "").Replace(s)
+	if s == "" || strings.Trim(s, "0123456789.,") != "" {
+		return 0, "", errInvalidAmount
+	}
+
+	// The separator that comes last is the decimal one when both appear; a
+	// single separator repeated, or followed by three digits, groups thousands
+	lastDot, lastComma := strings.LastIndexByte(s, '.'), strings.LastIndexByte(s, ',')
+	var thousands, point string
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastDot > lastComma {
+			thousands, point = ",", "."
+		} else {
+			thousands, point = ".", ","
+		}
+	case lastDot >= 0 || lastComma >= 0:
+		sep := "."
+		last := lastDot
+		if lastComma >= 0 {
+			sep, last = ",", lastComma
+		}
+		switch {
+		case strings.Count(s, sep) > 1:
+			thousands = sep
+		case len(s)-last-1 != 3 || sep[0] == decimal:
+			point = sep
+		default:
+			thousands = sep
+		}
+	}
+
+	if thousands != "" {
+		s = strings.ReplaceAll(s, thousands, "")
+	}
+	if point != "" {
+		s = strings.Replace(s, point, ".", 1)
+	}
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, "", errInvalidAmount
+	}
+	return amount, direction, nil
+}
+
+// months maps English and Indonesian month names and abbreviations to the
+// abbreviations time.Parse understands
+var months = map[string]string{
+	"jan": "Jan", "januari": "Jan", "january": "Jan",
+	"feb": "Feb", "februari": "Feb", "pebruari": "Feb", "february": "Feb",
+	"mar": "Mar", "maret": "Mar", "march": "Mar",
+	"apr": "Apr", "april": "Apr",
+	"may": "May", "mei": "May",
+	"jun": "Jun", "juni": "Jun", "june": "Jun",
+	"jul": "Jul", "juli": "Jul", "july": "Jul",
+	"aug": "Aug", "agu": "Aug", "agt": "Aug", "agustus": "Aug", "august": "Aug",
+	"sep": "Sep", "sept": "Sep", "september": "Sep",
+	"oct": "Oct", "okt": "Oct", "oktober": "Oct", "october": "Oct",
+	"nov": "Nov", "nop": "Nov", "november": "Nov", "nopember": "Nov",
+	"dec": "Dec", "des": "Dec", "desember": "Dec", "december": "Dec",
+}
+
+// monthWord matches a word with an optional abbreviation dot, as in "Okt."
+var monthWord = regexp.MustCompile(`[A-Za-z]+\.?`)
+
+// dottedTime matches a trailing time written as "14.30"
+var dottedTime = regexp.MustCompile(`\s\d{1,2}\.\d{2}(\.\d{2})?$`)
+
+// dateLayouts are tried in order; days come before months as in Indonesian usage
+var dateLayouts = []string{
+	"2/1/2006", "2/1/2006 15:04", "2/1/2006 15:04:05",
+	"2-1-2006", "2-1-2006 15:04", "2-1-2006 15:04:05",
+	"2/1/06", "2/1/06 15:04",
+	"2006-1-2", "2006-1-2 15:04", "2006-1-2 15:04:05", time.RFC3339,
+	"2 Jan 2006", "2 Jan 2006 15:04", "2 Jan 2006 15:04:05", "2 Jan 2006, 15:04", "2 Jan 2006, 15:04:05",
+	"2-Jan-2006", "2-Jan-06", "Jan 2, 2006", "Jan 2 2006",
+}
+
+// yearless matches the "DD/MM" dates of BCA statements
+var yearless = regexp.MustCompile(`^(\d{1,2})/(\d{1,2})$`)
+
+// parseDate reads a transaction date. Dates without a year fall in the year
+// leading up to end, the last day of the statement, or today when unknown.
+func parseDate(s string, end time.Time) (time.Time, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	s = dottedTime.ReplaceAllStringFunc(s, func(t string) string {
+		return strings.ReplaceAll(t, ".", ":")
+	})
+	s = monthWord.ReplaceAllStringFunc(s, func(word string) string {
+		if month, ok := months[strings.ToLower(strings.TrimSuffix(word, "."))]; ok {
+			return month
+		}
+		return word
+	})
+
+	if m := yearless.FindStringSubmatch(s); m != nil {
+		if end.IsZero() {
+			end = time.Now()
+		}
+		day, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			return time.Time{}, errInvalidDate
+		}
+		year := end.Year()
+		if time.Month(month) > end.Month() {
+			year--
+		}
+		return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errInvalidDate
+}
+
+// periodDates finds the dates on a statement's period line
+var periodDates = regexp.MustCompile(`\d{1,2}[/-]\d{1,2}[/-]\d{4}|\d{1,2}\s+[A-Za-z]{3,9}\s+\d{4}`)
+
+// headerLines is how far down a statement its period is looked for
+const headerLines = 40
+
+// statementEnd returns the last day of the period printed in a statement's
+// header, or the zero time when there is none
+func statementEnd(text string) time.Time {
+	lines := strings.SplitN(text, "\n", headerLines+1)
+	for _, line := range lines[:min(len(lines), headerLines)] {
+		lower := strings.ToLower(line)
+		if !strings.Contains(lower, "periode") && !strings.Contains(lower, "period") {
+			continue
+		}
+		dates := periodDates.FindAllString(line, -1)
+		if len(dates) == 0 {
+			continue
+		}
+		if end, err := parseDate(dates[len(dates)-1], time.Time{}); err == nil {
+			return end
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,197 @@
+package statement
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QIF reads Quicken Interchange Format files. Bank, cash and credit card
+// sections are read; investment sections and category, class and memorized
+// lists are ignored. The "!Account" blocks of multi-account exports name the
+// Account of the sections following them. QIF has no transaction IDs.
+var QIF StatementParser = qifParser{}
+
+type qifParser struct{}
+
+func (qifParser) Bank() string {
+	return "qif"
+}
+
+func (qifParser) Detect(data []byte) bool {
+	top := strings.TrimSpace(head(data))
+	return strings.HasPrefix(top, "!type:") || strings.HasPrefix(top, "!account") ||
+		strings.HasPrefix(top, "!option:") || strings.HasPrefix(top, "!clear:")
+}
+
+// qifSections are the "!Type:" headers of sections holding transactions
+var qifSections = map[string]bool{"bank": true, "cash": true, "ccard": true, "oth a": true, "oth l": true}
+
+// qifRecord is a transaction as written, before its date can be read
+type qifRecord struct {
+	date, amount, payee, memo, account string
+}
+
+func (qifParser) Parse(data []byte) ([]Transaction, error) {
+	var records []qifRecord
+	var record qifRecord
+	var account, accountName string
+	inAccount, inTransactions := false, false
+
+	for _, line := range strings.Split(decode(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			header := strings.ToLower(strings.TrimSpace(line))
+			switch {
+			case header == "!account":
+				inAccount, inTransactions = true, false
+			case strings.HasPrefix(header, "!type:"):
+				inAccount = false
+				inTransactions = qifSections[strings.TrimSpace(strings.TrimPrefix(header, "!type:"))]
+			}
+			continue
+		}
+
+		code, value := line[0], strings.TrimSpace(line[1:])
+		if inAccount {
+			switch code {
+			case 'N':
+				accountName = value
+			case '^':
+				account = accountName
+			}
+			continue
+		}
+		if !inTransactions {
+			continue
+		}
+
+		switch code {
+		case 'D':
+			record.date = value
+		case 'T', 'U':
+			if record.amount == "" {
+				record.amount = value
+			}
+		case 'P':
+			record.payee = value
+		case 'M':
+			record.memo = value
+		case '^':
+			record.account = account
+			records = append(records, record)
+			record = qifRecord{}
+		}
+	}
+	if record.date != "" && record.amount != "" {
+		record.account = account
+		records = append(records, record)
+	}
+
+	dayFirst := qifDayFirst(records)
+	var transactions []Transaction
+	for _, r := range records {
+		date, err := parseQIFDate(r.date, dayFirst)
+		if err != nil {
+			continue
+		}
+		amount, direction, err := parseAmount(r.amount, '.')
+		if err != nil || amount == 0 {
+			continue
+		}
+		if direction == "" {
+			direction = Credit
+		}
+
+		description := r.payee
+		switch {
+		case description == "":
+			description = r.memo
+		case r.memo != "" && !strings.Contains(strings.ToLower(description), strings.ToLower(r.memo)):
+			description += " " + r.memo
+		}
+		description = strings.Join(strings.Fields(description), " ")
+		if description == "" {
+			continue
+		}
+
+		transactions = append(transactions, Transaction{
+			Date:        date,
+			Description: description,
+			Amount:      amount,
+			Direction:   direction,
+			Account:     r.account,
+		})
+	}
+
+	if len(transactions) == 0 {
+		return nil, ErrUnrecognized
+	}
+	return transactions, nil
+}
+
+// qifDateParts splits dates such as "12/31/2025", "1/ 5'26", "31.12.25" or
+// "2025-12-31" into their numbers; an apostrophe marks a year after 1999
+var qifDateParts = regexp.MustCompile(`^(\d{1,4})\s*[/.\-]\s*(\d{1,2})\s*([/.\-']\s*)(\d{2,4})$`)
+
+// qifDayFirst decides the order of day and month for a whole file, since a
+// single date such as 03/04/2025 cannot tell. Quicken writes month first, while
+// dotted dates and the exports of most non-US apps put the day first.
+func qifDayFirst(records []qifRecord) bool {
+	dotted := false
+	for _, r := range records {
+		m := qifDateParts.FindStringSubmatch(strings.TrimSpace(r.date))
+		if m == nil || len(m[1]) == 4 {
+			continue
+		}
+		first, _ := strconv.Atoi(m[1])
+		second, _ := strconv.Atoi(m[2])
+		switch {
+		case first > 12:
+			return true
+		case second > 12:
+			return false
+		}
+		dotted = dotted || strings.Contains(r.date, ".")
+	}
+	return dotted
+}
+
+func parseQIFDate(s string, dayFirst bool) (time.Time, error) {
+	m := qifDateParts.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}, errInvalidDate
+	}
+	first, _ := strconv.Atoi(m[1])
+	second, _ := strconv.Atoi(m[2])
+	last, _ := strconv.Atoi(m[4])
+
+	var year, month, day int
+	switch {
+	case len(m[1]) == 4:
+		year, month, day = first, second, last
+	case dayFirst:
+		day, month, year = first, second, last
+	default:
+		month, day, year = first, second, last
+	}
+	if len(m[1]) != 4 && len(m[4]) == 2 {
+		switch {
+		case strings.HasPrefix(m[3], "'"), year < 70:
+			year += 2000
+		default:
+			year += 1900
+		}
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if month < 1 || month > 12 || date.Day() != day {
+		return time.Time{}, errInvalidDate
+	}
+	return date, nil
+}
@@ -0,0 +1,99 @@
+// Package statement parses bank transaction exports, from the CSV and text
+// exports of Indonesian banks to OFX, QFX and QIF files, into a common
+// Transaction form. Parsers only read; importing is up to the caller.
+package statement
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrUnrecognized is returned when no parser understands a statement
+var ErrUnrecognized = errors.New("unrecognized statement format")
+
+// bom is the UTF-8 byte order mark spreadsheet exports may start with
+var bom = []byte("\ufeff")
+
+// detectWindow is how much of a statement is searched for bank markers, which
+// keeps transfer descriptions naming other banks from confusing detection
+const detectWindow = 2048
+
+// Direction tells money leaving the account from money arriving
+type Direction string
+
+const (
+	Debit  Direction = "debit"
+	Credit Direction = "credit"
+)
+
+// Transaction is one line of a bank statement
+type Transaction struct {
+	Date        time.Time
+	Description string
+	Amount      float64 // Always positive; see Direction
+	Direction   Direction
+	Reference   string // Bank transaction ID, when the format carries one
+	Account     string // Account the line belongs to, for files holding several
+}
+
+// StatementParser reads the statements exported by one bank
+type StatementParser interface {
+	// Bank returns the key the parser is selected by, e.g. "bca"
+	Bank() string
+	// Detect reports whether data looks like a statement of this bank
+	Detect(data []byte) bool
+	Parse(data []byte) ([]Transaction, error)
+}
+
+// parsers are tried in order by Detect, so formats with distinctive markers go first
+var parsers = []StatementParser{OFX, QIF, Jago, LineBank, BCA}
+
+// aliases are further keys parsers can be looked up by
+var aliases = map[string]string{"qfx": "ofx"}
+
+// Lookup returns the parser for a bank key
+func Lookup(bank string) (StatementParser, bool) {
+	bank = strings.ToLower(bank)
+	if key, ok := aliases[bank]; ok {
+		bank = key
+	}
+	for _, parser := range parsers {
+		if parser.Bank() == bank {
+			return parser, true
+		}
+	}
+	return nil, false
+}
+
+// Detect returns the first parser recognising data
+func Detect(data []byte) (StatementParser, bool) {
+	for _, parser := range parsers {
+		if parser.Detect(data) {
+			return parser, true
+		}
+	}
+	return nil, false
+}
+
+// Banks lists the keys Lookup accepts
+func Banks() []string {
+	banks := make([]string, 0, len(parsers)+len(aliases))
+	for _, parser := range parsers {
+		banks = append(banks, parser.Bank())
+	}
+	for alias := range aliases {
+		banks = append(banks, alias)
+	}
+	sort.Strings(banks)
+	return banks
+}
+
+// head returns the lowercased start of a statement for marker detection
+func head(data []byte) string {
+	if len(data) > detectWindow {
+		data = data[:detectWindow]
+	}
+	return strings.ToLower(decode(data))
+}
@@ -0,0 +1,218 @@
+package statement
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// line is the expected reading of one statement transaction
+type line struct {
+	date        string
+	description string
+	amount      float64
+	direction   Direction
+	reference   string
+	account     string
+}
+
+// corpus lists every file in testdata with the parser that should detect it
+// and the transactions it holds, in statement order
+var corpus = []struct {
+	file     string
+	bank     string
+	accounts int
+	lines    []line
+}{
+	{"bca.csv", "bca", 0, []line{
+		// Year-less dates fall in the statement period, which spans new year;
+		// the pending line is left out
+		{"2025-12-28", "TRSF E-BANKING DB 2812/FTSCY/WS95031 50000.00 GOFOOD", 50000, Debit, "", ""},
+		{"2026-01-02", "KARTU DEBIT IKEA ALAM SUTERA", 1500000, Debit, "", ""},
+		{"2026-01-03", "TRSF E-BANKING CR 0301/FTFVA/WS95051 GAJI", 10000000, Credit, "", ""},
+	}},
+	{"bca.txt", "bca", 0, []line{
+		// Continuation lines join the description; the opening balance is not a transaction
+		{"2025-12-28", "TRSF E-BANKING DB 2812/FTSCY/WS95031 GOFOOD JAKARTA", 50000, Debit, "", ""},
+		{"2026-01-02", "KARTU DEBIT IKEA", 1500000, Debit, "", ""},
+		{"2026-01-03", "BI-FAST CR GAJI", 10000000, Credit, "", ""},
+	}},
+	{"jago.csv", "jago", 0, []line{
+		{"2025-10-15", "GoPay Outgoing transfer", 50000, Debit, "", ""},
+		{"2025-10-16", "PT KERJA Incoming transfer", 10000000, Credit, "", ""},
+		{"2025-10-17", "Tokopedia QRIS payment", 125500.50, Debit, "", ""},
+	}},
+	{"jago.txt", "jago", 0, []line{
+		{"2025-10-15", "GoPay Outgoing transfer", 50000, Debit, "", ""},
+		{"2025-10-16", "PT KERJA Incoming transfer", 10000000, Credit, "", ""},
+	}},
+	{"linebank.csv", "linebank", 0, []line{
+		{"2025-10-01", "Transfer ke BCA 1234", 1000000, Debit, "", ""},
+		{"2025-10-02", "Bunga", 12345.67, Credit, "", ""},
+	}},
+	{"multi-account.ofx", "ofx", 2, []line{
+		{"2025-10-03", "GOFOOD JAKARTA Makan siang", 75000, Debit, "202510030001", "014/1234567890"},
+		// Unsigned POS amount with a decimal comma, Windows-1252 name
+		{"2025-10-04", "Café & Bistro", 1250000.50, Debit, "202510040002", "014/1234567890"},
+		{"2025-10-25", "GAJI OKTOBER", 10000000, Credit, "202510250003", "014/1234567890"},
+		{"2025-10-12", "TOKOPEDIA & CO Cicilan 0%", 349000, Debit, "CC-0001", "4111XXXXXXXX1111"},
+		{"2025-10-20", "PEMBAYARAN KARTU", 349000, Credit, "CC-0002", "4111XXXXXXXX1111"},
+	}},
+	{"ofx2.ofx", "ofx", 1, []line{
+		{"2025-11-02", "PLN Prabayar Token listrik <20 kWh>", 150000, Debit, "T20251102A", "542/100200300"},
+		{"2025-11-30", "Bunga tabungan", 1234.56, Credit, "T20251130B", "542/100200300"},
+		{"2025-11-30", "Biaya admin", 6500, Debit, "T20251130C", "542/100200300"},
+	}},
+	{"quicken.qfx", "ofx", 1, []line{
+		// Two identical purchases, told apart only by their FITIDs
+		{"2026-01-02", "STARBUCKS #123 Kopi – pagi", 12.34, Debit, "QFX-1", "121000248/987654321"},
+		{"2026-01-02", "STARBUCKS #123", 12.34, Debit, "QFX-2", "121000248/987654321"},
+		{"2026-01-03", "CHECK 1001", 200, Debit, "QFX-3", "121000248/987654321"},
+	}},
+	{"multi-account.qif", "qif", 2, []line{
+		{"2025-10-01", "GOFOOD Makan siang", 75000, Debit, "", "BCA Tahapan"},
+		{"2025-10-25", "GAJI OKTOBER", 10000000, Credit, "", "BCA Tahapan"},
+		{"2025-10-03", "Penarikan tunai ATM", 1250000.50, Debit, "", "BCA Tahapan"},
+		{"2025-10-12", "TOKOPEDIA Cicilan 0%", 349000, Debit, "", "Kartu Kredit"},
+	}},
+	{"day-month.qif", "qif", 0, []line{
+		// 30/11 only fits day-first, so 03.11 is the 3rd of November
+		{"2025-11-03", "Indomaret Café", 45000, Debit, "", ""},
+		{"2025-11-15", "Transfer masuk", 2500000, Credit, "", ""},
+		{"2025-11-30", "Biaya bulanan", 1200.50, Debit, "", ""},
+	}},
+	{"utf16.qif", "qif", 0, []line{
+		{"2025-12-24", "Parkir & tol", 150000, Debit, "", ""},
+		{"2025-12-25", "Angpao", 85000, Debit, "", ""},
+	}},
+}
+
+func TestCorpus(t *testing.T) {
+	for _, tc := range corpus {
+		t.Run(tc.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser, ok := Detect(data)
+			if !ok || parser.Bank() != tc.bank {
+				t.Fatalf("detected %v, want %s", parser, tc.bank)
+			}
+			transactions, err := parser.Parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(transactions) != len(tc.lines) {
+				t.Fatalf("got %d transactions, want %d: %+v", len(transactions), len(tc.lines), transactions)
+			}
+
+			accounts := make(map[string]bool)
+			references := make(map[string]bool)
+			for i, tx := range transactions {
+				want := tc.lines[i]
+				got := line{tx.Date.Format("2006-01-02"), tx.Description, tx.Amount, tx.Direction, tx.Reference, tx.Account}
+				if got != want {
+					t.Errorf("transaction %d:\n got %+v\nwant %+v", i+1, got, want)
+				}
+				if tx.Amount <= 0 {
+					t.Errorf("transaction %d: amount %v is not positive", i+1, tx.Amount)
+				}
+				if tx.Account != "" {
+					accounts[tx.Account] = true
+				}
+				if tx.Reference != "" {
+					if references[tx.Reference] {
+						t.Errorf("transaction %d: reference %q repeats", i+1, tx.Reference)
+					}
+					references[tx.Reference] = true
+				}
+			}
+			if len(accounts) != tc.accounts {
+				t.Errorf("got %d accounts, want %d", len(accounts), tc.accounts)
+			}
+		})
+	}
+}
+
+// Each fixture is also recognised by the parser its bank key selects
+func TestLookupMatchesDetect(t *testing.T) {
+	for _, tc := range corpus {
+		data, err := os.ReadFile(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parser, ok := Lookup(tc.bank)
+		if !ok || !parser.Detect(data) {
+			t.Errorf("%s: parser %q does not detect it", tc.file, tc.bank)
+		}
+	}
+	if parser, ok := Lookup("QFX"); !ok || parser.Bank() != "ofx" {
+		t.Errorf(`Lookup("QFX") = %v, %v; want the OFX parser`, parser, ok)
+	}
+}
+
+func TestDecodeUTF16(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "utf16.qif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 2 || !(data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF) {
+		t.Fatal("fixture lost its UTF-16 byte order mark")
+	}
+	if got := decode(data); !strings.HasPrefix(got, "!Type:Cash") || !strings.Contains(got, "Parkir & tol") {
+		t.Errorf("decode = %q, want the QIF text", got)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	for _, tc := range []struct {
+		in        string
+		decimal   byte
+		amount    float64
+		direction Direction
+	}{
+		{"1.234.567,89", ',', 1234567.89, ""},
+		{"1,234,567.89", '.', 1234567.89, ""},
+		{"-Rp50.000", ',', 50000, Debit},
+		{"+Rp10.000.000", ',', 10000000, Credit},
+		{"50,000.00 DB", '.', 50000, Debit},
+		{"12.000 CR", ',', 12000, Credit},
+		{"(12.000)", ',', 12000, Debit},
+		{"50.000", ',', 50000, ""}, // Three digits after a lone separator group thousands
+		{"50.5", ',', 50.5, ""},
+		{"50.000", '.', 50, ""}, // Unless the statement says dots are decimal
+		{"IDR 1.500", ',', 1500, ""},
+	} {
+		amount, direction, err := parseAmount(tc.in, tc.decimal)
+		if err != nil || amount != tc.amount || direction != tc.direction {
+			t.Errorf("parseAmount(%q, %q) = %v, %q, %v; want %v, %q", tc.in, tc.decimal, amount, direction, err, tc.amount, tc.direction)
+		}
+	}
+
+	for _, in := range []string{"", "Rp", "12a", "--5"} {
+		if _, _, err := parseAmount(in, ','); err == nil {
+			t.Errorf("parseAmount(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestParseQIFDateOrder(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		dayFirst bool
+		want     string
+	}{
+		{"03.11.2025", true, "2025-11-03"},
+		{"11/03/2025", false, "2025-11-03"},
+		{"10/ 1'25", false, "2025-10-01"},
+		{"2025-12-24", false, "2025-12-24"},
+	} {
+		got, err := parseQIFDate(tc.in, tc.dayFirst)
+		if err != nil || got.Format(time.DateOnly) != tc.want {
+			t.Errorf("parseQIFDate(%q, %v) = %v, %v; want %s", tc.in, tc.dayFirst, got, err, tc.want)
+		}
+	}
+}
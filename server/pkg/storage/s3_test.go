@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is a MinIO-style stand-in: an in-memory bucket that checks the SigV4
+// signature of every request against its own copy of the credentials
+type fakeS3 struct {
+	accessKey string
+	secretKey string
+	region    string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+var authorizationPattern = regexp.MustCompile(
+	`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, SignedHeaders=([a-z0-9;-]+), Signature=([0-9a-f]{64})$`)
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, reason := f.verify(r, body); status != 0 {
+		http.Error(w, reason, status)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[path] = body
+		f.types[path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify recomputes the signature from the request as received, returning the
+// status to refuse it with, or zero when it holds
+func (f *fakeS3) verify(r *http.Request, body []byte) (int, string) {
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != sha256Hex(body) {
+		return http.StatusBadRequest, "XAmzContentSHA256Mismatch"
+	}
+
+	m := authorizationPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if m == nil {
+		return http.StatusForbidden, "AuthorizationHeaderMalformed"
+	}
+	accessKey, day, region, signedHeaders, signature := m[1], m[2], m[3], m[4], m[5]
+	amzDate := r.Header.Get("X-Amz-Date")
+	if accessKey != f.accessKey || region != f.region || !strings.HasPrefix(amzDate, day) {
+		return http.StatusForbidden, "InvalidAccessKeyId"
+	}
+	if signedHeaders != "host;x-amz-content-sha256;x-amz-date" {
+		return http.StatusForbidden, "SignedHeadersUnexpected"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"host:" + r.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+f.secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	if hex.EncodeToString(hmacSHA256(key, stringToSign)) != signature {
+		return http.StatusForbidden, "SignatureDoesNotMatch"
+	}
+	return 0, ""
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	t.Helper()
+	fake := &fakeS3{
+		accessKey: "minioadmin",
+		secretKey: "minio-secret",
+		region:    "ap-southeast-3",
+		objects:   make(map[string][]byte),
+		types:     make(map[string]string),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func TestS3StorePutGetDelete(t *testing.T) {
+	fake, server := newFakeS3(t)
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL + "/",
+		Bucket:    "receipts",
+		Region:    fake.region,
+		AccessKey: fake.accessKey,
+		SecretKey: fake.secretKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Spaces and non-ASCII bytes must be encoded the same way on both sides
+	keys := []string{"attachments/1/receipt.jpg", "attachments/2/struk belanja ü.pdf"}
+	for _, key := range keys {
+		data := []byte("contents of " + key)
+		if err := store.Put(ctx, key, data, "image/jpeg"); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+
+		r, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Get(%q) = %q, want %q", key, got, data)
+		}
+	}
+	if got := fake.types["/receipts/attachments/1/receipt.jpg"]; got != "image/jpeg" {
+		t.Errorf("stored content type %q, want image/jpeg", got)
+	}
+
+	if err := store.Delete(ctx, keys[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, keys[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	// Deleting a missing object succeeds, as on S3
+	if err := store.Delete(ctx, keys[0]); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestS3StoreWrongSecret(t *testing.T) {
+	fake, server := newFakeS3(t)
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "receipts",
+		Region:    fake.region,
+		AccessKey: fake.accessKey,
+		SecretKey: "not-the-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Put(context.Background(), "attachments/1/a.jpg", []byte("x"), "image/jpeg")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with a wrong secret: got %v, want SignatureDoesNotMatch", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("stored %d objects, want none", len(fake.objects))
+	}
+}
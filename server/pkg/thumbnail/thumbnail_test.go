@@ -0,0 +1,48 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerateScalesDown(t *testing.T) {
+	thumb, err := Generate(bytes.NewReader(encodePNG(t, 400, 100)), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 200 || config.Height != 50 {
+		t.Errorf("got %dx%d, want 200x50", config.Width, config.Height)
+	}
+}
+
+func TestGenerateRefusesDecompressionBomb(t *testing.T) {
+	// A 1x1 PNG whose header is rewritten to claim 50000x50000 pixels
+	data := encodePNG(t, 1, 1)
+	ihdr := data[8+4+4 : 8+4+4+13] // After the signature, the chunk length and type
+	binary.BigEndian.PutUint32(ihdr[0:4], 50000)
+	binary.BigEndian.PutUint32(ihdr[4:8], 50000)
+	binary.BigEndian.PutUint32(data[8+4+4+13:], crc32.ChecksumIEEE(data[8+4:8+4+4+13]))
+
+	if _, err := Generate(bytes.NewReader(data), 200); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
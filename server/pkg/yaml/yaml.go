@@ -0,0 +1,122 @@
+// Package yaml converts between Go values and YAML documents by way of
+// encoding/json, so Marshal and Unmarshal follow the json struct tags of the
+// values, as the JSON API does. Parsing and encoding are done by
+// gopkg.in/yaml.v3.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Marshal writes v as block-style YAML, keeping the field order of its JSON encoding
+func Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// A JSON document is a YAML document, so reading it as one keeps its
+	// key order; only the flow style it comes in needs undoing
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal reads a YAML document into v as encoding/json would read the same
+// document written as JSON
+func Unmarshal(data []byte, v any) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	value, err := jsonValue(&doc)
+	if err != nil {
+		return err
+	}
+	data, err = json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// blockStyle clears the styles a node tree was read with, so the encoder picks
+// block collections and only quotes the scalars that need it
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
+
+// jsonValue turns a YAML node into the value of the same JSON document. Keys
+// become strings, and scalars JSON has no type for, such as timestamps, keep
+// the text they were written as.
+func jsonValue(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return jsonValue(n.Content[0])
+	case yaml.AliasNode:
+		return jsonValue(n.Alias)
+	case yaml.SequenceNode:
+		items := make([]any, 0, len(n.Content))
+		for _, child := range n.Content {
+			item, err := jsonValue(child)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case yaml.MappingNode:
+		m := make(map[string]any, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("yaml: line %d: mapping keys must be scalars", key.Line)
+			}
+			if _, ok := m[key.Value]; ok {
+				return nil, fmt.Errorf("yaml: line %d: mapping key %q already defined", key.Line, key.Value)
+			}
+			value, err := jsonValue(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = value
+		}
+		return m, nil
+	}
+
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool", "!!int", "!!float":
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return n.Value, nil
+	}
+}
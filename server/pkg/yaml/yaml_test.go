@@ -0,0 +1,134 @@
+package yaml
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string // The same document as JSON
+	}{
+		{"block mapping", "a: 1\nb: two\n", `{"a":1,"b":"two"}`},
+		{"nested", "rules:\n  - category: Food\n    priority: 10\n  - category: Fees\n", `{"rules":[{"category":"Food","priority":10},{"category":"Fees"}]}`},
+		{"flow collections", "days: [1, 15]\nrange: {min: 0, max: 50000.5}\n", `{"days":[1,15],"range":{"min":0,"max":50000.5}}`},
+		{"comments", "# header\na: b # trailing\n", `{"a":"b"}`},
+		{"quoted", `a: "x: y"` + "\nb: 'it''s'\nc: \"#1\"\n", `{"a":"x: y","b":"it's","c":"#1"}`},
+		{"quoted scalars stay strings", "a: \"true\"\nb: '10'\n", `{"a":"true","b":"10"}`},
+		{"plain scalars", "a: true\nb: null\nc: ~\nd: -3\ne: 0.25\n", `{"a":true,"b":null,"c":null,"d":-3,"e":0.25}`},
+		{"colons and commas in words", "keywords: biaya adm, pph 23, jam 10:30\n", `{"keywords":"biaya adm, pph 23, jam 10:30"}`},
+		{"dates keep their text", "date: 2025-10-01\n", `{"date":"2025-10-01"}`},
+		{"keys become strings", "1: one\ntrue: yes\n", `{"1":"one","true":"yes"}`},
+		{"block scalar", "note: |\n  line one\n  line two\n", `{"note":"line one\nline two\n"}`},
+		{"anchors", "base: &b {p: 1}\ncopy: *b\n", `{"base":{"p":1},"copy":{"p":1}}`},
+		{"empty", "", `null`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got, want any
+			if err := Unmarshal([]byte(tc.in), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+	}{
+		{"mapping in a plain value", "a: b: c\n"},
+		{"unclosed double quote", "a: \"b\n"},
+		{"unclosed single quote", "a: 'b\n"},
+		{"text after a quoted value", "a: \"b\" c\n"},
+		{"unclosed flow sequence", "a: [1, 2\n"},
+		{"unclosed flow mapping", "a: {b: 1\n"},
+		{"outdented sequence item", "a:\n  - b\n - c\n"},
+		{"overindented key", "a: 1\n  b: 2\n"},
+		{"tab indentation", "a:\n\tb: 1\n"},
+		{"duplicate key", "a: 1\na: 2\n"},
+		{"sequence key", "? [a, b]\n: c\n"},
+		{"unknown alias", "a: *missing\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var v any
+			if err := Unmarshal([]byte(tc.in), &v); err == nil {
+				t.Errorf("Unmarshal(%q) = %#v, want an error", tc.in, v)
+			}
+		})
+	}
+}
+
+// Unmarshal reads into structs by their json tags, as the API does
+func TestUnmarshalJSONTags(t *testing.T) {
+	var v struct {
+		Name     string `json:"name"`
+		MinSpend *float64
+		Skipped  string `json:"-"`
+	}
+	if err := Unmarshal([]byte("name: Food\nMinSpend: 12.5\nSkipped: x\n"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "Food" || v.MinSpend == nil || *v.MinSpend != 12.5 || v.Skipped != "" {
+		t.Errorf("got %+v", v)
+	}
+
+	var n struct {
+		Priority int `json:"priority"`
+	}
+	if err := Unmarshal([]byte("priority: high\n"), &n); err == nil {
+		t.Error("a string read into an int field succeeded, want an error")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	type rule struct {
+		Category string `json:"category"`
+		Keywords string `json:"keywords,omitempty"`
+		Days     []int  `json:"days,omitempty"`
+		Priority int    `json:"priority"`
+	}
+	pack := struct {
+		Version int    `json:"version"`
+		Note    string `json:"note"`
+		Rules   []rule `json:"rules"`
+	}{
+		Version: 1,
+		Note:    "a: b",
+		Rules: []rule{
+			{Category: "Food", Keywords: "gofood, grabfood", Priority: 10},
+			{Category: "true", Days: []int{1, 15}},
+			{Category: "123"},
+			{Category: "# hash"},
+			{Category: "line one\nline two"},
+		},
+	}
+
+	out, err := Marshal(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields keep their struct order, in block style with two-space indents
+	if !strings.HasPrefix(string(out), "version: 1\nnote: 'a: b'\nrules:\n  - category: Food\n    keywords: gofood, grabfood\n    priority: 10\n") {
+		t.Errorf("unexpected layout:\n%s", out)
+	}
+
+	got := pack
+	got.Rules = nil
+	if err := Unmarshal(out, &got); err != nil {
+		t.Fatalf("reading back:\n%s\n%v", out, err)
+	}
+	if !reflect.DeepEqual(got, pack) {
+		t.Errorf("round trip changed the value:\n got %+v\nwant %+v\n%s", got, pack, out)
+	}
+}
@@ -5,6 +5,10 @@ Bank Statement PDF Parser for Budget Manager
 Parses PDF bank statements from BCA, JAGO, and Line Bank,
 extracts transactions, and inserts them as expenses with
 keyword-based budget categorization.
+
+Deprecated: this script writes to SQLite directly and skips the server's
+validation and budget bookkeeping. Prefer POST /api/imports, which takes
+CSV exports or the text of a PDF statement (pdftotext -layout).
 """
 
 import argparse
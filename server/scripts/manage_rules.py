@@ -7,6 +7,7 @@ bank statement transactions.
 """
 
 import argparse
+import json
 import sqlite3
 from datetime import datetime
 from pathlib import Path
@@ -19,6 +20,33 @@ def get_connection(db_path: str) -> sqlite3.Connection:
     return conn
 
 
+def keyword_columns(cursor: sqlite3.Cursor, keywords: str) -> dict:
+    """Columns storing comma-separated keywords as the server does.
+
+    The server matches rules by their conditions, so keywords become
+    "contains" conditions, any of which matches. Databases from before
+    conditions only get the keywords, which the server converts on startup.
+    """
+    values = [k.strip() for k in keywords.split(',') if k.strip()]
+    columns = {'keywords': ','.join(values)}
+    cursor.execute("PRAGMA table_info(budget_rules)")
+    if 'conditions' in {row['name'] for row in cursor.fetchall()}:
+        columns['operator'] = 'or'
+        columns['conditions'] = json.dumps([{'type': 'contains', 'value': v} for v in values])
+    return columns
+
+
+def insert_rule(cursor: sqlite3.Cursor, budget_id: int, keywords: str, priority: int):
+    """Insert an active keyword rule."""
+    now = datetime.now().strftime('%Y-%m-%d %H:%M:%S')
+    columns = keyword_columns(cursor, keywords)
+    columns.update(budget_id=budget_id, priority=priority, is_active=1, created_at=now, updated_at=now)
+    cursor.execute(
+        f"INSERT INTO budget_rules ({', '.join(columns)}) VALUES ({', '.join('?' * len(columns))})",
+        list(columns.values())
+    )
+
+
 def list_rules(db_path: str, show_inactive: bool = False):
     """List all budget rules."""
     conn = get_connection(db_path)
@@ -91,11 +119,7 @@ def add_rule(db_path: str, budget_id: int, keywords: str, priority: int = 0):
         conn.close()
         return
 
-    now = datetime.now().strftime('%Y-%m-%d %H:%M:%S')
-    cursor.execute("""
-        INSERT INTO budget_rules (budget_id, keywords, priority, is_active, created_at, updated_at)
-        VALUES (?, ?, ?, 1, ?, ?)
-    """, (budget_id, keywords, priority, now, now))
+    insert_rule(cursor, budget_id, keywords, priority)
 
     conn.commit()
     rule_id = cursor.lastrowid
@@ -122,8 +146,10 @@ def update_rule(db_path: str, rule_id: int, keywords: str = None, priority: int
     params = []
 
     if keywords is not None:
-        updates.append("keywords = ?")
-        params.append(keywords)
+        # New keywords replace the rule's conditions, as in the API
+        for column, value in keyword_columns(cursor, keywords).items():
+            updates.append(f"{column} = ?")
+            params.append(value)
     if priority is not None:
         updates.append("priority = ?")
         params.append(priority)
@@ -220,7 +246,11 @@ def test_match(db_path: str, description: str):
 
 
 def setup_common_rules(db_path: str):
-    """Setup common Indonesian expense categorization rules."""
+    """Setup common Indonesian expense categorization rules.
+
+    Deprecated: the server ships these as the id-merchants preset, install it
+    with POST /api/budget-rules/presets/id-merchants/install.
+    """
     conn = get_connection(db_path)
     cursor = conn.cursor()
 
@@ -263,11 +293,7 @@ def setup_common_rules(db_path: str):
                 print(f"  [SKIP] Budget '{budget['name']}' already has rules")
                 continue
 
-            now = datetime.now().strftime('%Y-%m-%d %H:%M:%S')
-            cursor.execute("""
-                INSERT INTO budget_rules (budget_id, keywords, priority, is_active, created_at, updated_at)
-                VALUES (?, ?, ?, 1, ?, ?)
-            """, (budget['id'], keywords, priority, now, now))
+            insert_rule(cursor, budget['id'], keywords, priority)
             print(f"  [OK] Created rule for '{budget['name']}'")
         else:
             print(f"  [SKIP] No budget matching '{budget_pattern}' found")
@@ -323,7 +349,7 @@ def main():
     test_parser.add_argument('description', help='Transaction description to test')
 
     # Setup common rules
-    subparsers.add_parser('setup', help='Setup common Indonesian expense rules')
+    subparsers.add_parser('setup', help='Setup common Indonesian expense rules (deprecated, see the id-merchants preset)')
 
     args = parser.parse_args()
 